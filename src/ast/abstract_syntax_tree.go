@@ -2,6 +2,13 @@ package ast
 
 type Node interface{}
 
+// Position is the place in the source where a node starts, 1-based like the
+// tokenizer's lines. Binary expressions are positioned at their operator.
+type Position struct {
+	Line   int
+	Column int
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -14,6 +21,7 @@ type Statement interface {
 
 type PrintStatement struct {
 	Expression Expression
+	Pos        Position
 }
 
 func (ps *PrintStatement) statementNode() {}
@@ -21,6 +29,7 @@ func (ps *PrintStatement) statementNode() {}
 type LetStatement struct {
 	Identifier Identifier
 	Value      Expression
+	Pos        Position
 }
 
 func (as *LetStatement) statementNode() {}
@@ -28,6 +37,7 @@ func (as *LetStatement) statementNode() {}
 type AssignmentStatement struct {
 	Identifier Identifier
 	Value      Expression
+	Pos        Position
 }
 
 func (as *AssignmentStatement) statementNode() {}
@@ -36,6 +46,7 @@ type IfStatement struct {
 	Condition  Expression
 	ThenBranch Statement
 	ElseBranch Statement
+	Pos        Position
 }
 
 func (ifs *IfStatement) statementNode() {}
@@ -43,20 +54,53 @@ func (ifs *IfStatement) statementNode() {}
 type WhileStatement struct {
 	Condition Expression
 	DoBranch  []Statement
+	Pos       Position
 }
 
 func (ifs *WhileStatement) statementNode() {}
 
 type CommentStatement struct {
 	Text string
+	Pos  Position
 }
 
 func (cs *CommentStatement) statementNode() {}
 
-type EndStatement struct{}
+type EndStatement struct {
+	Pos Position
+}
 
 func (es *EndStatement) statementNode() {}
 
+type DataStatement struct {
+	Values []Expression
+	Pos    Position
+}
+
+func (ds *DataStatement) statementNode() {}
+
+type ReadStatement struct {
+	Identifiers []Identifier
+	Pos         Position
+}
+
+func (rs *ReadStatement) statementNode() {}
+
+type RestoreStatement struct {
+	Pos Position
+}
+
+func (rs *RestoreStatement) statementNode() {}
+
+// BadStatement stands for a malformed statement the parser skipped in
+// recovery mode. Text is made of the tokens it skipped.
+type BadStatement struct {
+	Text string
+	Pos  Position
+}
+
+func (bs *BadStatement) statementNode() {}
+
 // Expressions
 type Expression interface {
 	Node
@@ -65,18 +109,28 @@ type Expression interface {
 
 type IntegerLiteral struct {
 	Value int
+	Pos   Position
 }
 
 func (il *IntegerLiteral) expressionNode() {}
 
 type FloatLiteral struct {
 	Value float64
+	Pos   Position
 }
 
 func (fl *FloatLiteral) expressionNode() {}
 
+type StringLiteral struct {
+	Value string
+	Pos   Position
+}
+
+func (sl *StringLiteral) expressionNode() {}
+
 type Identifier struct {
 	Name string
+	Pos  Position
 }
 
 func (id *Identifier) expressionNode() {}
@@ -85,6 +139,17 @@ type BinaryExpression struct {
 	Left     Expression
 	Operator string
 	Right    Expression
+	Pos      Position
 }
 
 func (be *BinaryExpression) expressionNode() {}
+
+// BadExpression stands for a malformed expression the parser skipped in
+// recovery mode. Text is made of the tokens it skipped, and may be empty when
+// the expression is missing.
+type BadExpression struct {
+	Text string
+	Pos  Position
+}
+
+func (be *BadExpression) expressionNode() {}
@@ -0,0 +1,58 @@
+package ast
+
+import "reflect"
+
+// Equal reports whether two syntax trees have the same structure: nodes of
+// the same types in the same places, with the same names, values, operators
+// and texts. Positions are not compared, so a program equals the program
+// parsed from its formatted source.
+func Equal(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !sameAttributes(a, b) {
+		return false
+	}
+
+	aChildren, bChildren := children(a), children(b)
+	if len(aChildren) != len(bChildren) {
+		return false
+	}
+	for i := range aChildren {
+		if !Equal(aChildren[i], bChildren[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAttributes compares what two nodes of the same type hold apart from
+// their children and positions.
+func sameAttributes(a, b Node) bool {
+	switch a := a.(type) {
+	case *IfStatement:
+		// Without it, an IF with an ELSE and no THEN would equal one with a
+		// THEN and no ELSE
+		return (a.ThenBranch == nil) == (b.(*IfStatement).ThenBranch == nil)
+	case *CommentStatement:
+		return a.Text == b.(*CommentStatement).Text
+	case *BadStatement:
+		return a.Text == b.(*BadStatement).Text
+	case *IntegerLiteral:
+		return a.Value == b.(*IntegerLiteral).Value
+	case *FloatLiteral:
+		return a.Value == b.(*FloatLiteral).Value
+	case *StringLiteral:
+		return a.Value == b.(*StringLiteral).Value
+	case *Identifier:
+		return a.Name == b.(*Identifier).Name
+	case *BinaryExpression:
+		return a.Operator == b.(*BinaryExpression).Operator
+	case *BadExpression:
+		return a.Text == b.(*BadExpression).Text
+	case *Program, *PrintStatement, *LetStatement, *AssignmentStatement, *WhileStatement,
+		*EndStatement, *DataStatement, *ReadStatement, *RestoreStatement:
+		return true
+	}
+	panic(&UnsupportedError{Node: a})
+}
@@ -0,0 +1,511 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SchemaVersion is the version of the JSON form of programs. It changes
+// whenever a node type or a field changes, and UnmarshalProgram rejects
+// documents of other versions.
+const SchemaVersion = 1
+
+// MarshalProgram encodes a program as an indented JSON document:
+//
+//	{"version": 1, "statements": [...]}
+//
+// Every node is an object whose "type" is the name of its Go type, such as
+// "LetStatement" or "BinaryExpression", followed by its "line" and "column"
+// and by its fields in lower case:
+//
+//	PrintStatement       expression
+//	LetStatement         identifier, value
+//	AssignmentStatement  identifier, value
+//	IfStatement          condition, then, else (optional)
+//	WhileStatement       condition, do (list)
+//	CommentStatement     text
+//	EndStatement
+//	DataStatement        values (list)
+//	ReadStatement        identifiers (list)
+//	RestoreStatement
+//	BadStatement         text
+//	IntegerLiteral       value
+//	FloatLiteral         value
+//	StringLiteral        value
+//	Identifier           name
+//	BinaryExpression     operator, left, right
+//	BadExpression        text
+func MarshalProgram(program *Program) ([]byte, error) {
+	statements := []any{}
+	for _, stmt := range program.Statements {
+		encoded, err := encodeStatement(stmt)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, encoded)
+	}
+
+	compact, err := object{{"version", SchemaVersion}, {"statements", statements}}.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact, "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteString("\n")
+	return indented.Bytes(), nil
+}
+
+// object is a JSON object that keeps the order of its fields.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	// Operators are made of the characters HTML escaping would rewrite
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	buffer.WriteString("{")
+	for i, field := range o {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		if err := encoder.Encode(field.key); err != nil {
+			return nil, err
+		}
+		buffer.Truncate(buffer.Len() - 1)
+		buffer.WriteString(":")
+		if err := encoder.Encode(field.value); err != nil {
+			return nil, err
+		}
+		buffer.Truncate(buffer.Len() - 1)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+func node(nodeType string, pos Position, fields ...field) object {
+	return append(object{{"type", nodeType}, {"line", pos.Line}, {"column", pos.Column}}, fields...)
+}
+
+func encodeStatement(stmt Statement) (object, error) {
+	switch stmt := stmt.(type) {
+	case *PrintStatement:
+		expression, err := encodeExpression(stmt.Expression)
+		return node("PrintStatement", stmt.Pos, field{"expression", expression}), err
+	case *LetStatement:
+		value, err := encodeExpression(stmt.Value)
+		return node("LetStatement", stmt.Pos, field{"identifier", encodeIdentifier(stmt.Identifier)}, field{"value", value}), err
+	case *AssignmentStatement:
+		value, err := encodeExpression(stmt.Value)
+		return node("AssignmentStatement", stmt.Pos, field{"identifier", encodeIdentifier(stmt.Identifier)}, field{"value", value}), err
+	case *IfStatement:
+		condition, err := encodeExpression(stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+		then, err := encodeStatement(stmt.ThenBranch)
+		if err != nil {
+			return nil, err
+		}
+		encoded := node("IfStatement", stmt.Pos, field{"condition", condition}, field{"then", then})
+		if stmt.ElseBranch != nil {
+			elseBranch, err := encodeStatement(stmt.ElseBranch)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, field{"else", elseBranch})
+		}
+		return encoded, nil
+	case *WhileStatement:
+		condition, err := encodeExpression(stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+		body := []any{}
+		for _, statement := range stmt.DoBranch {
+			encoded, err := encodeStatement(statement)
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, encoded)
+		}
+		return node("WhileStatement", stmt.Pos, field{"condition", condition}, field{"do", body}), nil
+	case *CommentStatement:
+		return node("CommentStatement", stmt.Pos, field{"text", stmt.Text}), nil
+	case *EndStatement:
+		return node("EndStatement", stmt.Pos), nil
+	case *DataStatement:
+		values := []any{}
+		for _, value := range stmt.Values {
+			encoded, err := encodeExpression(value)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, encoded)
+		}
+		return node("DataStatement", stmt.Pos, field{"values", values}), nil
+	case *ReadStatement:
+		identifiers := []any{}
+		for _, identifier := range stmt.Identifiers {
+			identifiers = append(identifiers, encodeIdentifier(identifier))
+		}
+		return node("ReadStatement", stmt.Pos, field{"identifiers", identifiers}), nil
+	case *RestoreStatement:
+		return node("RestoreStatement", stmt.Pos), nil
+	case *BadStatement:
+		return node("BadStatement", stmt.Pos, field{"text", stmt.Text}), nil
+	}
+	return nil, &UnsupportedError{Node: stmt}
+}
+
+func encodeIdentifier(identifier Identifier) object {
+	return node("Identifier", identifier.Pos, field{"name", identifier.Name})
+}
+
+func encodeExpression(expr Expression) (object, error) {
+	switch expr := expr.(type) {
+	case *IntegerLiteral:
+		return node("IntegerLiteral", expr.Pos, field{"value", expr.Value}), nil
+	case *FloatLiteral:
+		return node("FloatLiteral", expr.Pos, field{"value", expr.Value}), nil
+	case *StringLiteral:
+		return node("StringLiteral", expr.Pos, field{"value", expr.Value}), nil
+	case *Identifier:
+		return encodeIdentifier(*expr), nil
+	case *BinaryExpression:
+		left, err := encodeExpression(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := encodeExpression(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return node("BinaryExpression", expr.Pos, field{"operator", expr.Operator}, field{"left", left}, field{"right", right}), nil
+	case *BadExpression:
+		return node("BadExpression", expr.Pos, field{"text", expr.Text}), nil
+	}
+	return nil, &UnsupportedError{Node: expr}
+}
+
+// UnmarshalProgram decodes a program encoded by MarshalProgram, or written by
+// another tool following the same schema. "line" and "column" may be left
+// out; every other field is required, unless it is optional above, and
+// unknown fields are errors. Errors name the path of the offending value,
+// such as "statements[2].value.left".
+func UnmarshalProgram(data []byte) (*Program, error) {
+	var document struct {
+		Version    *int              `json:"version"`
+		Statements []json.RawMessage `json:"statements"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid syntax tree: %w", err)
+	}
+	if document.Version == nil {
+		return nil, fmt.Errorf("invalid syntax tree: missing version")
+	}
+	if *document.Version != SchemaVersion {
+		return nil, fmt.Errorf("syntax tree version %d is not supported, expected %d", *document.Version, SchemaVersion)
+	}
+
+	program := &Program{Statements: []Statement{}}
+	for i, raw := range document.Statements {
+		stmt, err := decodeStatement(raw, fmt.Sprintf("statements[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+		program.Statements = append(program.Statements, stmt)
+	}
+	return program, nil
+}
+
+// jsonNode is a node being decoded. It remembers the fields that were read,
+// so the ones left over can be reported.
+type jsonNode struct {
+	path   string
+	fields map[string]json.RawMessage
+	read   map[string]bool
+}
+
+func decodeNode(raw json.RawMessage, path string) (*jsonNode, string, error) {
+	n := &jsonNode{path: path, read: map[string]bool{"type": true, "line": true, "column": true}}
+	if err := json.Unmarshal(raw, &n.fields); err != nil || n.fields == nil {
+		return nil, "", fmt.Errorf("%s: expected a node object", path)
+	}
+	var nodeType string
+	if err := n.value("type", &nodeType); err != nil {
+		return nil, "", err
+	}
+	return n, nodeType, nil
+}
+
+func (n *jsonNode) errorf(key string, format string, args ...any) error {
+	return fmt.Errorf("%s.%s: %s", n.path, key, fmt.Sprintf(format, args...))
+}
+
+func (n *jsonNode) has(key string) bool {
+	_, found := n.fields[key]
+	return found
+}
+
+func (n *jsonNode) value(key string, value any) error {
+	raw, found := n.fields[key]
+	if !found {
+		return fmt.Errorf("%s: missing field '%s'", n.path, key)
+	}
+	n.read[key] = true
+	if err := json.Unmarshal(raw, value); err != nil {
+		return n.errorf(key, "%v", err)
+	}
+	return nil
+}
+
+func (n *jsonNode) position() (Position, error) {
+	var pos Position
+	for key, target := range map[string]*int{"line": &pos.Line, "column": &pos.Column} {
+		if raw, found := n.fields[key]; found {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return pos, n.errorf(key, "%v", err)
+			}
+		}
+	}
+	return pos, nil
+}
+
+func (n *jsonNode) list(key string) ([]json.RawMessage, error) {
+	var list []json.RawMessage
+	if err := n.value(key, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (n *jsonNode) statement(key string) (Statement, error) {
+	raw, found := n.fields[key]
+	if !found {
+		return nil, fmt.Errorf("%s: missing field '%s'", n.path, key)
+	}
+	n.read[key] = true
+	return decodeStatement(raw, n.path+"."+key)
+}
+
+func (n *jsonNode) expression(key string) (Expression, error) {
+	raw, found := n.fields[key]
+	if !found {
+		return nil, fmt.Errorf("%s: missing field '%s'", n.path, key)
+	}
+	n.read[key] = true
+	return decodeExpression(raw, n.path+"."+key)
+}
+
+func (n *jsonNode) identifier(key string) (Identifier, error) {
+	raw, found := n.fields[key]
+	if !found {
+		return Identifier{}, fmt.Errorf("%s: missing field '%s'", n.path, key)
+	}
+	n.read[key] = true
+	return decodeIdentifier(raw, n.path+"."+key)
+}
+
+// done reports the fields no decoder read.
+func (n *jsonNode) done() error {
+	unknown := []string{}
+	for key := range n.fields {
+		if !n.read[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%s: unknown field '%s'", n.path, unknown[0])
+}
+
+func decodeStatement(raw json.RawMessage, path string) (Statement, error) {
+	n, nodeType, err := decodeNode(raw, path)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := n.position()
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt Statement
+	switch nodeType {
+	case "PrintStatement":
+		s := &PrintStatement{Pos: pos}
+		s.Expression, err = n.expression("expression")
+		stmt = s
+	case "LetStatement":
+		s := &LetStatement{Pos: pos}
+		if s.Identifier, err = n.identifier("identifier"); err == nil {
+			s.Value, err = n.expression("value")
+		}
+		stmt = s
+	case "AssignmentStatement":
+		s := &AssignmentStatement{Pos: pos}
+		if s.Identifier, err = n.identifier("identifier"); err == nil {
+			s.Value, err = n.expression("value")
+		}
+		stmt = s
+	case "IfStatement":
+		s := &IfStatement{Pos: pos}
+		if s.Condition, err = n.expression("condition"); err == nil {
+			s.ThenBranch, err = n.statement("then")
+		}
+		if err == nil && n.has("else") {
+			s.ElseBranch, err = n.statement("else")
+		}
+		stmt = s
+	case "WhileStatement":
+		s := &WhileStatement{Pos: pos, DoBranch: []Statement{}}
+		var body []json.RawMessage
+		if s.Condition, err = n.expression("condition"); err == nil {
+			body, err = n.list("do")
+		}
+		for i := 0; err == nil && i < len(body); i++ {
+			var statement Statement
+			statement, err = decodeStatement(body[i], fmt.Sprintf("%s.do[%d]", path, i))
+			s.DoBranch = append(s.DoBranch, statement)
+		}
+		stmt = s
+	case "CommentStatement":
+		s := &CommentStatement{Pos: pos}
+		err = n.value("text", &s.Text)
+		stmt = s
+	case "EndStatement":
+		stmt = &EndStatement{Pos: pos}
+	case "DataStatement":
+		s := &DataStatement{Pos: pos, Values: []Expression{}}
+		var values []json.RawMessage
+		values, err = n.list("values")
+		for i := 0; err == nil && i < len(values); i++ {
+			var value Expression
+			value, err = decodeExpression(values[i], fmt.Sprintf("%s.values[%d]", path, i))
+			s.Values = append(s.Values, value)
+		}
+		stmt = s
+	case "ReadStatement":
+		s := &ReadStatement{Pos: pos, Identifiers: []Identifier{}}
+		var identifiers []json.RawMessage
+		identifiers, err = n.list("identifiers")
+		for i := 0; err == nil && i < len(identifiers); i++ {
+			var identifier Identifier
+			identifier, err = decodeIdentifier(identifiers[i], fmt.Sprintf("%s.identifiers[%d]", path, i))
+			s.Identifiers = append(s.Identifiers, identifier)
+		}
+		stmt = s
+	case "RestoreStatement":
+		stmt = &RestoreStatement{Pos: pos}
+	case "BadStatement":
+		s := &BadStatement{Pos: pos}
+		err = n.value("text", &s.Text)
+		stmt = s
+	default:
+		return nil, n.errorf("type", "unknown statement type %q", nodeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stmt, n.done()
+}
+
+func decodeIdentifier(raw json.RawMessage, path string) (Identifier, error) {
+	expr, err := decodeExpression(raw, path)
+	if err != nil {
+		return Identifier{}, err
+	}
+	identifier, ok := expr.(*Identifier)
+	if !ok {
+		return Identifier{}, fmt.Errorf("%s: expected an Identifier", path)
+	}
+	return *identifier, nil
+}
+
+func decodeExpression(raw json.RawMessage, path string) (Expression, error) {
+	n, nodeType, err := decodeNode(raw, path)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := n.position()
+	if err != nil {
+		return nil, err
+	}
+
+	var expr Expression
+	switch nodeType {
+	case "IntegerLiteral":
+		e := &IntegerLiteral{Pos: pos}
+		err = n.value("value", &e.Value)
+		expr = e
+	case "FloatLiteral":
+		e := &FloatLiteral{Pos: pos}
+		err = n.value("value", &e.Value)
+		expr = e
+	case "StringLiteral":
+		e := &StringLiteral{Pos: pos}
+		err = n.value("value", &e.Value)
+		expr = e
+	case "Identifier":
+		e := &Identifier{Pos: pos}
+		if err = n.value("name", &e.Name); err == nil && !validName(e.Name) {
+			err = n.errorf("name", "%q is not a valid identifier", e.Name)
+		}
+		expr = e
+	case "BinaryExpression":
+		e := &BinaryExpression{Pos: pos}
+		err = n.value("operator", &e.Operator)
+		if err == nil && !strings.Contains(" == < > + - * / ", " "+e.Operator+" ") {
+			err = n.errorf("operator", "unknown operator %q", e.Operator)
+		}
+		if err == nil {
+			e.Left, err = n.expression("left")
+		}
+		if err == nil {
+			e.Right, err = n.expression("right")
+		}
+		expr = e
+	case "BadExpression":
+		e := &BadExpression{Pos: pos}
+		err = n.value("text", &e.Text)
+		expr = e
+	default:
+		return nil, n.errorf("type", "unknown expression type %q", nodeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expr, n.done()
+}
+
+// validName accepts the identifiers of every lexer mode: a letter followed by
+// letters, digits and underscores, with an optional '$' or '%' type suffix.
+func validName(name string) bool {
+	if strings.HasSuffix(name, "$") || strings.HasSuffix(name, "%") {
+		name = name[:len(name)-1]
+	}
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r) && r != '_') {
+			return false
+		}
+	}
+	return true
+}
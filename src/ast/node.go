@@ -0,0 +1,107 @@
+package ast
+
+import "fmt"
+
+// Nodes returns an empty node of every type of the package, the program
+// included. Checks that a phase handles every node type start from it, so a
+// new node type must be added here.
+func Nodes() []Node {
+	return []Node{
+		&Program{},
+		&PrintStatement{},
+		&LetStatement{},
+		&AssignmentStatement{},
+		&IfStatement{},
+		&WhileStatement{},
+		&CommentStatement{},
+		&EndStatement{},
+		&DataStatement{},
+		&ReadStatement{},
+		&RestoreStatement{},
+		&BadStatement{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&StringLiteral{},
+		&Identifier{},
+		&BinaryExpression{},
+		&BadExpression{},
+	}
+}
+
+// PositionOf returns the position of a node. The program has none and
+// returns the zero Position.
+func PositionOf(node Node) Position {
+	switch node := node.(type) {
+	case *Program:
+		return Position{}
+	case *PrintStatement:
+		return node.Pos
+	case *LetStatement:
+		return node.Pos
+	case *AssignmentStatement:
+		return node.Pos
+	case *IfStatement:
+		return node.Pos
+	case *WhileStatement:
+		return node.Pos
+	case *CommentStatement:
+		return node.Pos
+	case *EndStatement:
+		return node.Pos
+	case *DataStatement:
+		return node.Pos
+	case *ReadStatement:
+		return node.Pos
+	case *RestoreStatement:
+		return node.Pos
+	case *BadStatement:
+		return node.Pos
+	case *IntegerLiteral:
+		return node.Pos
+	case *FloatLiteral:
+		return node.Pos
+	case *StringLiteral:
+		return node.Pos
+	case *Identifier:
+		return node.Pos
+	case *BinaryExpression:
+		return node.Pos
+	case *BadExpression:
+		return node.Pos
+	}
+	panic(&UnsupportedError{Node: node})
+}
+
+// UnsupportedError reports a node whose type a phase does not handle, which
+// means the type was added to the package without updating the phase.
+type UnsupportedError struct {
+	Node Node
+}
+
+func (e *UnsupportedError) Error() string {
+	switch e.Node.(type) {
+	case Statement:
+		return fmt.Sprintf("unsupported statement %T", e.Node)
+	case Expression:
+		return fmt.Sprintf("unsupported expression %T", e.Node)
+	}
+	return fmt.Sprintf("unsupported node %T", e.Node)
+}
+
+// Recover turns a panic with an *UnsupportedError into an error stored in
+// *err, and lets other panics through. Phases that have no way to return an
+// error from the depths of the tree panic with an *UnsupportedError and
+// defer Recover where they start:
+//
+//	defer ast.Recover(&err)
+func Recover(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	unsupported, ok := r.(*UnsupportedError)
+	if !ok {
+		panic(r)
+	}
+	*err = unsupported
+}
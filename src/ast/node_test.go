@@ -0,0 +1,66 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"tiny-basic/src/ast"
+)
+
+// TestNodesComplete checks Nodes against the declarations of the package:
+// every type that is a statement or an expression, and the program, must be
+// listed, so that a new node type cannot be left out of the checks that
+// start from Nodes.
+func TestNodesComplete(t *testing.T) {
+	fset := token.NewFileSet()
+	names, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []*goast.File{}
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := config.Check("tiny-basic/src/ast", fset, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement := pkg.Scope().Lookup("Statement").Type().Underlying().(*types.Interface)
+	expression := pkg.Scope().Lookup("Expression").Type().Underlying().(*types.Interface)
+	declared := []string{}
+	for _, name := range pkg.Scope().Names() {
+		typeName, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || types.IsInterface(typeName.Type()) {
+			continue
+		}
+		pointer := types.NewPointer(typeName.Type())
+		if name == "Program" || types.Implements(pointer, statement) || types.Implements(pointer, expression) {
+			declared = append(declared, "*ast."+name)
+		}
+	}
+
+	listed := []string{}
+	for _, node := range ast.Nodes() {
+		listed = append(listed, fmt.Sprintf("%T", node))
+	}
+	sort.Strings(listed)
+	if strings.Join(listed, " ") != strings.Join(declared, " ") {
+		t.Errorf("Nodes lists\n%v\nthe package declares\n%v", listed, declared)
+	}
+}
@@ -0,0 +1,154 @@
+package ast
+
+import "fmt"
+
+// Rewrite transforms a syntax tree from the leaves up: the children of a
+// node are rewritten first, then f is called with a copy of the node holding
+// the rewritten children, and what f returns takes the place of the node. The
+// tree passed to Rewrite is left unchanged.
+//
+// f must return a statement for a statement, an expression for an expression
+// and an *Identifier for the identifiers of LET, assignments and READ. It
+// may return nil to remove a statement from the program or from a WHILE
+// body, or to remove the ELSE branch of an IF.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if node == nil {
+		return nil
+	}
+	return f(rewriteChildren(node, f))
+}
+
+// Clone returns a deep copy of a syntax tree.
+func Clone[T Node](node T) T {
+	clone, _ := Rewrite(node, func(node Node) Node { return node }).(T)
+	return clone
+}
+
+// rewriteChildren returns a copy of node whose children were rewritten.
+func rewriteChildren(node Node, f func(Node) Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: rewriteStatements(node.Statements, f)}
+	case *PrintStatement:
+		stmt := *node
+		stmt.Expression = rewriteExpression(node.Expression, f)
+		return &stmt
+	case *LetStatement:
+		stmt := *node
+		stmt.Identifier = rewriteIdentifier(node.Identifier, f)
+		stmt.Value = rewriteExpression(node.Value, f)
+		return &stmt
+	case *AssignmentStatement:
+		stmt := *node
+		stmt.Identifier = rewriteIdentifier(node.Identifier, f)
+		stmt.Value = rewriteExpression(node.Value, f)
+		return &stmt
+	case *IfStatement:
+		stmt := *node
+		stmt.Condition = rewriteExpression(node.Condition, f)
+		stmt.ThenBranch = rewriteStatement(node.ThenBranch, f)
+		if stmt.ThenBranch == nil && node.ThenBranch != nil {
+			panic("ast.Rewrite: the THEN branch of an IF cannot be removed")
+		}
+		stmt.ElseBranch = rewriteStatement(node.ElseBranch, f)
+		return &stmt
+	case *WhileStatement:
+		stmt := *node
+		stmt.Condition = rewriteExpression(node.Condition, f)
+		stmt.DoBranch = rewriteStatements(node.DoBranch, f)
+		return &stmt
+	case *CommentStatement:
+		stmt := *node
+		return &stmt
+	case *EndStatement:
+		stmt := *node
+		return &stmt
+	case *DataStatement:
+		stmt := *node
+		stmt.Values = make([]Expression, len(node.Values))
+		for i, value := range node.Values {
+			stmt.Values[i] = rewriteExpression(value, f)
+		}
+		return &stmt
+	case *ReadStatement:
+		stmt := *node
+		stmt.Identifiers = make([]Identifier, len(node.Identifiers))
+		for i, identifier := range node.Identifiers {
+			stmt.Identifiers[i] = rewriteIdentifier(identifier, f)
+		}
+		return &stmt
+	case *RestoreStatement:
+		stmt := *node
+		return &stmt
+	case *BadStatement:
+		stmt := *node
+		return &stmt
+	case *IntegerLiteral:
+		expr := *node
+		return &expr
+	case *FloatLiteral:
+		expr := *node
+		return &expr
+	case *StringLiteral:
+		expr := *node
+		return &expr
+	case *Identifier:
+		expr := *node
+		return &expr
+	case *BinaryExpression:
+		expr := *node
+		expr.Left = rewriteExpression(node.Left, f)
+		expr.Right = rewriteExpression(node.Right, f)
+		return &expr
+	case *BadExpression:
+		expr := *node
+		return &expr
+	}
+	panic(&UnsupportedError{Node: node})
+}
+
+func rewriteStatements(statements []Statement, f func(Node) Node) []Statement {
+	rewritten := []Statement{}
+	for _, stmt := range statements {
+		if stmt = rewriteStatement(stmt, f); stmt != nil {
+			rewritten = append(rewritten, stmt)
+		}
+	}
+	return rewritten
+}
+
+func rewriteStatement(stmt Statement, f func(Node) Node) Statement {
+	if stmt == nil {
+		return nil
+	}
+	result := Rewrite(stmt, f)
+	if result == nil {
+		return nil
+	}
+	rewritten, ok := result.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: statement %T rewritten to %T", stmt, result))
+	}
+	return rewritten
+}
+
+func rewriteExpression(expr Expression, f func(Node) Node) Expression {
+	if expr == nil {
+		return nil
+	}
+	result := Rewrite(expr, f)
+	rewritten, ok := result.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: expression %T rewritten to %T", expr, result))
+	}
+	return rewritten
+}
+
+func rewriteIdentifier(identifier Identifier, f func(Node) Node) Identifier {
+	result := Rewrite(&identifier, f)
+	rewritten, ok := result.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: identifier %s rewritten to %T", identifier.Name, result))
+	}
+	return *rewritten
+}
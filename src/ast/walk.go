@@ -0,0 +1,90 @@
+package ast
+
+// A Visitor's Visit method is called by Walk for every node. When it returns
+// a visitor w other than nil, Walk visits the children of the node with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order, the children of a node
+// in the order they appear in the source. The identifiers of LET,
+// assignments and READ are visited as *Identifier pointing into their
+// statement. Walk panics with an *UnsupportedError for node types it does
+// not know.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree like Walk, calling f for every node. The
+// children of a node are visited when f returns true, followed by a call of
+// f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// children returns the children of a node in source order. Missing optional
+// children, like the ELSE branch of an IF, are left out.
+func children(node Node) []Node {
+	nodes := []Node{}
+	add := func(child Node) {
+		if child != nil {
+			nodes = append(nodes, child)
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+	case *PrintStatement:
+		add(node.Expression)
+	case *LetStatement:
+		add(&node.Identifier)
+		add(node.Value)
+	case *AssignmentStatement:
+		add(&node.Identifier)
+		add(node.Value)
+	case *IfStatement:
+		add(node.Condition)
+		add(node.ThenBranch)
+		add(node.ElseBranch)
+	case *WhileStatement:
+		add(node.Condition)
+		for _, stmt := range node.DoBranch {
+			add(stmt)
+		}
+	case *DataStatement:
+		for _, value := range node.Values {
+			add(value)
+		}
+	case *ReadStatement:
+		for i := range node.Identifiers {
+			add(&node.Identifiers[i])
+		}
+	case *BinaryExpression:
+		add(node.Left)
+		add(node.Right)
+	case *CommentStatement, *EndStatement, *RestoreStatement, *BadStatement,
+		*IntegerLiteral, *FloatLiteral, *StringLiteral, *Identifier, *BadExpression:
+	default:
+		panic(&UnsupportedError{Node: node})
+	}
+	return nodes
+}
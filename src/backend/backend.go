@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/semantic"
+)
+
+// Options describes the compilation a backend is generating code for.
+type Options struct {
+	// SourceFile and Source are the name and content of the .tb input.
+	SourceFile string
+	Source     string
+	// OutputFile is where the generated code will be written.
+	OutputFile string
+	// SourceMap asks backends implementing SourceMapper to reference a map
+	// written next to OutputFile ("file") or to embed it ("inline").
+	SourceMap string
+	// Mode selects a variant of the output for targets that have several,
+	// like the JavaScript modes of codegen.ParseMode. Empty means the default.
+	Mode string
+	// Strict and Minify ask targets supporting them for strict mode code and
+	// for compact output without whitespace or comments.
+	Strict bool
+	Minify bool
+	// Analyzer holds the semantic information gathered about the program.
+	Analyzer *semantic.SemanticAnalyzer
+}
+
+// Backend generates code for one target from a program that passed
+// semantic analysis.
+type Backend interface {
+	Name() string
+	Generate(program *ast.Program, options Options) ([]byte, error)
+	FileExtension() string
+}
+
+// SourceMapper is implemented by backends that can map the output of their
+// last Generate call back to the .tb source.
+type SourceMapper interface {
+	SourceMap(options Options) ([]byte, error)
+}
+
+// Runner is implemented by backends that know how to execute their output
+// with the local toolchain. file is the path of the generated code.
+type Runner interface {
+	Run(ctx context.Context, file string) ([]byte, error)
+}
+
+var registry = map[string]func() Backend{}
+
+// Register makes a backend available under its target name. It is meant to
+// be called from the init function of the backend's package.
+func Register(name string, factory func() Backend) {
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("backend '%s' is already registered", name))
+	}
+	registry[name] = factory
+}
+
+// Lookup returns a new instance of the backend registered for target.
+func Lookup(target string) (Backend, error) {
+	factory, found := registry[target]
+	if !found {
+		return nil, fmt.Errorf("unknown target '%s', available targets: %v", target, Names())
+	}
+	return factory(), nil
+}
+
+// Names returns the registered targets in alphabetical order.
+func Names() []string {
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,344 @@
+package c
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/semantic"
+)
+
+func init() {
+	backend.Register("c", func() backend.Backend { return &Backend{} })
+}
+
+// reservedNames are C keywords and the library names the generated main
+// function refers to, which a local variable must not shadow.
+var reservedNames = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true,
+	"enum": true, "extern": true, "float": true, "for": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true,
+	"volatile": true, "while": true, "bool": true, "true": true, "false": true,
+	"main": true, "exit": true, "strcmp": true, "NULL": true, "EOF": true,
+	"stdin": true, "stdout": true, "stderr": true, "errno": true,
+}
+
+// Backend generates a self-contained C99 program.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "c"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".c"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) (code []byte, err error) {
+	defer ast.Recover(&err)
+
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{types: types, indentationLevel: 1}
+	for _, stmt := range program.Statements {
+		if err := g.generateStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("/* Generated by tiny-basic from " + options.SourceFile + " */\n")
+	out.WriteString("#include <inttypes.h>\n#include <math.h>\n#include <stdbool.h>\n#include <stdint.h>\n#include <stdio.h>\n#include <stdlib.h>\n#include <string.h>\n\n")
+	out.WriteString(runtime)
+	if g.usesData {
+		out.WriteString("\n" + g.generateDataPool(semantic.CollectData(program)))
+		out.WriteString("\n" + dataRuntime)
+	}
+
+	out.WriteString("\nint main(void) {\n")
+	for _, name := range types.Variables() {
+		out.WriteString(fmt.Sprintf("\t%s %s = %s;\n", cType(types.Variable(name)), backend.Identifier(name, reservedNames), zeroValue(types.Variable(name))))
+	}
+	out.WriteString(g.builder.String())
+	out.WriteString("\treturn 0;\n}\n")
+
+	return []byte(out.String()), nil
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	executable := strings.TrimSuffix(file, ".c")
+	if _, err := backend.Execute(ctx, "cc", "-std=c99", "-o", executable, file, "-lm"); err != nil {
+		return nil, err
+	}
+	return backend.Execute(ctx, executable)
+}
+
+type generator struct {
+	builder          strings.Builder
+	indentationLevel int
+	types            *semantic.Types
+	usesData         bool
+}
+
+func (g *generator) emit(code string) {
+	g.builder.WriteString(strings.Repeat("\t", g.indentationLevel) + code + "\n")
+}
+
+func (g *generator) generateStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return g.generatePrintStatement(stmt)
+	case *ast.LetStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return g.generateIfStatement(stmt)
+	case *ast.WhileStatement:
+		return g.generateWhileStatement(stmt)
+	case *ast.EndStatement:
+		g.emit("exit(0);")
+	case *ast.CommentStatement:
+		g.emit("//" + stmt.Text)
+	case *ast.DataStatement:
+		g.usesData = true
+		g.emit("// DATA " + g.joinExpressions(stmt.Values))
+	case *ast.ReadStatement:
+		g.usesData = true
+		for _, identifier := range stmt.Identifiers {
+			g.emit(fmt.Sprintf("%s = tb_read(%s).%s;", backend.Identifier(identifier.Name, reservedNames), valueTag(g.types.Variable(identifier.Name)), valueField(g.types.Variable(identifier.Name))))
+		}
+	case *ast.RestoreStatement:
+		g.usesData = true
+		g.emit("tb_data_pointer = 0;")
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (g *generator) generatePrintStatement(stmt *ast.PrintStatement) error {
+	switch g.types.Of(stmt.Expression) {
+	case semantic.Integer:
+		g.emit("tb_print_integer(" + g.generateExpression(stmt.Expression, false) + ");")
+	case semantic.Float:
+		g.emit("tb_print_float(" + g.generateExpression(stmt.Expression, false) + ");")
+	case semantic.String:
+		g.emit("tb_print_string(" + g.generateExpression(stmt.Expression, false) + ");")
+	case semantic.Boolean:
+		g.emit("tb_print_boolean(" + g.generateExpression(stmt.Expression, false) + ");")
+	default:
+		return fmt.Errorf("cannot print expression of unknown type")
+	}
+	return nil
+}
+
+func (g *generator) emitAssignment(name string, value ast.Expression) {
+	g.emit(fmt.Sprintf("%s = %s;", backend.Identifier(name, reservedNames), g.generateExpression(value, false)))
+}
+
+func (g *generator) generateIfStatement(stmt *ast.IfStatement) error {
+	g.emit(fmt.Sprintf("if (%s) {", g.generateExpression(stmt.Condition, false)))
+	if err := g.generateBlock(stmt.ThenBranch); err != nil {
+		return err
+	}
+
+	if stmt.ElseBranch != nil {
+		g.emit("} else {")
+		if err := g.generateBlock(stmt.ElseBranch); err != nil {
+			return err
+		}
+	}
+
+	g.emit("}")
+	return nil
+}
+
+func (g *generator) generateWhileStatement(stmt *ast.WhileStatement) error {
+	g.emit(fmt.Sprintf("while (%s) {", g.generateExpression(stmt.Condition, false)))
+	if err := g.generateBlock(stmt.DoBranch...); err != nil {
+		return err
+	}
+	g.emit("}")
+	return nil
+}
+
+func (g *generator) generateBlock(statements ...ast.Statement) error {
+	g.indentationLevel++
+	defer func() { g.indentationLevel-- }()
+
+	for _, statement := range statements {
+		if err := g.generateStatement(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateDataPool emits the DATA values as a static table of tagged values.
+func (g *generator) generateDataPool(pool []ast.Expression) string {
+	var out strings.Builder
+	out.WriteString("enum { TB_INTEGER, TB_FLOAT, TB_STRING };\n\n")
+	out.WriteString("typedef struct {\n\tint type;\n\tint64_t integer;\n\tdouble number;\n\tconst char *string;\n} tb_value;\n\n")
+
+	out.WriteString("static const tb_value tb_data[] = {\n")
+	for _, value := range pool {
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			out.WriteString(fmt.Sprintf("\t{TB_INTEGER, %s, 0, NULL},\n", integerLiteral(value.Value)))
+		case *ast.FloatLiteral:
+			out.WriteString(fmt.Sprintf("\t{TB_FLOAT, 0, %s, NULL},\n", backend.FloatLiteral(value.Value)))
+		case *ast.StringLiteral:
+			out.WriteString(fmt.Sprintf("\t{TB_STRING, 0, 0, %s},\n", cString(value.Value)))
+		default:
+			panic(&ast.UnsupportedError{Node: value})
+		}
+	}
+	if len(pool) == 0 {
+		// C does not allow empty arrays, tb_data_size keeps the placeholder unreachable
+		out.WriteString("\t{TB_INTEGER, 0, 0, NULL},\n")
+	}
+	out.WriteString("};\n")
+	out.WriteString(fmt.Sprintf("static const size_t tb_data_size = %d;\n", len(pool)))
+
+	return out.String()
+}
+
+func (g *generator) joinExpressions(expressions []ast.Expression) string {
+	values := []string{}
+	for _, expression := range expressions {
+		values = append(values, g.generateExpression(expression, false))
+	}
+	return strings.Join(values, ", ")
+}
+
+func (g *generator) generateExpression(expr ast.Expression, addParentheses bool) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return backend.Identifier(expr.Name, reservedNames)
+	case *ast.IntegerLiteral:
+		return integerLiteral(expr.Value)
+	case *ast.FloatLiteral:
+		return backend.FloatLiteral(expr.Value)
+	case *ast.StringLiteral:
+		return cString(expr.Value)
+	case *ast.BinaryExpression:
+		left := g.generateExpression(expr.Left, true)
+		right := g.generateExpression(expr.Right, true)
+
+		if g.types.Of(expr.Left) == semantic.String {
+			if expr.Operator == "+" {
+				return fmt.Sprintf("tb_concat(%s, %s)", left, right)
+			}
+			return parenthesize(fmt.Sprintf("strcmp(%s, %s) %s 0", left, right, expr.Operator), addParentheses)
+		}
+		if g.types.Of(expr) == semantic.Integer {
+			return fmt.Sprintf("%s(%s, %s)", integerOperations[expr.Operator], left, right)
+		}
+		return parenthesize(fmt.Sprintf("%s %s %s", left, expr.Operator, right), addParentheses)
+	default:
+		panic(&ast.UnsupportedError{Node: expr})
+	}
+}
+
+// integerOperations are the runtime functions computing integer operations,
+// which wrap around on overflow.
+var integerOperations = map[string]string{
+	"+": "tb_add",
+	"-": "tb_subtract",
+	"*": "tb_multiply",
+	"/": "tb_divide",
+}
+
+// integerLiteral writes an integer for C, where the smallest one has no
+// literal: 9223372036854775808 does not fit before it is negated.
+func integerLiteral(value int) string {
+	if value == math.MinInt64 {
+		return "INT64_MIN"
+	}
+	return strconv.Itoa(value)
+}
+
+func parenthesize(code string, addParentheses bool) string {
+	if addParentheses {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// cString quotes a string for C. Control characters use octal escapes, which
+// unlike hexadecimal ones cannot swallow the characters that follow them.
+func cString(value string) string {
+	var out strings.Builder
+	out.WriteString("\"")
+	for _, b := range []byte(value) {
+		switch {
+		case b == '"' || b == '\\':
+			out.WriteString("\\" + string(b))
+		case b < 0x20 || b == 0x7f:
+			out.WriteString(fmt.Sprintf("\\%03o", b))
+		default:
+			out.WriteByte(b)
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
+func cType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "double"
+	case semantic.String:
+		return "const char *"
+	case semantic.Boolean:
+		return "bool"
+	default:
+		return "int64_t"
+	}
+}
+
+func zeroValue(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "0.0"
+	case semantic.String:
+		return "\"\""
+	case semantic.Boolean:
+		return "false"
+	default:
+		return "0"
+	}
+}
+
+func valueTag(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "TB_FLOAT"
+	case semantic.String:
+		return "TB_STRING"
+	default:
+		return "TB_INTEGER"
+	}
+}
+
+func valueField(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "number"
+	case semantic.String:
+		return "string"
+	default:
+		return "integer"
+	}
+}
@@ -0,0 +1,146 @@
+package c
+
+// runtime is included in every generated program. Numbers are printed the
+// way the JavaScript backend prints them, so all targets produce the same
+// output for the same program.
+const runtime = `static inline void tb_print_integer(int64_t value) {
+	printf("%" PRId64 "\n", value);
+}
+
+/* Prints a double like JavaScript's Number.prototype.toString */
+static inline void tb_print_float(double value) {
+	char buffer[32];
+	char digits[32];
+	int precision, exponent, count, i;
+	char *p;
+
+	if (isnan(value)) {
+		puts("NaN");
+		return;
+	}
+	if (isinf(value)) {
+		puts(value < 0 ? "-Infinity" : "Infinity");
+		return;
+	}
+	if (value == 0) {
+		puts("0");
+		return;
+	}
+	if (value < 0) {
+		putchar('-');
+		value = -value;
+	}
+
+	/* Find the shortest digits that read back as the same value */
+	for (precision = 1; precision < 17; precision++) {
+		snprintf(buffer, sizeof buffer, "%.*e", precision - 1, value);
+		if (strtod(buffer, NULL) == value) {
+			break;
+		}
+	}
+	snprintf(buffer, sizeof buffer, "%.*e", precision - 1, value);
+
+	count = 0;
+	for (p = buffer; *p != 'e'; p++) {
+		if (*p != '.') {
+			digits[count++] = *p;
+		}
+	}
+	digits[count] = '\0';
+	exponent = atoi(p + 1) + 1;
+
+	if (count <= exponent && exponent <= 21) {
+		printf("%s", digits);
+		for (i = count; i < exponent; i++) {
+			putchar('0');
+		}
+	} else if (0 < exponent && exponent <= 21) {
+		printf("%.*s.%s", exponent, digits, digits + exponent);
+	} else if (-6 < exponent && exponent <= 0) {
+		printf("0.");
+		for (i = 0; i < -exponent; i++) {
+			putchar('0');
+		}
+		printf("%s", digits);
+	} else {
+		putchar(digits[0]);
+		if (count > 1) {
+			printf(".%s", digits + 1);
+		}
+		printf("e%c%d", exponent > 0 ? '+' : '-', abs(exponent - 1));
+	}
+	putchar('\n');
+}
+
+static inline void tb_print_string(const char *value) {
+	puts(value);
+}
+
+static inline void tb_print_boolean(bool value) {
+	puts(value ? "true" : "false");
+}
+
+static inline void tb_fail(const char *message) {
+	fprintf(stderr, "%s\n", message);
+	exit(1);
+}
+
+/* Signed overflow is undefined in C, so integers are added, subtracted and
+   multiplied as unsigned values, which wrap around */
+static inline int64_t tb_add(int64_t left, int64_t right) {
+	return (int64_t)((uint64_t)left + (uint64_t)right);
+}
+
+static inline int64_t tb_subtract(int64_t left, int64_t right) {
+	return (int64_t)((uint64_t)left - (uint64_t)right);
+}
+
+static inline int64_t tb_multiply(int64_t left, int64_t right) {
+	return (int64_t)((uint64_t)left * (uint64_t)right);
+}
+
+/* Integer division truncates toward zero, like C99 itself. INT64_MIN / -1
+   overflows and traps on most machines, so -1 negates with wrapping */
+static inline int64_t tb_divide(int64_t left, int64_t right) {
+	if (right == 0) {
+		tb_fail("division by zero");
+	}
+	if (right == -1) {
+		return tb_subtract(0, left);
+	}
+	return left / right;
+}
+
+static inline const char *tb_concat(const char *left, const char *right) {
+	char *result = malloc(strlen(left) + strlen(right) + 1);
+	if (result == NULL) {
+		tb_fail("out of memory");
+	}
+	strcpy(result, left);
+	strcat(result, right);
+	return result;
+}
+`
+
+// dataRuntime is included when the program uses DATA, READ or RESTORE. The
+// generator emits tb_data and tb_data_size before it.
+const dataRuntime = `static size_t tb_data_pointer = 0;
+
+static inline tb_value tb_read(int type) {
+	tb_value value;
+
+	if (tb_data_pointer >= tb_data_size) {
+		tb_fail("out of data");
+	}
+	value = tb_data[tb_data_pointer++];
+
+	if (type == TB_FLOAT && value.type == TB_INTEGER) {
+		value.type = TB_FLOAT;
+		value.number = (double)value.integer;
+	}
+	if (value.type != type) {
+		tb_fail("type mismatch in READ");
+	}
+	return value;
+}
+`
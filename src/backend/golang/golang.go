@@ -0,0 +1,326 @@
+package golang
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/semantic"
+)
+
+func init() {
+	backend.Register("go", func() backend.Backend { return &Backend{} })
+}
+
+// reservedNames are Go keywords, predeclared identifiers and the packages
+// the generated program imports, which a local variable must not shadow.
+var reservedNames = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true,
+	"for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true,
+	"switch": true, "type": true, "var": true,
+
+	"any": true, "bool": true, "byte": true, "comparable": true,
+	"complex64": true, "complex128": true, "error": true, "float32": true,
+	"float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true, "append": true,
+	"cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true,
+	"min": true, "new": true, "panic": true, "print": true, "println": true,
+	"real": true, "recover": true,
+
+	"main": true, "fmt": true, "math": true, "os": true, "strconv": true,
+	"strings": true,
+}
+
+// Backend generates a Go program that builds with the Go toolchain alone.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "go"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".go"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) (code []byte, err error) {
+	defer ast.Recover(&err)
+
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{types: types, indentationLevel: 1}
+	for _, stmt := range program.Statements {
+		if err := g.generateStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("// Code generated by tiny-basic from " + options.SourceFile + ". DO NOT EDIT.\n\n")
+	out.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"math\"\n\t\"os\"\n\t\"strconv\"\n\t\"strings\"\n)\n\n")
+
+	out.WriteString("func main() {\n")
+	for _, name := range types.Variables() {
+		out.WriteString(fmt.Sprintf("\tvar %s %s\n", backend.Identifier(name, reservedNames), goType(types.Variable(name))))
+	}
+	// Go rejects variables that are never read, which BASIC allows
+	for _, name := range unusedVariables(options, types) {
+		out.WriteString(fmt.Sprintf("\t_ = %s\n", backend.Identifier(name, reservedNames)))
+	}
+	if len(types.Variables()) > 0 {
+		out.WriteString("\n")
+	}
+	out.WriteString(g.builder.String())
+	out.WriteString("}\n")
+
+	out.WriteString(runtime)
+	if g.usesData {
+		out.WriteString("\n" + g.generateDataPool(semantic.CollectData(program)))
+		out.WriteString(dataRuntime)
+	}
+
+	return []byte(out.String()), nil
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	executable := strings.TrimSuffix(file, ".go")
+	if _, err := backend.Execute(ctx, "go", "build", "-o", executable, file); err != nil {
+		return nil, err
+	}
+	return backend.Execute(ctx, executable)
+}
+
+// unusedVariables returns the variables semantic analysis found unused. When
+// the program was not analyzed every variable is treated as unused.
+func unusedVariables(options backend.Options, types *semantic.Types) []string {
+	if options.Analyzer == nil {
+		return types.Variables()
+	}
+	return options.Analyzer.UnusedVariables()
+}
+
+type generator struct {
+	builder          strings.Builder
+	indentationLevel int
+	types            *semantic.Types
+	usesData         bool
+}
+
+func (g *generator) emit(code string) {
+	g.builder.WriteString(strings.Repeat("\t", g.indentationLevel) + code + "\n")
+}
+
+func (g *generator) generateStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return g.generatePrintStatement(stmt)
+	case *ast.LetStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return g.generateIfStatement(stmt)
+	case *ast.WhileStatement:
+		return g.generateWhileStatement(stmt)
+	case *ast.EndStatement:
+		g.emit("os.Exit(0)")
+	case *ast.CommentStatement:
+		g.emit("//" + stmt.Text)
+	case *ast.DataStatement:
+		g.usesData = true
+		g.emit("// DATA " + g.joinExpressions(stmt.Values))
+	case *ast.ReadStatement:
+		g.usesData = true
+		for _, identifier := range stmt.Identifiers {
+			g.emit(fmt.Sprintf("%s = tb_read%s()", backend.Identifier(identifier.Name, reservedNames), g.types.Variable(identifier.Name)))
+		}
+	case *ast.RestoreStatement:
+		g.usesData = true
+		g.emit("tb_dataPointer = 0")
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (g *generator) generatePrintStatement(stmt *ast.PrintStatement) error {
+	switch g.types.Of(stmt.Expression) {
+	case semantic.Float:
+		g.emit("fmt.Println(tb_formatFloat(" + g.generateExpression(stmt.Expression, false) + "))")
+	case semantic.Integer, semantic.String, semantic.Boolean:
+		g.emit("fmt.Println(" + g.generateExpression(stmt.Expression, false) + ")")
+	default:
+		return fmt.Errorf("cannot print expression of unknown type")
+	}
+	return nil
+}
+
+func (g *generator) emitAssignment(name string, value ast.Expression) {
+	g.emit(fmt.Sprintf("%s = %s", backend.Identifier(name, reservedNames), g.generateValue(value, g.types.Variable(name), false)))
+}
+
+func (g *generator) generateIfStatement(stmt *ast.IfStatement) error {
+	g.emit(fmt.Sprintf("if %s {", g.generateExpression(stmt.Condition, false)))
+	if err := g.generateBlock(stmt.ThenBranch); err != nil {
+		return err
+	}
+
+	if stmt.ElseBranch != nil {
+		g.emit("} else {")
+		if err := g.generateBlock(stmt.ElseBranch); err != nil {
+			return err
+		}
+	}
+
+	g.emit("}")
+	return nil
+}
+
+func (g *generator) generateWhileStatement(stmt *ast.WhileStatement) error {
+	g.emit(fmt.Sprintf("for %s {", g.generateExpression(stmt.Condition, false)))
+	if err := g.generateBlock(stmt.DoBranch...); err != nil {
+		return err
+	}
+	g.emit("}")
+	return nil
+}
+
+func (g *generator) generateBlock(statements ...ast.Statement) error {
+	g.indentationLevel++
+	defer func() { g.indentationLevel-- }()
+
+	for _, statement := range statements {
+		if err := g.generateStatement(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateDataPool emits the DATA values as a slice of dynamically typed
+// values; the typed read helpers check them against the target variable.
+func (g *generator) generateDataPool(pool []ast.Expression) string {
+	var out strings.Builder
+	out.WriteString("var tb_data = []any{\n")
+	for _, value := range pool {
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			out.WriteString(fmt.Sprintf("\tint64(%d),\n", value.Value))
+		case *ast.FloatLiteral:
+			out.WriteString(fmt.Sprintf("\t%s,\n", backend.FloatLiteral(value.Value)))
+		case *ast.StringLiteral:
+			out.WriteString(fmt.Sprintf("\t%s,\n", strconv.Quote(value.Value)))
+		default:
+			panic(&ast.UnsupportedError{Node: value})
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func (g *generator) joinExpressions(expressions []ast.Expression) string {
+	values := []string{}
+	for _, expression := range expressions {
+		values = append(values, g.generateExpression(expression, false))
+	}
+	return strings.Join(values, ", ")
+}
+
+// generateValue generates an expression used where a value of type want is
+// expected. Go never mixes integers and floats implicitly.
+func (g *generator) generateValue(expr ast.Expression, want semantic.Type, addParentheses bool) string {
+	if want == semantic.Float && g.types.Of(expr) == semantic.Integer {
+		return "float64(" + g.generateExpression(expr, false) + ")"
+	}
+	return g.generateExpression(expr, addParentheses)
+}
+
+func (g *generator) generateExpression(expr ast.Expression, addParentheses bool) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return backend.Identifier(expr.Name, reservedNames)
+	case *ast.IntegerLiteral:
+		return strconv.Itoa(expr.Value)
+	case *ast.FloatLiteral:
+		return backend.FloatLiteral(expr.Value)
+	case *ast.StringLiteral:
+		return strconv.Quote(expr.Value)
+	case *ast.BinaryExpression:
+		operands := g.types.Of(expr.Left)
+		if g.types.Of(expr.Right) == semantic.Float {
+			operands = semantic.Float
+		}
+		left := g.generateValue(expr.Left, operands, true)
+		right := g.generateValue(expr.Right, operands, true)
+
+		// Go evaluates constant expressions exactly and rejects integer
+		// constants that overflow, while at run time it rounds every float
+		// operation and wraps int64 results around, which is what
+		// overflow.tb in the conformance suite expects, so constant
+		// operations are moved to run time
+		if isLiteral(expr.Left) && isConstant(expr.Right) {
+			switch operands {
+			case semantic.Float:
+				left = "tb_float(" + left + ")"
+			case semantic.Integer:
+				if isArithmetic(expr.Operator) {
+					left = "tb_int(" + left + ")"
+				}
+			}
+		}
+
+		if expr.Operator == "/" && g.types.Of(expr) == semantic.Integer {
+			return fmt.Sprintf("tb_divide(%s, %s)", left, right)
+		}
+		if addParentheses {
+			return fmt.Sprintf("(%s %s %s)", left, expr.Operator, right)
+		}
+		return fmt.Sprintf("%s %s %s", left, expr.Operator, right)
+	default:
+		panic(&ast.UnsupportedError{Node: expr})
+	}
+}
+
+// isArithmetic reports whether an integer operator may overflow. Division
+// goes through tb_divide, which already takes run time values.
+func isArithmetic(operator string) bool {
+	return operator == "+" || operator == "-" || operator == "*"
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return true
+	}
+	return false
+}
+
+func isConstant(expr ast.Expression) bool {
+	if binary, ok := expr.(*ast.BinaryExpression); ok {
+		return isConstant(binary.Left) && isConstant(binary.Right)
+	}
+	return isLiteral(expr)
+}
+
+func goType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "float64"
+	case semantic.String:
+		return "string"
+	case semantic.Boolean:
+		return "bool"
+	default:
+		return "int64"
+	}
+}
@@ -0,0 +1,115 @@
+package golang
+
+// runtime is appended to every generated program. Numbers are printed the
+// way the JavaScript backend prints them, so all targets produce the same
+// output for the same program.
+const runtime = `
+func tb_fail(message string) {
+	fmt.Fprintln(os.Stderr, message)
+	os.Exit(1)
+}
+
+// tb_divide truncates toward zero, like Go's own integer division
+func tb_divide(left int64, right int64) int64 {
+	if right == 0 {
+		tb_fail("division by zero")
+	}
+	return left / right
+}
+
+// tb_float turns a constant into a run time value, so operations on it are
+// rounded like in the other targets instead of being computed exactly
+func tb_float(value float64) float64 {
+	return value
+}
+
+// tb_int turns a constant into a run time value, so an operation on it that
+// leaves int64 wraps around at run time instead of failing to compile
+func tb_int(value int64) int64 {
+	return value
+}
+
+// tb_formatFloat formats a float like JavaScript's Number.prototype.toString
+func tb_formatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "Infinity"
+	case math.IsInf(value, -1):
+		return "-Infinity"
+	case value == 0:
+		return "0"
+	}
+
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	mantissa, exponentText, _ := strings.Cut(strconv.FormatFloat(value, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	exponent, _ := strconv.Atoi(exponentText)
+	exponent++
+
+	switch {
+	case len(digits) <= exponent && exponent <= 21:
+		return sign + digits + strings.Repeat("0", exponent-len(digits))
+	case 0 < exponent && exponent <= 21:
+		return sign + digits[:exponent] + "." + digits[exponent:]
+	case -6 < exponent && exponent <= 0:
+		return sign + "0." + strings.Repeat("0", -exponent) + digits
+	}
+
+	result := sign + digits[:1]
+	if len(digits) > 1 {
+		result += "." + digits[1:]
+	}
+	if exponent > 0 {
+		return result + "e+" + strconv.Itoa(exponent-1)
+	}
+	return result + "e-" + strconv.Itoa(1-exponent)
+}
+`
+
+// dataRuntime is appended when the program uses DATA, READ or RESTORE. The
+// generator emits the tb_data pool before it.
+const dataRuntime = `
+var tb_dataPointer = 0
+
+func tb_read() any {
+	if tb_dataPointer >= len(tb_data) {
+		tb_fail("out of data")
+	}
+	tb_dataPointer++
+	return tb_data[tb_dataPointer-1]
+}
+
+func tb_readInteger() int64 {
+	value, ok := tb_read().(int64)
+	if !ok {
+		tb_fail("type mismatch in READ")
+	}
+	return value
+}
+
+func tb_readFloat() float64 {
+	switch value := tb_read().(type) {
+	case int64:
+		return float64(value)
+	case float64:
+		return value
+	}
+	tb_fail("type mismatch in READ")
+	return 0
+}
+
+func tb_readString() string {
+	value, ok := tb_read().(string)
+	if !ok {
+		tb_fail("type mismatch in READ")
+	}
+	return value
+}
+`
@@ -0,0 +1,65 @@
+package js
+
+import (
+	"context"
+	"path/filepath"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/codegen"
+)
+
+func init() {
+	backend.Register("js", func() backend.Backend { return &Backend{} })
+}
+
+// Backend generates JavaScript with codegen.CodeGenerator, as a Node.js
+// script unless Options.Mode asks for an ES module or a browser bundle.
+type Backend struct {
+	generator *codegen.CodeGenerator
+}
+
+func (b *Backend) Name() string {
+	return "js"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".js"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) ([]byte, error) {
+	mode, err := codegen.ParseMode(options.Mode)
+	if err != nil {
+		return nil, err
+	}
+	b.generator = codegen.NewCodeGeneratorWithOptions(codegen.Options{
+		Mode:       mode,
+		SourceFile: filepath.Base(options.SourceFile),
+		Strict:     options.Strict,
+		Minify:     options.Minify,
+	})
+	code, err := b.generator.Generate(program)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.SourceMap {
+	case "file":
+		code += "//# sourceMappingURL=" + filepath.Base(options.OutputFile) + ".map\n"
+	case "inline":
+		sourceMap, err := b.SourceMap(options)
+		if err != nil {
+			return nil, err
+		}
+		code += codegen.InlineSourceMap(sourceMap) + "\n"
+	}
+
+	return []byte(code), nil
+}
+
+func (b *Backend) SourceMap(options backend.Options) ([]byte, error) {
+	return b.generator.SourceMap(filepath.Base(options.OutputFile), options.SourceFile, options.Source)
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	return backend.Execute(ctx, "node", file)
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/semantic"
+)
+
+// Identifier turns a BASIC variable name into an identifier for targets that
+// only accept letters, digits and underscores. Names made of letters and
+// digits are kept as they are unless reserved is true for them. Any other name
+// gets a "v_" prefix, with '_' escaped as "__" and the '$' and '%' type
+// suffixes spelled "_s" and "_i". Kept names never contain '_', so the two
+// forms cannot collide, and runtime helpers avoid collisions by containing
+// '_' without starting with "v_".
+func Identifier(name string, reserved map[string]bool) string {
+	plain := true
+	for _, ch := range name {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			plain = false
+		}
+	}
+	if plain && !reserved[name] {
+		return name
+	}
+
+	replacer := strings.NewReplacer("_", "__", "$", "_s", "%", "_i")
+	return "v_" + replacer.Replace(name)
+}
+
+// FloatLiteral formats a float so that C-like targets never read it as an
+// integer constant.
+func FloatLiteral(value float64) string {
+	literal := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(literal, ".eIN") {
+		literal += ".0"
+	}
+	return literal
+}
+
+// Types returns the types inferred during semantic analysis, or infers them
+// when the caller did not run the analyzer.
+func (o Options) Types(program *ast.Program) (*semantic.Types, error) {
+	if o.Analyzer != nil && o.Analyzer.Types() != nil {
+		return o.Analyzer.Types(), nil
+	}
+	return semantic.InferTypes(program)
+}
@@ -0,0 +1,262 @@
+package python
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/semantic"
+)
+
+func init() {
+	backend.Register("python", func() backend.Backend { return &Backend{} })
+}
+
+// reservedNames are Python keywords, the builtins and modules the generated
+// program refers to, and main, which a variable must not shadow.
+var reservedNames = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true,
+	"assert": true, "async": true, "await": true, "break": true,
+	"class": true, "continue": true, "def": true, "del": true, "elif": true,
+	"else": true, "except": true, "finally": true, "for": true, "from": true,
+	"global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true,
+	"raise": true, "return": true, "try": true, "while": true, "with": true,
+	"yield": true, "match": true, "case": true, "type": true,
+
+	"abs": true, "float": true, "int": true, "len": true, "print": true,
+	"repr": true, "str": true, "math": true, "sys": true, "main": true,
+}
+
+// Backend generates a Python 3 module whose program runs in a main function,
+// called when the module is run as a script.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "python"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".py"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) (code []byte, err error) {
+	defer ast.Recover(&err)
+
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{types: types, indentationLevel: 1}
+	for _, stmt := range program.Statements {
+		if err := g.generateStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("# Generated by tiny-basic from " + options.SourceFile + "\n\n")
+	out.WriteString("import math\nimport sys\n\n\n")
+	out.WriteString(runtime)
+	if g.usesData {
+		out.WriteString("\n\n" + g.generateDataPool(semantic.CollectData(program)))
+		out.WriteString(dataRuntime)
+	}
+
+	out.WriteString("\n\ndef main():\n")
+	for _, name := range types.Variables() {
+		out.WriteString(fmt.Sprintf("    %s = %s\n", backend.Identifier(name, reservedNames), zeroValue(types.Variable(name))))
+	}
+	out.WriteString(g.builder.String())
+	if len(types.Variables()) == 0 && g.builder.Len() == 0 {
+		out.WriteString("    pass\n")
+	}
+	out.WriteString("\n\nif __name__ == \"__main__\":\n    main()\n")
+
+	return []byte(out.String()), nil
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	return backend.Execute(ctx, "python3", file)
+}
+
+type generator struct {
+	builder          strings.Builder
+	indentationLevel int
+	types            *semantic.Types
+	usesData         bool
+}
+
+func (g *generator) emit(code string) {
+	g.builder.WriteString(strings.Repeat("    ", g.indentationLevel) + code + "\n")
+}
+
+func (g *generator) generateStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return g.generatePrintStatement(stmt)
+	case *ast.LetStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		g.emitAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return g.generateIfStatement(stmt)
+	case *ast.WhileStatement:
+		return g.generateWhileStatement(stmt)
+	case *ast.EndStatement:
+		g.emit("sys.exit(0)")
+	case *ast.CommentStatement:
+		g.emit("#" + stmt.Text)
+	case *ast.DataStatement:
+		g.usesData = true
+		g.emit("# DATA " + g.joinExpressions(stmt.Values))
+	case *ast.ReadStatement:
+		g.usesData = true
+		for _, identifier := range stmt.Identifiers {
+			g.emit(fmt.Sprintf("%s = tb_read(%s)", backend.Identifier(identifier.Name, reservedNames), pythonType(g.types.Variable(identifier.Name))))
+		}
+	case *ast.RestoreStatement:
+		g.usesData = true
+		g.emit("tb_restore()")
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (g *generator) generatePrintStatement(stmt *ast.PrintStatement) error {
+	value := g.generateExpression(stmt.Expression, false)
+	switch g.types.Of(stmt.Expression) {
+	case semantic.Integer, semantic.String:
+		g.emit("print(" + value + ")")
+	case semantic.Float:
+		g.emit("print(tb_format_float(" + value + "))")
+	case semantic.Boolean:
+		g.emit(fmt.Sprintf("print(\"true\" if %s else \"false\")", value))
+	default:
+		return fmt.Errorf("cannot print expression of unknown type")
+	}
+	return nil
+}
+
+func (g *generator) emitAssignment(name string, value ast.Expression) {
+	g.emit(fmt.Sprintf("%s = %s", backend.Identifier(name, reservedNames), g.generateExpression(value, false)))
+}
+
+func (g *generator) generateIfStatement(stmt *ast.IfStatement) error {
+	g.emit(fmt.Sprintf("if %s:", g.generateExpression(stmt.Condition, false)))
+	if err := g.generateBlock(stmt.ThenBranch); err != nil {
+		return err
+	}
+
+	if stmt.ElseBranch != nil {
+		g.emit("else:")
+		if err := g.generateBlock(stmt.ElseBranch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) generateWhileStatement(stmt *ast.WhileStatement) error {
+	g.emit(fmt.Sprintf("while %s:", g.generateExpression(stmt.Condition, false)))
+	return g.generateBlock(stmt.DoBranch...)
+}
+
+// generateBlock emits an indented block. Python needs a statement in every
+// block, so blocks made only of comments, or of nothing, get a pass.
+func (g *generator) generateBlock(statements ...ast.Statement) error {
+	g.indentationLevel++
+	defer func() { g.indentationLevel-- }()
+
+	empty := true
+	for _, statement := range statements {
+		if err := g.generateStatement(statement); err != nil {
+			return err
+		}
+		switch statement.(type) {
+		case *ast.CommentStatement, *ast.DataStatement:
+		default:
+			empty = false
+		}
+	}
+	if empty {
+		g.emit("pass")
+	}
+	return nil
+}
+
+// generateDataPool emits the DATA values as a list; tb_read checks them
+// against the type of the variable they are read into.
+func (g *generator) generateDataPool(pool []ast.Expression) string {
+	return "tb_data = [" + g.joinExpressions(pool) + "]\n"
+}
+
+func (g *generator) joinExpressions(expressions []ast.Expression) string {
+	values := []string{}
+	for _, expression := range expressions {
+		values = append(values, g.generateExpression(expression, false))
+	}
+	return strings.Join(values, ", ")
+}
+
+func (g *generator) generateExpression(expr ast.Expression, addParentheses bool) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return backend.Identifier(expr.Name, reservedNames)
+	case *ast.IntegerLiteral:
+		return strconv.Itoa(expr.Value)
+	case *ast.FloatLiteral:
+		return backend.FloatLiteral(expr.Value)
+	case *ast.StringLiteral:
+		return strconv.Quote(expr.Value)
+	case *ast.BinaryExpression:
+		left := g.generateExpression(expr.Left, true)
+		right := g.generateExpression(expr.Right, true)
+
+		switch g.types.Of(expr) {
+		case semantic.Integer:
+			if expr.Operator == "/" {
+				return fmt.Sprintf("tb_divide(%s, %s)", left, right)
+			}
+			return fmt.Sprintf("tb_int(%s %s %s)", left, expr.Operator, right)
+		case semantic.Float:
+			if expr.Operator == "/" {
+				return fmt.Sprintf("tb_divide_float(%s, %s)", left, right)
+			}
+		}
+		if addParentheses {
+			return fmt.Sprintf("(%s %s %s)", left, expr.Operator, right)
+		}
+		return fmt.Sprintf("%s %s %s", left, expr.Operator, right)
+	default:
+		panic(&ast.UnsupportedError{Node: expr})
+	}
+}
+
+func pythonType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "float"
+	case semantic.String:
+		return "str"
+	default:
+		return "int"
+	}
+}
+
+func zeroValue(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "0.0"
+	case semantic.String:
+		return "\"\""
+	case semantic.Boolean:
+		return "False"
+	default:
+		return "0"
+	}
+}
@@ -0,0 +1,87 @@
+package python
+
+// runtime is included in every generated program. Numbers are printed the
+// way the JavaScript backend prints them, so all targets produce the same
+// output for the same program.
+const runtime = `def tb_fail(message):
+    print(message, file=sys.stderr)
+    sys.exit(1)
+
+
+def tb_divide(left, right):
+    # Integer division truncates toward zero, while // alone rounds toward
+    # negative infinity
+    if right == 0:
+        tb_fail("division by zero")
+    quotient = abs(left) // abs(right)
+    return tb_int(quotient if (left < 0) == (right < 0) else -quotient)
+
+
+def tb_divide_float(left, right):
+    # Python raises on a zero divisor, where the other targets give an
+    # infinity or NaN
+    if right == 0:
+        if left == 0 or math.isnan(left):
+            return math.nan
+        return math.copysign(math.inf, left) * math.copysign(1.0, right)
+    return left / right
+
+
+def tb_int(value):
+    # Python integers are unbounded, so a result is reduced to the signed
+    # 64-bit range TinyBASIC integers overflow within
+    return (value + 2**63) % 2**64 - 2**63
+
+
+def tb_format_float(value):
+    # Formats a float like JavaScript's Number.prototype.toString
+    value = float(value)
+    if math.isnan(value):
+        return "NaN"
+    if math.isinf(value):
+        return "Infinity" if value > 0 else "-Infinity"
+    if value == 0:
+        return "0"
+
+    sign = "-" if value < 0 else ""
+    mantissa, _, exponent = repr(abs(value)).partition("e")
+    whole, _, fraction = mantissa.partition(".")
+    digits = (whole + fraction).lstrip("0")
+    point = len(whole) + int(exponent or 0) - (len(whole + fraction) - len(digits))
+    digits = digits.rstrip("0")
+
+    if len(digits) <= point <= 21:
+        return sign + digits + "0" * (point - len(digits))
+    if 0 < point <= 21:
+        return sign + digits[:point] + "." + digits[point:]
+    if -6 < point <= 0:
+        return sign + "0." + "0" * -point + digits
+    result = sign + digits[0]
+    if len(digits) > 1:
+        result += "." + digits[1:]
+    return result + "e" + ("+" if point > 0 else "-") + str(abs(point - 1))
+`
+
+// dataRuntime is included when the program uses DATA, READ or RESTORE. The
+// generator emits the tb_data list before it.
+const dataRuntime = `tb_data_pointer = 0
+
+
+def tb_read(kind):
+    global tb_data_pointer
+    if tb_data_pointer >= len(tb_data):
+        tb_fail("out of data")
+    value = tb_data[tb_data_pointer]
+    tb_data_pointer += 1
+
+    if kind is float and type(value) is int:
+        return float(value)
+    if type(value) is not kind:
+        tb_fail("type mismatch in READ")
+    return value
+
+
+def tb_restore():
+    global tb_data_pointer
+    tb_data_pointer = 0
+`
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/bytecode"
+)
+
+func init() {
+	backend.Register("bytecode", func() backend.Backend { return &Backend{} })
+}
+
+// RunLimit is the instruction limit of programs run by the conformance
+// suite, so a broken loop fails instead of hanging.
+const RunLimit = 100_000_000
+
+// Backend compiles programs to the serialized format of package bytecode and
+// runs them in process with its VM.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "bytecode"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".tbc"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) ([]byte, error) {
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := bytecode.Compile(program, types)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.MarshalBinary()
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	program := &bytecode.Program{}
+	if err := program.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	machine := bytecode.NewVM(program, &output)
+	machine.Limit = RunLimit
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
@@ -0,0 +1,267 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// opcodes of the instructions without immediates, and of those whose
+// immediates are encoded by Binary itself.
+var opcodes = map[string][]byte{
+	"unreachable": {0x00},
+	"block":       {0x02, 0x40},
+	"loop":        {0x03, 0x40},
+	"if":          {0x04, 0x40},
+	"else":        {0x05},
+	"end":         {0x0B},
+	"br":          {0x0C},
+	"br_if":       {0x0D},
+	"return":      {0x0F},
+	"call":        {0x10},
+	"drop":        {0x1A},
+
+	"local.get":  {0x20},
+	"local.set":  {0x21},
+	"local.tee":  {0x22},
+	"global.get": {0x23},
+	"global.set": {0x24},
+
+	"i32.load":    {0x28},
+	"i64.load":    {0x29},
+	"f64.load":    {0x2B},
+	"i32.load8_u": {0x2D},
+	"i32.store":   {0x36},
+	"memory.size": {0x3F, 0x00},
+	"memory.grow": {0x40, 0x00},
+	"memory.copy": {0xFC, 0x0A, 0x00, 0x00},
+	"i32.const":   {0x41},
+	"i64.const":   {0x42},
+	"f64.const":   {0x44},
+
+	"i32.eqz":  {0x45},
+	"i32.eq":   {0x46},
+	"i32.ne":   {0x47},
+	"i32.lt_s": {0x48},
+	"i32.gt_s": {0x4A},
+	"i32.gt_u": {0x4B},
+	"i32.ge_u": {0x4F},
+	"i64.eqz":  {0x50},
+	"i64.eq":   {0x51},
+	"i64.lt_s": {0x53},
+	"i64.gt_s": {0x55},
+	"f64.eq":   {0x61},
+	"f64.lt":   {0x63},
+	"f64.gt":   {0x64},
+
+	"i32.add":   {0x6A},
+	"i32.sub":   {0x6B},
+	"i32.mul":   {0x6C},
+	"i32.div_u": {0x6E},
+	"i64.add":   {0x7C},
+	"i64.sub":   {0x7D},
+	"i64.mul":   {0x7E},
+	"i64.div_s": {0x7F},
+	"f64.add":   {0xA0},
+	"f64.sub":   {0xA1},
+	"f64.mul":   {0xA2},
+	"f64.div":   {0xA3},
+
+	"f64.convert_i64_s": {0xB9},
+}
+
+// alignments are the natural alignments (as powers of two) of memory accesses.
+var alignments = map[string]uint64{
+	"i32.load":    2,
+	"i64.load":    3,
+	"f64.load":    3,
+	"i32.load8_u": 0,
+	"i32.store":   2,
+}
+
+// Binary encodes the module in the WebAssembly binary format.
+func (m *module) Binary() ([]byte, error) {
+	out := []byte{0x00, 0x61, 0x73, 0x6D, 0x01, 0x00, 0x00, 0x00}
+
+	// Type section: one entry per distinct signature
+	types := []*function{}
+	typeIndexes := map[string]int{}
+	for _, f := range m.functions {
+		if _, found := typeIndexes[f.signature()]; !found {
+			typeIndexes[f.signature()] = len(types)
+			types = append(types, f)
+		}
+	}
+	section := unsigned(uint64(len(types)))
+	for _, f := range types {
+		section = append(section, 0x60)
+		section = append(section, unsigned(uint64(len(f.params)))...)
+		for _, param := range f.params {
+			section = append(section, byte(param.typ))
+		}
+		section = append(section, unsigned(uint64(len(f.results)))...)
+		for _, result := range f.results {
+			section = append(section, byte(result))
+		}
+	}
+	out = appendSection(out, 1, section)
+
+	// Import section, imports come first in the function index space
+	imports, defined := []byte{}, []byte{}
+	importCount, definedCount := 0, 0
+	for _, f := range m.functions {
+		if f.importName != "" {
+			if definedCount > 0 {
+				return nil, fmt.Errorf("wasm: import $%s follows defined functions", f.name)
+			}
+			imports = append(imports, name("env")...)
+			imports = append(imports, name(f.importName)...)
+			imports = append(imports, 0x00)
+			imports = append(imports, unsigned(uint64(typeIndexes[f.signature()]))...)
+			importCount++
+		} else {
+			defined = append(defined, unsigned(uint64(typeIndexes[f.signature()]))...)
+			definedCount++
+		}
+	}
+	out = appendSection(out, 2, append(unsigned(uint64(importCount)), imports...))
+	out = appendSection(out, 3, append(unsigned(uint64(definedCount)), defined...))
+
+	// Memory section
+	out = appendSection(out, 5, append([]byte{0x01, 0x00}, unsigned(uint64(m.pages()))...))
+
+	// Global section
+	section = unsigned(uint64(len(m.globals)))
+	for _, g := range m.globals {
+		section = append(section, byte(g.typ), 0x01)
+		section = append(section, opcodes[g.typ.String()+".const"]...)
+		section = append(section, signed(g.initial)...)
+		section = append(section, 0x0B)
+	}
+	out = appendSection(out, 6, section)
+
+	// Export section
+	exports := []byte{}
+	exportCount := 1
+	exports = append(exports, name("memory")...)
+	exports = append(exports, 0x02, 0x00)
+	for i, f := range m.functions {
+		if f.exportName != "" {
+			exports = append(exports, name(f.exportName)...)
+			exports = append(exports, 0x00)
+			exports = append(exports, unsigned(uint64(i))...)
+			exportCount++
+		}
+	}
+	out = appendSection(out, 7, append(unsigned(uint64(exportCount)), exports...))
+
+	// Code section
+	section = unsigned(uint64(definedCount))
+	for _, f := range m.functions {
+		if f.importName != "" {
+			continue
+		}
+		code, err := m.encodeFunction(f)
+		if err != nil {
+			return nil, err
+		}
+		section = append(section, unsigned(uint64(len(code)))...)
+		section = append(section, code...)
+	}
+	out = appendSection(out, 10, section)
+
+	// Data section, one active segment at address 0
+	section = []byte{0x01, 0x00}
+	section = append(section, opcodes["i32.const"]...)
+	section = append(section, signed(0)...)
+	section = append(section, 0x0B)
+	section = append(section, unsigned(uint64(len(m.data)))...)
+	section = append(section, m.data...)
+	out = appendSection(out, 11, section)
+
+	return out, nil
+}
+
+func (m *module) encodeFunction(f *function) ([]byte, error) {
+	// Locals are declared as runs of the same type
+	groups := [][2]int{}
+	for _, l := range f.locals {
+		if len(groups) > 0 && groups[len(groups)-1][1] == int(l.typ) {
+			groups[len(groups)-1][0]++
+			continue
+		}
+		groups = append(groups, [2]int{1, int(l.typ)})
+	}
+	code := unsigned(uint64(len(groups)))
+	for _, group := range groups {
+		code = append(code, unsigned(uint64(group[0]))...)
+		code = append(code, byte(group[1]))
+	}
+
+	for _, in := range f.body {
+		if in.op == "comment" {
+			continue
+		}
+		opcode, found := opcodes[in.op]
+		if !found {
+			return nil, fmt.Errorf("wasm: unknown instruction %s", in.op)
+		}
+		code = append(code, opcode...)
+
+		switch in.op {
+		case "local.get", "local.set", "local.tee":
+			code = append(code, unsigned(uint64(f.localIndex(in.name)))...)
+		case "global.get", "global.set":
+			code = append(code, unsigned(uint64(m.globalIndex(in.name)))...)
+		case "call":
+			code = append(code, unsigned(uint64(m.functionIndex(in.name)))...)
+		case "br", "br_if":
+			code = append(code, unsigned(uint64(in.index))...)
+		case "i32.const", "i64.const":
+			code = append(code, signed(in.value)...)
+		case "f64.const":
+			code = binary.LittleEndian.AppendUint64(code, math.Float64bits(in.float))
+		case "i32.load", "i64.load", "f64.load", "i32.load8_u", "i32.store":
+			code = append(code, unsigned(alignments[in.op])...)
+			code = append(code, unsigned(uint64(in.index))...)
+		}
+	}
+	return append(code, 0x0B), nil
+}
+
+func appendSection(out []byte, id byte, content []byte) []byte {
+	out = append(out, id)
+	out = append(out, unsigned(uint64(len(content)))...)
+	return append(out, content...)
+}
+
+func name(value string) []byte {
+	return append(unsigned(uint64(len(value))), value...)
+}
+
+// unsigned encodes a value as unsigned LEB128.
+func unsigned(value uint64) []byte {
+	out := []byte{}
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if value != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+// signed encodes a value as signed LEB128.
+func signed(value int64) []byte {
+	out := []byte{}
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
@@ -0,0 +1,310 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/semantic"
+)
+
+// reservedNames are the locals of main that are not BASIC variables. Wasm
+// names live in their own namespace, so no keyword needs escaping.
+var reservedNames = map[string]bool{}
+
+// compiler translates a program into the body of the exported main function.
+type compiler struct {
+	module *module
+	main   *function
+	types  *semantic.Types
+}
+
+// compile builds the module for a program that passed semantic analysis.
+func compile(program *ast.Program, types *semantic.Types) (*module, error) {
+	c := &compiler{
+		module: newModule(),
+		main:   &function{name: "main", exportName: "main"},
+		types:  types,
+	}
+	c.module.addImports()
+	// Address 0 holds the empty string, the initial value of string variables
+	c.module.intern("")
+	c.module.functions = append(c.module.functions, c.main)
+
+	for _, name := range types.Variables() {
+		c.main.locals = append(c.main.locals, local{name: backend.Identifier(name, reservedNames), typ: valueTypeOf(types.Variable(name))})
+	}
+	for _, stmt := range program.Statements {
+		if err := c.compileStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := semantic.CollectData(program)
+	address := c.layoutData(pool)
+	c.module.addRuntime(address, len(pool))
+
+	// Concatenated strings are allocated after the static data
+	c.module.align(8)
+	c.module.globals = append(c.module.globals, global{name: "heap", typ: i32, initial: int64(len(c.module.data))})
+
+	return c.module, nil
+}
+
+func (c *compiler) emit(op string) {
+	c.main.body = append(c.main.body, instruction{op: op})
+}
+
+func (c *compiler) emitNamed(op string, name string) {
+	c.main.body = append(c.main.body, instruction{op: op, name: name})
+}
+
+func (c *compiler) compileStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return c.compilePrintStatement(stmt)
+	case *ast.LetStatement:
+		return c.compileAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		return c.compileAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return c.compileIfStatement(stmt)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(stmt)
+	case *ast.EndStatement:
+		c.emitNamed("call", "end")
+		c.emit("return")
+	case *ast.CommentStatement:
+		c.emitNamed("comment", stmt.Text)
+	case *ast.DataStatement:
+		// The values are laid out in memory by layoutData
+	case *ast.ReadStatement:
+		for _, identifier := range stmt.Identifiers {
+			switch c.types.Variable(identifier.Name) {
+			case semantic.Float:
+				c.emitNamed("call", "read_float")
+			case semantic.String:
+				c.emitNamed("call", "read_string")
+			default:
+				c.emitNamed("call", "read_integer")
+			}
+			c.emitNamed("local.set", backend.Identifier(identifier.Name, reservedNames))
+		}
+	case *ast.RestoreStatement:
+		c.main.body = append(c.main.body, instruction{op: "i32.const", value: 0})
+		c.emitNamed("global.set", "data_pointer")
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (c *compiler) compilePrintStatement(stmt *ast.PrintStatement) error {
+	t := c.types.Of(stmt.Expression)
+	if err := c.compileExpression(stmt.Expression, t); err != nil {
+		return err
+	}
+
+	switch t {
+	case semantic.Integer:
+		c.emitNamed("call", "print_integer")
+	case semantic.Float:
+		c.emitNamed("call", "print_float")
+	case semantic.String:
+		c.emitNamed("call", "print_string")
+	case semantic.Boolean:
+		c.emitNamed("call", "print_boolean")
+	default:
+		return fmt.Errorf("cannot print expression of unknown type")
+	}
+	return nil
+}
+
+func (c *compiler) compileAssignment(name string, value ast.Expression) error {
+	if err := c.compileExpression(value, c.types.Variable(name)); err != nil {
+		return err
+	}
+	c.emitNamed("local.set", backend.Identifier(name, reservedNames))
+	return nil
+}
+
+func (c *compiler) compileIfStatement(stmt *ast.IfStatement) error {
+	if err := c.compileExpression(stmt.Condition, semantic.Boolean); err != nil {
+		return err
+	}
+	c.emit("if")
+	if err := c.compileStatement(stmt.ThenBranch); err != nil {
+		return err
+	}
+	if stmt.ElseBranch != nil {
+		c.emit("else")
+		if err := c.compileStatement(stmt.ElseBranch); err != nil {
+			return err
+		}
+	}
+	c.emit("end")
+	return nil
+}
+
+// compileWhileStatement checks the condition at the top of a loop nested in a
+// block, so that br_if 1 leaves the loop and br 0 starts the next iteration.
+func (c *compiler) compileWhileStatement(stmt *ast.WhileStatement) error {
+	c.emit("block")
+	c.emit("loop")
+	if err := c.compileExpression(stmt.Condition, semantic.Boolean); err != nil {
+		return err
+	}
+	c.emit("i32.eqz")
+	c.main.body = append(c.main.body, instruction{op: "br_if", index: 1})
+	for _, statement := range stmt.DoBranch {
+		if err := c.compileStatement(statement); err != nil {
+			return err
+		}
+	}
+	c.main.body = append(c.main.body, instruction{op: "br", index: 0})
+	c.emit("end")
+	c.emit("end")
+	return nil
+}
+
+// compileExpression leaves the value of expr on the stack, converted to want
+// when an integer is used where a float is expected.
+func (c *compiler) compileExpression(expr ast.Expression, want semantic.Type) error {
+	t := c.types.Of(expr)
+
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		c.emitNamed("local.get", backend.Identifier(expr.Name, reservedNames))
+	case *ast.IntegerLiteral:
+		if want == semantic.Float {
+			c.main.body = append(c.main.body, instruction{op: "f64.const", float: float64(expr.Value)})
+			return nil
+		}
+		c.main.body = append(c.main.body, instruction{op: "i64.const", value: int64(expr.Value)})
+	case *ast.FloatLiteral:
+		c.main.body = append(c.main.body, instruction{op: "f64.const", float: expr.Value})
+	case *ast.StringLiteral:
+		c.main.body = append(c.main.body, instruction{op: "i32.const", value: int64(c.module.intern(expr.Value))})
+	case *ast.BinaryExpression:
+		if err := c.compileBinaryExpression(expr); err != nil {
+			return err
+		}
+	default:
+		return &ast.UnsupportedError{Node: expr}
+	}
+
+	if t == semantic.Integer && want == semantic.Float {
+		c.emit("f64.convert_i64_s")
+	}
+	return nil
+}
+
+func (c *compiler) compileBinaryExpression(expr *ast.BinaryExpression) error {
+	operands := binaryOperands(c.types.Of(expr.Left), c.types.Of(expr.Right))
+	if err := c.compileExpression(expr.Left, operands); err != nil {
+		return err
+	}
+	if err := c.compileExpression(expr.Right, operands); err != nil {
+		return err
+	}
+
+	if operands == semantic.String {
+		if expr.Operator == "+" {
+			c.emitNamed("call", "concat")
+			return nil
+		}
+		c.emitNamed("call", "compare")
+		c.main.body = append(c.main.body, instruction{op: "i32.const", value: 0})
+		c.emit(comparisons["i32"][expr.Operator])
+		return nil
+	}
+
+	prefix := "i64"
+	if operands == semantic.Float {
+		prefix = "f64"
+	}
+	switch expr.Operator {
+	case "+":
+		c.emit(prefix + ".add")
+	case "-":
+		c.emit(prefix + ".sub")
+	case "*":
+		c.emit(prefix + ".mul")
+	case "/":
+		if prefix == "i64" {
+			c.emitNamed("call", "divide")
+		} else {
+			c.emit("f64.div")
+		}
+	default:
+		op, found := comparisons[prefix][expr.Operator]
+		if !found {
+			return fmt.Errorf("unsupported operator '%s'", expr.Operator)
+		}
+		c.emit(op)
+	}
+	return nil
+}
+
+// comparisons maps the relational operators to instructions per operand type.
+var comparisons = map[string]map[string]string{
+	"i32": {"==": "i32.eq", "<": "i32.lt_s", ">": "i32.gt_s"},
+	"i64": {"==": "i64.eq", "<": "i64.lt_s", ">": "i64.gt_s"},
+	"f64": {"==": "f64.eq", "<": "f64.lt", ">": "f64.gt"},
+}
+
+// binaryOperands returns the type both operands are converted to.
+func binaryOperands(left semantic.Type, right semantic.Type) semantic.Type {
+	switch {
+	case left == semantic.Unknown:
+		return right
+	case right == semantic.Unknown || left == right:
+		return left
+	}
+	// Semantic analysis only lets integers and floats mix
+	return semantic.Float
+}
+
+// layoutData interns the runtime messages and the strings of the DATA pool,
+// then writes the pool entries and returns the address of the first one.
+func (c *compiler) layoutData(pool []ast.Expression) int {
+	for _, message := range messages {
+		c.module.intern(message)
+	}
+	for _, value := range pool {
+		if value, ok := value.(*ast.StringLiteral); ok {
+			c.module.intern(value.Value)
+		}
+	}
+
+	c.module.align(8)
+	address := len(c.module.data)
+	for _, value := range pool {
+		entry := make([]byte, entrySize)
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			binary.LittleEndian.PutUint32(entry, tagInteger)
+			binary.LittleEndian.PutUint64(entry[8:], uint64(int64(value.Value)))
+		case *ast.FloatLiteral:
+			binary.LittleEndian.PutUint32(entry, tagFloat)
+			binary.LittleEndian.PutUint64(entry[8:], math.Float64bits(value.Value))
+		case *ast.StringLiteral:
+			binary.LittleEndian.PutUint32(entry, tagString)
+			binary.LittleEndian.PutUint32(entry[8:], uint32(c.module.intern(value.Value)))
+		}
+		c.module.data = append(c.module.data, entry...)
+	}
+	return address
+}
+
+func valueTypeOf(t semantic.Type) valueType {
+	switch t {
+	case semantic.Float:
+		return f64
+	case semantic.String, semantic.Boolean:
+		return i32
+	default:
+		return i64
+	}
+}
@@ -0,0 +1,175 @@
+package wasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type valueType byte
+
+const (
+	i32 valueType = 0x7F
+	i64 valueType = 0x7E
+	f64 valueType = 0x7C
+)
+
+func (t valueType) String() string {
+	switch t {
+	case i32:
+		return "i32"
+	case i64:
+		return "i64"
+	default:
+		return "f64"
+	}
+}
+
+// instruction is one instruction in flat (non-folded) form. Locals, globals
+// and functions are referenced by name and resolved when the module is
+// encoded; index holds branch depths and memory offsets.
+type instruction struct {
+	op    string
+	name  string
+	index int
+	value int64
+	float float64
+}
+
+type local struct {
+	name string
+	typ  valueType
+}
+
+type function struct {
+	name    string
+	params  []local
+	results []valueType
+	locals  []local
+	body    []instruction
+	// importName is set for functions provided by the host
+	importName string
+	exportName string
+}
+
+func (f *function) signature() string {
+	params := []string{}
+	for _, param := range f.params {
+		params = append(params, param.typ.String())
+	}
+	results := []string{}
+	for _, result := range f.results {
+		results = append(results, result.String())
+	}
+	return strings.Join(params, " ") + "->" + strings.Join(results, " ")
+}
+
+func (f *function) localIndex(name string) int {
+	for i, param := range f.params {
+		if param.name == name {
+			return i
+		}
+	}
+	for i, l := range f.locals {
+		if l.name == name {
+			return len(f.params) + i
+		}
+	}
+	panic(fmt.Sprintf("wasm: unknown local $%s in $%s", name, f.name))
+}
+
+type global struct {
+	name    string
+	typ     valueType
+	initial int64
+}
+
+// module is a WebAssembly module with one memory, holding the string
+// literals and the DATA pool, and a heap growing after them.
+type module struct {
+	functions []*function
+	globals   []global
+	data      []byte
+	strings   map[string]int
+}
+
+func newModule() *module {
+	return &module{strings: make(map[string]int)}
+}
+
+// intern stores a string in memory, prefixed with its length as an i32, and
+// returns its address. Equal strings share their storage.
+func (m *module) intern(value string) int {
+	if address, found := m.strings[value]; found {
+		return address
+	}
+	m.align(4)
+	address := len(m.data)
+	m.data = append(m.data, byte(len(value)), byte(len(value)>>8), byte(len(value)>>16), byte(len(value)>>24))
+	m.data = append(m.data, value...)
+	m.strings[value] = address
+	return address
+}
+
+func (m *module) align(boundary int) {
+	for len(m.data)%boundary != 0 {
+		m.data = append(m.data, 0)
+	}
+}
+
+func (m *module) functionIndex(name string) int {
+	for i, f := range m.functions {
+		if f.name == name {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("wasm: unknown function $%s", name))
+}
+
+func (m *module) globalIndex(name string) int {
+	for i, g := range m.globals {
+		if g.name == name {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("wasm: unknown global $%s", name))
+}
+
+func (m *module) pages() int {
+	return len(m.data)/65536 + 1
+}
+
+// parseBody reads instructions written one per line in the flat text format,
+// which keeps the hand written runtime functions readable. Comments start
+// with ";;".
+func parseBody(text string) []instruction {
+	body := []instruction{}
+	for _, line := range strings.Split(text, "\n") {
+		if comment := strings.Index(line, ";;"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		in := instruction{op: fields[0]}
+		if len(fields) > 1 {
+			argument := fields[1]
+			switch {
+			case strings.HasPrefix(argument, "$"):
+				in.name = argument[1:]
+			case strings.HasPrefix(argument, "offset="):
+				in.index, _ = strconv.Atoi(strings.TrimPrefix(argument, "offset="))
+			case in.op == "f64.const":
+				in.float, _ = strconv.ParseFloat(argument, 64)
+			case in.op == "i32.const" || in.op == "i64.const":
+				in.value, _ = strconv.ParseInt(argument, 10, 64)
+			default:
+				in.index, _ = strconv.Atoi(argument)
+			}
+		}
+		body = append(body, in)
+	}
+	return body
+}
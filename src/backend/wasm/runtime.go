@@ -0,0 +1,290 @@
+package wasm
+
+import (
+	"fmt"
+)
+
+// Tags of the DATA pool entries. Each entry takes 16 bytes: the tag as an
+// i32, then the value as an i64, an f64 or the address of a string at offset 8.
+const (
+	tagInteger = 0
+	tagFloat   = 1
+	tagString  = 2
+	entrySize  = 16
+)
+
+// messages are the runtime errors reported through fail.
+var messages = []string{"division by zero", "out of memory", "out of data", "type mismatch in READ"}
+
+// addImports declares the functions the host provides. PRINT calls one of
+// the print functions, END calls end, and runtime errors call fail with the
+// address of the message before trapping.
+func (m *module) addImports() {
+	m.functions = append(m.functions,
+		&function{name: "print_integer", importName: "print_integer", params: []local{{"value", i64}}},
+		&function{name: "print_float", importName: "print_float", params: []local{{"value", f64}}},
+		&function{name: "print_string", importName: "print_string", params: []local{{"value", i32}}},
+		&function{name: "print_boolean", importName: "print_boolean", params: []local{{"value", i32}}},
+		&function{name: "end", importName: "end"},
+		&function{name: "fail", importName: "fail", params: []local{{"message", i32}}},
+	)
+}
+
+// addRuntime adds the functions generated code relies on. pool and count are
+// the address and the number of entries of the DATA pool.
+func (m *module) addRuntime(pool int, count int) {
+	fail := func(message string) string {
+		return fmt.Sprintf("i32.const %d\ncall $fail\nunreachable", m.intern(message))
+	}
+
+	m.globals = append(m.globals, global{name: "data_pointer", typ: i32})
+
+	m.functions = append(m.functions, &function{
+		name:    "divide",
+		params:  []local{{"left", i64}, {"right", i64}},
+		results: []valueType{i64},
+		body: parseBody(fmt.Sprintf(`
+			local.get $right
+			i64.eqz
+			if
+			%s
+			end
+			;; i64.div_s traps on INT64_MIN / -1, whose quotient does not fit,
+			;; so -1 negates instead, wrapping around
+			local.get $right
+			i64.const -1
+			i64.eq
+			if
+			i64.const 0
+			local.get $left
+			i64.sub
+			return
+			end
+			;; i64.div_s truncates toward zero
+			local.get $left
+			local.get $right
+			i64.div_s`, fail("division by zero"))),
+	})
+
+	m.functions = append(m.functions, &function{
+		name:    "concat",
+		params:  []local{{"left", i32}, {"right", i32}},
+		results: []valueType{i32},
+		locals:  []local{{"result", i32}, {"left_length", i32}, {"right_length", i32}},
+		body: parseBody(fmt.Sprintf(`
+			local.get $left
+			i32.load
+			local.set $left_length
+			local.get $right
+			i32.load
+			local.set $right_length
+			global.get $heap
+			local.set $result
+			;; grow the memory when the new string does not fit
+			local.get $result
+			local.get $left_length
+			i32.add
+			local.get $right_length
+			i32.add
+			i32.const 4
+			i32.add
+			memory.size
+			i32.const 65536
+			i32.mul
+			i32.gt_u
+			if
+			local.get $left_length
+			local.get $right_length
+			i32.add
+			i32.const 4
+			i32.add
+			i32.const 65536
+			i32.div_u
+			i32.const 1
+			i32.add
+			memory.grow
+			i32.const -1
+			i32.eq
+			if
+			%s
+			end
+			end
+			local.get $result
+			local.get $left_length
+			local.get $right_length
+			i32.add
+			i32.store
+			local.get $result
+			i32.const 4
+			i32.add
+			local.get $left
+			i32.const 4
+			i32.add
+			local.get $left_length
+			memory.copy
+			local.get $result
+			i32.const 4
+			i32.add
+			local.get $left_length
+			i32.add
+			local.get $right
+			i32.const 4
+			i32.add
+			local.get $right_length
+			memory.copy
+			local.get $result
+			i32.const 4
+			i32.add
+			local.get $left_length
+			i32.add
+			local.get $right_length
+			i32.add
+			global.set $heap
+			local.get $result`, fail("out of memory"))),
+	})
+
+	// compare returns a negative number, zero or a positive number when the
+	// left string sorts before, equal to or after the right one
+	m.functions = append(m.functions, &function{
+		name:    "compare",
+		params:  []local{{"left", i32}, {"right", i32}},
+		results: []valueType{i32},
+		locals:  []local{{"index", i32}, {"length", i32}, {"a", i32}, {"b", i32}},
+		body: parseBody(`
+			local.get $left
+			i32.load
+			local.tee $length
+			local.get $right
+			i32.load
+			local.tee $b
+			i32.gt_u
+			if
+			local.get $b
+			local.set $length
+			end
+			block
+			loop
+			local.get $index
+			local.get $length
+			i32.ge_u
+			br_if 1
+			local.get $left
+			local.get $index
+			i32.add
+			i32.load8_u offset=4
+			local.set $a
+			local.get $right
+			local.get $index
+			i32.add
+			i32.load8_u offset=4
+			local.set $b
+			local.get $a
+			local.get $b
+			i32.ne
+			if
+			local.get $a
+			local.get $b
+			i32.sub
+			return
+			end
+			local.get $index
+			i32.const 1
+			i32.add
+			local.set $index
+			br 0
+			end
+			end
+			;; one string is a prefix of the other, the shorter one comes first
+			local.get $left
+			i32.load
+			local.get $right
+			i32.load
+			i32.sub`),
+	})
+
+	m.functions = append(m.functions, &function{
+		name:    "read_entry",
+		results: []valueType{i32},
+		locals:  []local{{"entry", i32}},
+		body: parseBody(fmt.Sprintf(`
+			global.get $data_pointer
+			i32.const %d
+			i32.ge_u
+			if
+			%s
+			end
+			global.get $data_pointer
+			i32.const %d
+			i32.mul
+			i32.const %d
+			i32.add
+			local.set $entry
+			global.get $data_pointer
+			i32.const 1
+			i32.add
+			global.set $data_pointer
+			local.get $entry`, count, fail("out of data"), entrySize, pool)),
+	})
+
+	mismatch := fail("type mismatch in READ")
+	m.functions = append(m.functions, &function{
+		name:    "read_integer",
+		results: []valueType{i64},
+		locals:  []local{{"entry", i32}},
+		body: parseBody(fmt.Sprintf(`
+			call $read_entry
+			local.tee $entry
+			i32.load
+			i32.const %d
+			i32.ne
+			if
+			%s
+			end
+			local.get $entry
+			i64.load offset=8`, tagInteger, mismatch)),
+	})
+
+	m.functions = append(m.functions, &function{
+		name:    "read_float",
+		results: []valueType{f64},
+		locals:  []local{{"entry", i32}},
+		body: parseBody(fmt.Sprintf(`
+			call $read_entry
+			local.tee $entry
+			i32.load
+			i32.const %d
+			i32.eq
+			if
+			local.get $entry
+			i64.load offset=8
+			f64.convert_i64_s
+			return
+			end
+			local.get $entry
+			i32.load
+			i32.const %d
+			i32.ne
+			if
+			%s
+			end
+			local.get $entry
+			f64.load offset=8`, tagInteger, tagFloat, mismatch)),
+	})
+
+	m.functions = append(m.functions, &function{
+		name:    "read_string",
+		results: []valueType{i32},
+		locals:  []local{{"entry", i32}},
+		body: parseBody(fmt.Sprintf(`
+			call $read_entry
+			local.tee $entry
+			i32.load
+			i32.const %d
+			i32.ne
+			if
+			%s
+			end
+			local.get $entry
+			i32.load offset=8`, tagString, mismatch)),
+	})
+}
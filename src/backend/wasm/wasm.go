@@ -0,0 +1,106 @@
+package wasm
+
+import (
+	"context"
+	"os"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+)
+
+func init() {
+	backend.Register("wasm", func() backend.Backend { return &Backend{} })
+	backend.Register("wat", func() backend.Backend { return &TextBackend{} })
+}
+
+// Backend generates a WebAssembly module in the binary format. The module
+// exports its memory and a main function, and imports print_integer,
+// print_float, print_string, print_boolean, end and fail from "env". Strings
+// are passed as the address of their length, stored as an i32 in front of
+// the UTF-8 bytes.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "wasm"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".wasm"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) ([]byte, error) {
+	m, err := build(program, options)
+	if err != nil {
+		return nil, err
+	}
+	return m.Binary()
+}
+
+// Run executes the module with Node.js through a small loader providing the
+// imports.
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	loader := file + ".cjs"
+	if err := os.WriteFile(loader, []byte(nodeLoader), 0644); err != nil {
+		return nil, err
+	}
+	return backend.Execute(ctx, "node", loader, file)
+}
+
+// TextBackend generates the same module as Backend in the text format.
+type TextBackend struct{}
+
+func (b *TextBackend) Name() string {
+	return "wat"
+}
+
+func (b *TextBackend) FileExtension() string {
+	return ".wat"
+}
+
+func (b *TextBackend) Generate(program *ast.Program, options backend.Options) ([]byte, error) {
+	m, err := build(program, options)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(m.WAT()), nil
+}
+
+func build(program *ast.Program, options backend.Options) (*module, error) {
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+	return compile(program, types)
+}
+
+// nodeLoader instantiates the module given on the command line and runs main.
+const nodeLoader = `const fs = require("fs");
+
+class End extends Error {}
+
+let memory;
+function readString(address) {
+	const view = new DataView(memory.buffer);
+	const length = view.getUint32(address, true);
+	return Buffer.from(memory.buffer, address + 4, length).toString("utf8");
+}
+
+const env = {
+	print_integer: (value) => console.log(String(value)),
+	print_float: (value) => console.log(value),
+	print_string: (address) => console.log(readString(address)),
+	print_boolean: (value) => console.log(value !== 0),
+	end: () => { throw new End(); },
+	fail: (address) => { throw new Error(readString(address)); },
+};
+
+const compiled = new WebAssembly.Module(fs.readFileSync(process.argv[2]));
+const instance = new WebAssembly.Instance(compiled, { env });
+memory = instance.exports.memory;
+try {
+	instance.exports.main();
+} catch (error) {
+	if (!(error instanceof End)) {
+		throw error;
+	}
+}
+`
@@ -0,0 +1,103 @@
+package wasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WAT renders the module in the WebAssembly text format.
+func (m *module) WAT() string {
+	var out strings.Builder
+	out.WriteString("(module\n")
+
+	for _, f := range m.functions {
+		if f.importName != "" {
+			out.WriteString(fmt.Sprintf("  (func $%s (import \"env\" %q)%s)\n", f.name, f.importName, m.watSignature(f)))
+		}
+	}
+
+	out.WriteString(fmt.Sprintf("  (memory (export \"memory\") %d)\n", m.pages()))
+	for _, g := range m.globals {
+		out.WriteString(fmt.Sprintf("  (global $%s (mut %s) (%s.const %d))\n", g.name, g.typ, g.typ, g.initial))
+	}
+	out.WriteString("  (data (i32.const 0) \"" + watString(m.data) + "\")\n")
+
+	for _, f := range m.functions {
+		if f.importName != "" {
+			continue
+		}
+
+		out.WriteString("\n  (func $" + f.name)
+		if f.exportName != "" {
+			out.WriteString(fmt.Sprintf(" (export %q)", f.exportName))
+		}
+		out.WriteString(m.watSignature(f) + "\n")
+		for _, l := range f.locals {
+			out.WriteString(fmt.Sprintf("    (local $%s %s)\n", l.name, l.typ))
+		}
+
+		depth := 2
+		for _, in := range f.body {
+			if in.op == "end" || in.op == "else" {
+				depth--
+			}
+			out.WriteString(strings.Repeat("  ", depth) + watInstruction(in) + "\n")
+			if in.op == "block" || in.op == "loop" || in.op == "if" || in.op == "else" {
+				depth++
+			}
+		}
+		out.WriteString("  )\n")
+	}
+
+	out.WriteString(")\n")
+	return out.String()
+}
+
+func (m *module) watSignature(f *function) string {
+	var out strings.Builder
+	for _, param := range f.params {
+		if f.importName != "" {
+			out.WriteString(fmt.Sprintf(" (param %s)", param.typ))
+		} else {
+			out.WriteString(fmt.Sprintf(" (param $%s %s)", param.name, param.typ))
+		}
+	}
+	for _, result := range f.results {
+		out.WriteString(fmt.Sprintf(" (result %s)", result))
+	}
+	return out.String()
+}
+
+func watInstruction(in instruction) string {
+	switch {
+	case in.op == "comment":
+		return ";;" + in.name
+	case in.name != "":
+		return in.op + " $" + in.name
+	case in.op == "i32.const" || in.op == "i64.const":
+		return in.op + " " + strconv.FormatInt(in.value, 10)
+	case in.op == "f64.const":
+		return in.op + " " + strconv.FormatFloat(in.float, 'g', -1, 64)
+	case strings.Contains(in.op, ".load") || strings.Contains(in.op, ".store"):
+		if in.index != 0 {
+			return fmt.Sprintf("%s offset=%d", in.op, in.index)
+		}
+		return in.op
+	case in.op == "br" || in.op == "br_if":
+		return fmt.Sprintf("%s %d", in.op, in.index)
+	}
+	return in.op
+}
+
+func watString(data []byte) string {
+	var out strings.Builder
+	for _, b := range data {
+		if b >= 0x20 && b < 0x7f && b != '"' && b != '\\' {
+			out.WriteByte(b)
+		} else {
+			out.WriteString(fmt.Sprintf("\\%02x", b))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,372 @@
+package x86
+
+// runtime is appended to every generated program. The helpers take their
+// arguments in %rdi and %rsi and return their result in %rax, following the
+// System V calling convention; floats are passed and returned as their bit
+// pattern in general purpose registers, like on the expression stack. Each
+// helper aligns the stack itself before calling into libc, since the
+// expression stack of main may leave it misaligned. Numbers are printed the
+// way the JavaScript backend prints them.
+const runtime = `
+	.section .rodata
+.Ltb_format_integer:
+	.string "%ld\n"
+.Ltb_format_string:
+	.string "%s"
+.Ltb_format_fail:
+	.string "%s\n"
+.Ltb_format_exponent:
+	.string "%.*e"
+.Ltb_format_fraction:
+	.string "%.*s.%s"
+.Ltb_format_dot:
+	.string ".%s"
+.Ltb_format_scientific:
+	.string "e%c%d"
+.Ltb_zero_dot:
+	.string "0."
+.Ltb_true:
+	.string "true"
+.Ltb_false:
+	.string "false"
+.Ltb_nan:
+	.string "NaN"
+.Ltb_infinity:
+	.string "Infinity"
+.Ltb_zero:
+	.string "0"
+.Ltb_division_by_zero:
+	.string "division by zero"
+.Ltb_out_of_memory:
+	.string "out of memory"
+
+	.text
+tb_print_integer:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	movq %rdi, %rsi
+	leaq .Ltb_format_integer(%rip), %rdi
+	xorl %eax, %eax
+	call printf@PLT
+	leave
+	ret
+
+tb_print_string:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	call puts@PLT
+	leave
+	ret
+
+tb_print_boolean:
+	leaq .Ltb_true(%rip), %rax
+	leaq .Ltb_false(%rip), %rcx
+	testq %rdi, %rdi
+	cmovzq %rcx, %rax
+	movq %rax, %rdi
+	jmp tb_print_string
+
+# tb_print_float finds the shortest "%.*e" representation that reads back as
+# the same double, then lays its digits out like JavaScript does
+tb_print_float:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	subq $80, %rsp
+	andq $-16, %rsp
+	# -64(%rbp): buffer, -96(%rbp): digits, -104(%rbp): value
+	movq %rdi, -104(%rbp)
+	movq %rdi, %xmm0
+	ucomisd %xmm0, %xmm0
+	jp .Ltb_float_nan
+	movq %rdi, %rax
+	btrq $63, %rax
+	testq %rax, %rax
+	jz .Ltb_float_zero
+	movabsq $0x7ff0000000000000, %rcx
+	cmpq %rcx, %rax
+	je .Ltb_float_infinity
+	movq %rax, -104(%rbp)
+	testq %rdi, %rdi
+	jns .Ltb_float_positive
+	movl $45, %edi
+	call putchar@PLT
+.Ltb_float_positive:
+	movl $1, %r12d
+.Ltb_float_precision:
+	cmpl $17, %r12d
+	jge .Ltb_float_format
+	leaq -64(%rbp), %rdi
+	movl $32, %esi
+	leaq .Ltb_format_exponent(%rip), %rdx
+	leal -1(%r12), %ecx
+	movq -104(%rbp), %xmm0
+	movl $1, %eax
+	call snprintf@PLT
+	leaq -64(%rbp), %rdi
+	xorl %esi, %esi
+	call strtod@PLT
+	movq -104(%rbp), %xmm1
+	ucomisd %xmm1, %xmm0
+	jp .Ltb_float_next
+	je .Ltb_float_format
+.Ltb_float_next:
+	incl %r12d
+	jmp .Ltb_float_precision
+.Ltb_float_format:
+	leaq -64(%rbp), %rdi
+	movl $32, %esi
+	leaq .Ltb_format_exponent(%rip), %rdx
+	leal -1(%r12), %ecx
+	movq -104(%rbp), %xmm0
+	movl $1, %eax
+	call snprintf@PLT
+	# copy the digits, without the decimal point, up to the exponent
+	leaq -64(%rbp), %rsi
+	leaq -96(%rbp), %rdi
+	xorl %ebx, %ebx
+.Ltb_float_copy:
+	movb (%rsi), %al
+	cmpb $101, %al
+	je .Ltb_float_copied
+	cmpb $46, %al
+	je .Ltb_float_skip
+	movb %al, (%rdi,%rbx)
+	incq %rbx
+.Ltb_float_skip:
+	incq %rsi
+	jmp .Ltb_float_copy
+.Ltb_float_copied:
+	movb $0, (%rdi,%rbx)
+	leaq 1(%rsi), %rdi
+	call atoi@PLT
+	leal 1(%rax), %r13d
+	# %ebx: number of digits, %r13d: position of the decimal point
+	cmpl $21, %r13d
+	jg .Ltb_float_scientific
+	cmpl %r13d, %ebx
+	jg .Ltb_float_fraction
+	leaq .Ltb_format_string(%rip), %rdi
+	leaq -96(%rbp), %rsi
+	xorl %eax, %eax
+	call printf@PLT
+	movl %ebx, %r14d
+.Ltb_float_trailing_zeros:
+	cmpl %r13d, %r14d
+	jge .Ltb_float_newline
+	movl $48, %edi
+	call putchar@PLT
+	incl %r14d
+	jmp .Ltb_float_trailing_zeros
+.Ltb_float_fraction:
+	cmpl $0, %r13d
+	jle .Ltb_float_small
+	leaq .Ltb_format_fraction(%rip), %rdi
+	movl %r13d, %esi
+	leaq -96(%rbp), %rdx
+	movslq %r13d, %rcx
+	addq %rdx, %rcx
+	xorl %eax, %eax
+	call printf@PLT
+	jmp .Ltb_float_newline
+.Ltb_float_small:
+	cmpl $-6, %r13d
+	jle .Ltb_float_scientific
+	leaq .Ltb_format_string(%rip), %rdi
+	leaq .Ltb_zero_dot(%rip), %rsi
+	xorl %eax, %eax
+	call printf@PLT
+	movl %r13d, %r14d
+.Ltb_float_leading_zeros:
+	testl %r14d, %r14d
+	jz .Ltb_float_digits
+	movl $48, %edi
+	call putchar@PLT
+	incl %r14d
+	jmp .Ltb_float_leading_zeros
+.Ltb_float_digits:
+	leaq .Ltb_format_string(%rip), %rdi
+	leaq -96(%rbp), %rsi
+	xorl %eax, %eax
+	call printf@PLT
+	jmp .Ltb_float_newline
+.Ltb_float_scientific:
+	movzbl -96(%rbp), %edi
+	call putchar@PLT
+	cmpl $1, %ebx
+	jle .Ltb_float_exponent
+	leaq .Ltb_format_dot(%rip), %rdi
+	leaq -95(%rbp), %rsi
+	xorl %eax, %eax
+	call printf@PLT
+.Ltb_float_exponent:
+	leaq .Ltb_format_scientific(%rip), %rdi
+	movl $43, %esi
+	leal -1(%r13), %edx
+	testl %edx, %edx
+	jg .Ltb_float_print_exponent
+	movl $45, %esi
+	negl %edx
+.Ltb_float_print_exponent:
+	xorl %eax, %eax
+	call printf@PLT
+	jmp .Ltb_float_newline
+.Ltb_float_nan:
+	leaq .Ltb_nan(%rip), %rdi
+	call puts@PLT
+	jmp .Ltb_float_return
+.Ltb_float_zero:
+	leaq .Ltb_zero(%rip), %rdi
+	call puts@PLT
+	jmp .Ltb_float_return
+.Ltb_float_infinity:
+	testq %rdi, %rdi
+	jns .Ltb_float_positive_infinity
+	movl $45, %edi
+	call putchar@PLT
+.Ltb_float_positive_infinity:
+	leaq .Ltb_infinity(%rip), %rdi
+	call puts@PLT
+	jmp .Ltb_float_return
+.Ltb_float_newline:
+	movl $10, %edi
+	call putchar@PLT
+.Ltb_float_return:
+	movq -8(%rbp), %rbx
+	movq -16(%rbp), %r12
+	movq -24(%rbp), %r13
+	movq -32(%rbp), %r14
+	leave
+	ret
+
+tb_fail:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	movq %rdi, %rdx
+	movq stderr@GOTPCREL(%rip), %rax
+	movq (%rax), %rdi
+	leaq .Ltb_format_fail(%rip), %rsi
+	xorl %eax, %eax
+	call fprintf@PLT
+	movl $1, %edi
+	call exit@PLT
+
+tb_end:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	xorl %edi, %edi
+	call exit@PLT
+
+# tb_divide truncates toward zero, like idiv. idiv traps on the quotient of
+# INT64_MIN / -1, which does not fit, so -1 negates instead, wrapping around
+tb_divide:
+	testq %rsi, %rsi
+	jz .Ltb_divide_by_zero
+	movq %rdi, %rax
+	cmpq $-1, %rsi
+	je .Ltb_divide_negate
+	cqto
+	idivq %rsi
+	ret
+.Ltb_divide_negate:
+	negq %rax
+	ret
+.Ltb_divide_by_zero:
+	leaq .Ltb_division_by_zero(%rip), %rdi
+	jmp tb_fail
+
+# tb_compare returns the result of strcmp sign extended to 64 bits
+tb_compare:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	call strcmp@PLT
+	movslq %eax, %rax
+	leave
+	ret
+
+tb_concat:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	andq $-16, %rsp
+	movq %rdi, %r12
+	movq %rsi, %r13
+	call strlen@PLT
+	movq %rax, %r14
+	movq %r13, %rdi
+	call strlen@PLT
+	leaq 1(%r14,%rax), %rdi
+	call malloc@PLT
+	testq %rax, %rax
+	jz .Ltb_concat_out_of_memory
+	movq %rax, %rdi
+	movq %r12, %rsi
+	call strcpy@PLT
+	movq %rax, %rdi
+	movq %r13, %rsi
+	call strcat@PLT
+	movq -8(%rbp), %r12
+	movq -16(%rbp), %r13
+	movq -24(%rbp), %r14
+	leave
+	ret
+.Ltb_concat_out_of_memory:
+	leaq .Ltb_out_of_memory(%rip), %rdi
+	jmp tb_fail
+`
+
+// dataRuntime is appended when the program uses DATA, READ or RESTORE. The
+// generator emits the tb_data table of 16 byte entries, a tag followed by
+// the value, and tb_data_count before it.
+const dataRuntime = `
+	.section .rodata
+.Ltb_out_of_data:
+	.string "out of data"
+.Ltb_type_mismatch:
+	.string "type mismatch in READ"
+
+	.data
+	.balign 8
+tb_data_pointer:
+	.quad 0
+
+	.text
+# tb_read returns the next DATA value as the type tag in %rdi asks for,
+# converting integers when a float is expected
+tb_read:
+	movq tb_data_pointer(%rip), %rax
+	cmpq tb_data_count(%rip), %rax
+	jae .Ltb_read_out_of_data
+	incq tb_data_pointer(%rip)
+	shlq $4, %rax
+	leaq tb_data(%rip), %rcx
+	addq %rax, %rcx
+	movq (%rcx), %rdx
+	movq 8(%rcx), %rax
+	cmpq %rdi, %rdx
+	je .Ltb_read_return
+	cmpq $1, %rdi
+	jne .Ltb_read_type_mismatch
+	testq %rdx, %rdx
+	jne .Ltb_read_type_mismatch
+	cvtsi2sdq %rax, %xmm0
+	movq %xmm0, %rax
+.Ltb_read_return:
+	ret
+.Ltb_read_out_of_data:
+	leaq .Ltb_out_of_data(%rip), %rdi
+	jmp tb_fail
+.Ltb_read_type_mismatch:
+	leaq .Ltb_type_mismatch(%rip), %rdi
+	jmp tb_fail
+`
@@ -0,0 +1,450 @@
+package x86
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/semantic"
+)
+
+func init() {
+	backend.Register("x86-64", func() backend.Backend { return &Backend{} })
+}
+
+// Tags of the DATA table entries, also passed to tb_read.
+const (
+	tagInteger = 0
+	tagFloat   = 1
+	tagString  = 2
+)
+
+// Backend generates GNU assembler (AT&T syntax) for x86-64 Linux, linked
+// against libc. Expressions are evaluated on the machine stack: every value,
+// including floats and string pointers, takes one 8 byte slot.
+type Backend struct{}
+
+func (b *Backend) Name() string {
+	return "x86-64"
+}
+
+func (b *Backend) FileExtension() string {
+	return ".s"
+}
+
+func (b *Backend) Generate(program *ast.Program, options backend.Options) ([]byte, error) {
+	types, err := options.Types(program)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{types: types, strings: make(map[string]string)}
+	for _, stmt := range program.Statements {
+		if err := g.generateStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("# Generated by tiny-basic from " + options.SourceFile + "\n")
+	out.WriteString("\t.text\n\t.globl main\nmain:\n\tpushq %rbp\n\tmovq %rsp, %rbp\n")
+	out.WriteString(g.builder.String())
+	out.WriteString("\txorl %eax, %eax\n\tleave\n\tret\n")
+	out.WriteString(runtime)
+
+	if g.usesData {
+		pool, err := g.generateDataPool(semantic.CollectData(program))
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(pool)
+		out.WriteString(dataRuntime)
+	}
+
+	out.WriteString("\n\t.data\n\t.balign 8\n")
+	for _, name := range types.Variables() {
+		out.WriteString(variable(name) + ":\n")
+		if types.Variable(name) == semantic.String {
+			out.WriteString("\t.quad " + g.stringLabel("") + "\n")
+		} else {
+			out.WriteString("\t.quad 0\n")
+		}
+	}
+
+	if len(g.stringOrder) > 0 {
+		out.WriteString("\n\t.section .rodata\n")
+		for _, value := range g.stringOrder {
+			out.WriteString(g.strings[value] + ":\n\t.string " + gasString(value) + "\n")
+		}
+	}
+	out.WriteString("\n\t.section .note.GNU-stack,\"\",@progbits\n")
+
+	return []byte(out.String()), nil
+}
+
+func (b *Backend) Run(ctx context.Context, file string) ([]byte, error) {
+	executable := strings.TrimSuffix(file, ".s")
+	if _, err := backend.Execute(ctx, "cc", "-o", executable, file); err != nil {
+		return nil, err
+	}
+	return backend.Execute(ctx, executable)
+}
+
+type generator struct {
+	builder     strings.Builder
+	types       *semantic.Types
+	usesData    bool
+	labels      int
+	strings     map[string]string
+	stringOrder []string
+}
+
+func (g *generator) emit(instruction string) {
+	g.builder.WriteString("\t" + instruction + "\n")
+}
+
+func (g *generator) label(name string) {
+	g.builder.WriteString(name + ":\n")
+}
+
+func (g *generator) newLabel(kind string) string {
+	g.labels++
+	return fmt.Sprintf(".L%s%d", kind, g.labels)
+}
+
+// stringLabel returns the label of a string literal, which is emitted once
+// however often it is used.
+func (g *generator) stringLabel(value string) string {
+	if label, found := g.strings[value]; found {
+		return label
+	}
+	label := fmt.Sprintf(".Lstring%d", len(g.stringOrder))
+	g.strings[value] = label
+	g.stringOrder = append(g.stringOrder, value)
+	return label
+}
+
+func (g *generator) generateStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return g.generatePrintStatement(stmt)
+	case *ast.LetStatement:
+		return g.generateAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		return g.generateAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return g.generateIfStatement(stmt)
+	case *ast.WhileStatement:
+		return g.generateWhileStatement(stmt)
+	case *ast.EndStatement:
+		g.emit("call tb_end")
+	case *ast.CommentStatement:
+		g.emit("#" + stmt.Text)
+	case *ast.DataStatement:
+		g.usesData = true
+	case *ast.ReadStatement:
+		g.usesData = true
+		for _, identifier := range stmt.Identifiers {
+			g.emit(fmt.Sprintf("movq $%d, %%rdi", valueTag(g.types.Variable(identifier.Name))))
+			g.emit("call tb_read")
+			g.emit(fmt.Sprintf("movq %%rax, %s(%%rip)", variable(identifier.Name)))
+		}
+	case *ast.RestoreStatement:
+		g.usesData = true
+		g.emit("movq $0, tb_data_pointer(%rip)")
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (g *generator) generatePrintStatement(stmt *ast.PrintStatement) error {
+	t := g.types.Of(stmt.Expression)
+	if err := g.generateExpression(stmt.Expression, t); err != nil {
+		return err
+	}
+	g.emit("popq %rdi")
+
+	switch t {
+	case semantic.Integer:
+		g.emit("call tb_print_integer")
+	case semantic.Float:
+		g.emit("call tb_print_float")
+	case semantic.String:
+		g.emit("call tb_print_string")
+	case semantic.Boolean:
+		g.emit("call tb_print_boolean")
+	default:
+		return fmt.Errorf("cannot print expression of unknown type")
+	}
+	return nil
+}
+
+func (g *generator) generateAssignment(name string, value ast.Expression) error {
+	if err := g.generateExpression(value, g.types.Variable(name)); err != nil {
+		return err
+	}
+	g.emit(fmt.Sprintf("popq %s(%%rip)", variable(name)))
+	return nil
+}
+
+func (g *generator) generateIfStatement(stmt *ast.IfStatement) error {
+	elseLabel, endLabel := g.newLabel("else"), g.newLabel("endif")
+
+	if err := g.generateCondition(stmt.Condition, elseLabel); err != nil {
+		return err
+	}
+	if err := g.generateStatement(stmt.ThenBranch); err != nil {
+		return err
+	}
+	if stmt.ElseBranch != nil {
+		g.emit("jmp " + endLabel)
+	}
+	g.label(elseLabel)
+	if stmt.ElseBranch != nil {
+		if err := g.generateStatement(stmt.ElseBranch); err != nil {
+			return err
+		}
+		g.label(endLabel)
+	}
+	return nil
+}
+
+func (g *generator) generateWhileStatement(stmt *ast.WhileStatement) error {
+	loopLabel, endLabel := g.newLabel("while"), g.newLabel("wend")
+
+	g.label(loopLabel)
+	if err := g.generateCondition(stmt.Condition, endLabel); err != nil {
+		return err
+	}
+	for _, statement := range stmt.DoBranch {
+		if err := g.generateStatement(statement); err != nil {
+			return err
+		}
+	}
+	g.emit("jmp " + loopLabel)
+	g.label(endLabel)
+	return nil
+}
+
+// generateCondition evaluates a condition and jumps to falseLabel when it
+// does not hold.
+func (g *generator) generateCondition(condition ast.Expression, falseLabel string) error {
+	if err := g.generateExpression(condition, semantic.Boolean); err != nil {
+		return err
+	}
+	g.emit("popq %rax")
+	g.emit("testq %rax, %rax")
+	g.emit("jz " + falseLabel)
+	return nil
+}
+
+// generateExpression pushes the value of expr, converted to a float when an
+// integer is used where want is a float.
+func (g *generator) generateExpression(expr ast.Expression, want semantic.Type) error {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		g.emit(fmt.Sprintf("pushq %s(%%rip)", variable(expr.Name)))
+	case *ast.IntegerLiteral:
+		if want == semantic.Float {
+			g.pushFloat(float64(expr.Value))
+			return nil
+		}
+		g.emit(fmt.Sprintf("movabsq $%d, %%rax", expr.Value))
+		g.emit("pushq %rax")
+	case *ast.FloatLiteral:
+		g.pushFloat(expr.Value)
+	case *ast.StringLiteral:
+		g.emit(fmt.Sprintf("leaq %s(%%rip), %%rax", g.stringLabel(expr.Value)))
+		g.emit("pushq %rax")
+	case *ast.BinaryExpression:
+		if err := g.generateBinaryExpression(expr); err != nil {
+			return err
+		}
+	default:
+		return &ast.UnsupportedError{Node: expr}
+	}
+
+	if want == semantic.Float && g.types.Of(expr) == semantic.Integer {
+		g.emit("popq %rax")
+		g.emit("cvtsi2sdq %rax, %xmm0")
+		g.emit("movq %xmm0, %rax")
+		g.emit("pushq %rax")
+	}
+	return nil
+}
+
+func (g *generator) pushFloat(value float64) {
+	g.emit(fmt.Sprintf("movabsq $%d, %%rax", int64(math.Float64bits(value))))
+	g.builder.WriteString(fmt.Sprintf("\t# %s\n", backend.FloatLiteral(value)))
+	g.emit("pushq %rax")
+}
+
+var integerComparisons = map[string]string{"==": "sete", "<": "setl", ">": "setg"}
+
+func (g *generator) generateBinaryExpression(expr *ast.BinaryExpression) error {
+	operands := binaryOperands(g.types.Of(expr.Left), g.types.Of(expr.Right))
+	if err := g.generateExpression(expr.Left, operands); err != nil {
+		return err
+	}
+	if err := g.generateExpression(expr.Right, operands); err != nil {
+		return err
+	}
+	g.emit("popq %rcx")
+	g.emit("popq %rax")
+
+	switch operands {
+	case semantic.String:
+		g.emit("movq %rax, %rdi")
+		g.emit("movq %rcx, %rsi")
+		if expr.Operator == "+" {
+			g.emit("call tb_concat")
+			break
+		}
+		g.emit("call tb_compare")
+		g.emit("cmpq $0, %rax")
+		g.emitSet(integerComparisons[expr.Operator])
+	case semantic.Float:
+		if err := g.generateFloatOperation(expr.Operator); err != nil {
+			return err
+		}
+	default:
+		switch expr.Operator {
+		case "+":
+			g.emit("addq %rcx, %rax")
+		case "-":
+			g.emit("subq %rcx, %rax")
+		case "*":
+			g.emit("imulq %rcx, %rax")
+		case "/":
+			g.emit("movq %rax, %rdi")
+			g.emit("movq %rcx, %rsi")
+			g.emit("call tb_divide")
+		default:
+			set, found := integerComparisons[expr.Operator]
+			if !found {
+				return fmt.Errorf("unsupported operator '%s'", expr.Operator)
+			}
+			g.emit("cmpq %rcx, %rax")
+			g.emitSet(set)
+		}
+	}
+
+	g.emit("pushq %rax")
+	return nil
+}
+
+// generateFloatOperation applies an operator to the floats in %rax and %rcx
+// and leaves the result in %rax.
+func (g *generator) generateFloatOperation(operator string) error {
+	g.emit("movq %rax, %xmm0")
+	g.emit("movq %rcx, %xmm1")
+
+	switch operator {
+	case "+":
+		g.emit("addsd %xmm1, %xmm0")
+	case "-":
+		g.emit("subsd %xmm1, %xmm0")
+	case "*":
+		g.emit("mulsd %xmm1, %xmm0")
+	case "/":
+		g.emit("divsd %xmm1, %xmm0")
+	case "==":
+		// Unordered operands (NaN) set the parity flag and compare unequal
+		g.emit("ucomisd %xmm1, %xmm0")
+		g.emit("sete %al")
+		g.emit("setnp %cl")
+		g.emit("andb %cl, %al")
+		g.emit("movzbq %al, %rax")
+		return nil
+	case "<":
+		g.emit("ucomisd %xmm0, %xmm1")
+		g.emitSet("seta")
+		return nil
+	case ">":
+		g.emit("ucomisd %xmm1, %xmm0")
+		g.emitSet("seta")
+		return nil
+	default:
+		return fmt.Errorf("unsupported operator '%s'", operator)
+	}
+
+	g.emit("movq %xmm0, %rax")
+	return nil
+}
+
+func (g *generator) emitSet(set string) {
+	g.emit(set + " %al")
+	g.emit("movzbq %al, %rax")
+}
+
+// generateDataPool emits the DATA values as a table of tagged 8 byte values.
+func (g *generator) generateDataPool(pool []ast.Expression) (string, error) {
+	var out strings.Builder
+	out.WriteString("\n\t.data\n\t.balign 8\ntb_data_count:\n")
+	out.WriteString(fmt.Sprintf("\t.quad %d\ntb_data:\n", len(pool)))
+
+	for _, value := range pool {
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			out.WriteString(fmt.Sprintf("\t.quad %d, %d\n", tagInteger, value.Value))
+		case *ast.FloatLiteral:
+			out.WriteString(fmt.Sprintf("\t.quad %d, %d\t# %s\n", tagFloat, int64(math.Float64bits(value.Value)), backend.FloatLiteral(value.Value)))
+		case *ast.StringLiteral:
+			out.WriteString(fmt.Sprintf("\t.quad %d, %s\n", tagString, g.stringLabel(value.Value)))
+		default:
+			return "", fmt.Errorf("unsupported DATA value %T", value)
+		}
+	}
+	return out.String(), nil
+}
+
+// binaryOperands returns the type both operands are converted to.
+func binaryOperands(left semantic.Type, right semantic.Type) semantic.Type {
+	switch {
+	case left == semantic.Unknown:
+		return right
+	case right == semantic.Unknown || left == right:
+		return left
+	}
+	// Semantic analysis only lets integers and floats mix
+	return semantic.Float
+}
+
+// variable returns the symbol of the 8 byte cell holding a BASIC variable.
+// The prefix keeps variables apart from the runtime and libc symbols.
+func variable(name string) string {
+	return "tb_var_" + backend.Identifier(name, nil)
+}
+
+func valueTag(t semantic.Type) int {
+	switch t {
+	case semantic.Float:
+		return tagFloat
+	case semantic.String:
+		return tagString
+	default:
+		return tagInteger
+	}
+}
+
+// gasString quotes a string for the .string directive, with octal escapes
+// for the bytes the assembler would otherwise interpret.
+func gasString(value string) string {
+	var out strings.Builder
+	out.WriteString("\"")
+	for _, b := range []byte(value) {
+		switch {
+		case b == '"' || b == '\\':
+			out.WriteString("\\" + string(b))
+		case b < 0x20 || b >= 0x7f:
+			out.WriteString(fmt.Sprintf("\\%03o", b))
+		default:
+			out.WriteByte(b)
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
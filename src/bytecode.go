@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"tiny-basic/src/bytecode"
+)
+
+// runBytecode executes a program compiled with -target=bytecode.
+func runBytecode(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	limit := flags.Int("limit", 0, "maximum number of instructions to execute, 0 for no limit")
+	flags.Parse(args)
+
+	program, err := loadBytecode(flags, "output.tbc")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	vm := bytecode.NewVM(program, os.Stdout)
+	vm.Limit = *limit
+	if err := vm.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// disassemble prints the content of a bytecode file.
+func disassemble(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Parse(args)
+
+	program, err := loadBytecode(flags, "output.tbc")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	listing, err := bytecode.Disassemble(program)
+	fmt.Print(listing)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func loadBytecode(flags *flag.FlagSet, defaultFile string) (*bytecode.Program, error) {
+	file := defaultFile
+	if flags.NArg() > 0 {
+		file = flags.Arg(0)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file: %w", err)
+	}
+
+	program := &bytecode.Program{}
+	if err := program.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("Error loading %s: %w", file, err)
+	}
+	return program, nil
+}
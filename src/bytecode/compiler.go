@@ -0,0 +1,236 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/semantic"
+)
+
+// compiler translates the statements of a program into instructions for the
+// VM. Every variable gets a slot, in the alphabetical order of their names.
+type compiler struct {
+	program   *Program
+	types     *semantic.Types
+	slots     map[string]int
+	constants map[Value]int
+}
+
+// Compile translates a program that passed semantic analysis into bytecode.
+func Compile(program *ast.Program, types *semantic.Types) (*Program, error) {
+	c := &compiler{
+		program:   &Program{},
+		types:     types,
+		slots:     make(map[string]int),
+		constants: make(map[Value]int),
+	}
+	for _, name := range types.Variables() {
+		c.slots[name] = len(c.program.Slots)
+		c.program.Slots = append(c.program.Slots, name)
+	}
+
+	for _, value := range semantic.CollectData(program) {
+		constant, err := c.literal(value)
+		if err != nil {
+			return nil, err
+		}
+		c.program.Data = append(c.program.Data, c.constant(constant))
+	}
+
+	for _, stmt := range program.Statements {
+		if err := c.compileStatement(stmt); err != nil {
+			return nil, err
+		}
+	}
+	c.emit(OpHalt)
+
+	if len(c.program.Constants) > 0xFFFF || len(c.program.Slots) > 0xFFFF {
+		return nil, fmt.Errorf("program has too many constants or variables for the bytecode format")
+	}
+	return c.program, nil
+}
+
+func (c *compiler) emit(op Opcode) {
+	c.program.Code = append(c.program.Code, byte(op))
+}
+
+// emitOperand writes an instruction and returns the address of its operand.
+func (c *compiler) emitOperand(op Opcode, operand int) int {
+	c.emit(op)
+	address := len(c.program.Code)
+	switch op.operandWidth() {
+	case 1:
+		c.program.Code = append(c.program.Code, byte(operand))
+	case 2:
+		c.program.Code = binary.LittleEndian.AppendUint16(c.program.Code, uint16(operand))
+	case 4:
+		c.program.Code = binary.LittleEndian.AppendUint32(c.program.Code, uint32(operand))
+	}
+	return address
+}
+
+// patch points the jump whose operand is at address to the next instruction.
+func (c *compiler) patch(address int) {
+	binary.LittleEndian.PutUint32(c.program.Code[address:], uint32(len(c.program.Code)))
+}
+
+func (c *compiler) constant(value Value) int {
+	if index, found := c.constants[value]; found {
+		return index
+	}
+	c.constants[value] = len(c.program.Constants)
+	c.program.Constants = append(c.program.Constants, value)
+	return len(c.program.Constants) - 1
+}
+
+func (c *compiler) literal(expr ast.Expression) (Value, error) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return IntegerValue(int64(expr.Value)), nil
+	case *ast.FloatLiteral:
+		return FloatValue(expr.Value), nil
+	case *ast.StringLiteral:
+		return StringValue(expr.Value), nil
+	}
+	return Value{}, fmt.Errorf("unsupported literal %T", expr)
+}
+
+func (c *compiler) compileStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		if err := c.compileExpression(stmt.Expression, c.types.Of(stmt.Expression)); err != nil {
+			return err
+		}
+		c.emit(OpPrint)
+	case *ast.LetStatement:
+		return c.compileAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.AssignmentStatement:
+		return c.compileAssignment(stmt.Identifier.Name, stmt.Value)
+	case *ast.IfStatement:
+		return c.compileIfStatement(stmt)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(stmt)
+	case *ast.EndStatement:
+		c.emit(OpHalt)
+	case *ast.CommentStatement, *ast.DataStatement:
+		// DATA values are collected into the pool by Compile
+	case *ast.ReadStatement:
+		for _, identifier := range stmt.Identifiers {
+			kind := Integer
+			switch c.types.Variable(identifier.Name) {
+			case semantic.Float:
+				kind = Float
+			case semantic.String:
+				kind = String
+			}
+			c.emitOperand(OpRead, int(kind))
+			c.emitOperand(OpStore, c.slots[identifier.Name])
+		}
+	case *ast.RestoreStatement:
+		c.emit(OpRestore)
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (c *compiler) compileAssignment(name string, value ast.Expression) error {
+	if err := c.compileExpression(value, c.types.Variable(name)); err != nil {
+		return err
+	}
+	c.emitOperand(OpStore, c.slots[name])
+	return nil
+}
+
+func (c *compiler) compileIfStatement(stmt *ast.IfStatement) error {
+	if err := c.compileExpression(stmt.Condition, semantic.Boolean); err != nil {
+		return err
+	}
+	elseJump := c.emitOperand(OpJumpIfFalse, 0)
+	if err := c.compileStatement(stmt.ThenBranch); err != nil {
+		return err
+	}
+
+	if stmt.ElseBranch == nil {
+		c.patch(elseJump)
+		return nil
+	}
+
+	endJump := c.emitOperand(OpJump, 0)
+	c.patch(elseJump)
+	if err := c.compileStatement(stmt.ElseBranch); err != nil {
+		return err
+	}
+	c.patch(endJump)
+	return nil
+}
+
+func (c *compiler) compileWhileStatement(stmt *ast.WhileStatement) error {
+	top := len(c.program.Code)
+	if err := c.compileExpression(stmt.Condition, semantic.Boolean); err != nil {
+		return err
+	}
+	exitJump := c.emitOperand(OpJumpIfFalse, 0)
+	for _, statement := range stmt.DoBranch {
+		if err := c.compileStatement(statement); err != nil {
+			return err
+		}
+	}
+	c.emitOperand(OpJump, top)
+	c.patch(exitJump)
+	return nil
+}
+
+// compileExpression pushes the value of expr, converted to a float when an
+// integer is used where want is a float.
+func (c *compiler) compileExpression(expr ast.Expression, want semantic.Type) error {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		c.emitOperand(OpLoad, c.slots[expr.Name])
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		value, err := c.literal(expr)
+		if err != nil {
+			return err
+		}
+		c.emitOperand(OpConst, c.constant(value))
+	case *ast.BinaryExpression:
+		if err := c.compileBinaryExpression(expr); err != nil {
+			return err
+		}
+	default:
+		return &ast.UnsupportedError{Node: expr}
+	}
+
+	if want == semantic.Float && c.types.Of(expr) == semantic.Integer {
+		c.emit(OpToFloat)
+	}
+	return nil
+}
+
+var binaryOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+}
+
+func (c *compiler) compileBinaryExpression(expr *ast.BinaryExpression) error {
+	op, found := binaryOpcodes[expr.Operator]
+	if !found {
+		return fmt.Errorf("unsupported operator '%s'", expr.Operator)
+	}
+
+	// The VM promotes an integer operand when the other one is a float, so
+	// the operands keep their own type
+	if err := c.compileExpression(expr.Left, c.types.Of(expr.Left)); err != nil {
+		return err
+	}
+	if err := c.compileExpression(expr.Right, c.types.Of(expr.Right)); err != nil {
+		return err
+	}
+	c.emit(op)
+	return nil
+}
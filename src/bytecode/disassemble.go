@@ -0,0 +1,67 @@
+package bytecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Disassemble lists the constant pool, the variable slots, the DATA pool and
+// the instructions of a program, one per line.
+func Disassemble(p *Program) (string, error) {
+	var out strings.Builder
+
+	out.WriteString("constants:\n")
+	for i, constant := range p.Constants {
+		out.WriteString(fmt.Sprintf("  %4d  %-7s %s\n", i, constant.Kind, describe(constant)))
+	}
+
+	out.WriteString("slots:\n")
+	for i, slot := range p.Slots {
+		out.WriteString(fmt.Sprintf("  %4d  %s\n", i, slot))
+	}
+
+	if len(p.Data) > 0 {
+		out.WriteString("data:\n")
+		for i, index := range p.Data {
+			out.WriteString(fmt.Sprintf("  %4d  #%d\n", i, index))
+		}
+	}
+
+	out.WriteString("code:\n")
+	for address := 0; address < len(p.Code); {
+		op, operand, next, err := decodeInstruction(p.Code, address)
+		if err != nil {
+			return out.String(), err
+		}
+
+		line := fmt.Sprintf("  %04d  %s", address, op)
+		switch op {
+		case OpConst:
+			line += fmt.Sprintf(" #%d", operand)
+			if operand < len(p.Constants) {
+				line += "  ; " + describe(p.Constants[operand])
+			}
+		case OpLoad, OpStore:
+			line += fmt.Sprintf(" %d", operand)
+			if operand < len(p.Slots) {
+				line += "  ; " + p.Slots[operand]
+			}
+		case OpJump, OpJumpIfFalse:
+			line += fmt.Sprintf(" %04d", operand)
+		case OpRead:
+			line += " " + Kind(operand).String()
+		}
+		out.WriteString(line + "\n")
+		address = next
+	}
+
+	return out.String(), nil
+}
+
+func describe(value Value) string {
+	if value.Kind == String {
+		return strconv.Quote(value.Text)
+	}
+	return value.Format()
+}
@@ -0,0 +1,104 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Opcode is the first byte of every instruction. Its operand, if any,
+// follows as a little endian unsigned integer of operandWidth bytes.
+type Opcode byte
+
+const (
+	// OpConst pushes the constant at the index given by its operand.
+	OpConst Opcode = iota
+	// OpLoad pushes the value of a variable slot.
+	OpLoad
+	// OpStore pops a value into a variable slot.
+	OpStore
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpLess
+	OpGreater
+	// OpToFloat converts the integer on top of the stack to a float.
+	OpToFloat
+	// OpJump continues at the address given by its operand.
+	OpJump
+	// OpJumpIfFalse pops a boolean and jumps when it is false.
+	OpJumpIfFalse
+	OpPrint
+	// OpRead pushes the next DATA value. Its operand is the Kind the value
+	// is read as.
+	OpRead
+	OpRestore
+	OpHalt
+	opcodeCount
+)
+
+var opcodeNames = [opcodeCount]string{
+	OpConst:       "CONST",
+	OpLoad:        "LOAD",
+	OpStore:       "STORE",
+	OpAdd:         "ADD",
+	OpSub:         "SUB",
+	OpMul:         "MUL",
+	OpDiv:         "DIV",
+	OpEqual:       "EQUAL",
+	OpLess:        "LESS",
+	OpGreater:     "GREATER",
+	OpToFloat:     "TOFLOAT",
+	OpJump:        "JUMP",
+	OpJumpIfFalse: "JUMPIFFALSE",
+	OpPrint:       "PRINT",
+	OpRead:        "READ",
+	OpRestore:     "RESTORE",
+	OpHalt:        "HALT",
+}
+
+func (op Opcode) String() string {
+	if op < opcodeCount {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP(%d)", byte(op))
+}
+
+// operandWidth returns the size in bytes of the operand of op.
+func (op Opcode) operandWidth() int {
+	switch op {
+	case OpConst, OpLoad, OpStore:
+		return 2
+	case OpJump, OpJumpIfFalse:
+		return 4
+	case OpRead:
+		return 1
+	}
+	return 0
+}
+
+// decodeInstruction returns the opcode and operand of the instruction at
+// address, and the address of the next instruction.
+func decodeInstruction(code []byte, address int) (Opcode, int, int, error) {
+	op := Opcode(code[address])
+	if op >= opcodeCount {
+		return op, 0, 0, fmt.Errorf("invalid opcode %d at %04d", byte(op), address)
+	}
+
+	next := address + 1 + op.operandWidth()
+	if next > len(code) {
+		return op, 0, 0, fmt.Errorf("truncated %s instruction at %04d", op, address)
+	}
+
+	operand := 0
+	switch op.operandWidth() {
+	case 1:
+		operand = int(code[address+1])
+	case 2:
+		operand = int(binary.LittleEndian.Uint16(code[address+1:]))
+	case 4:
+		operand = int(binary.LittleEndian.Uint32(code[address+1:]))
+	}
+	return op, operand, next, nil
+}
@@ -0,0 +1,209 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Magic and Version start every serialized program.
+const (
+	Magic   = "TBBC"
+	Version = 1
+)
+
+// Program is a compiled Tiny BASIC program.
+type Program struct {
+	// Constants is the constant pool referenced by OpConst.
+	Constants []Value
+	// Slots holds the BASIC name of every variable slot.
+	Slots []string
+	// Data holds the constant pool indexes of the DATA values, in the order
+	// READ consumes them.
+	Data []int
+	Code []byte
+}
+
+// MarshalBinary serializes the program. All integers are little endian:
+//
+//	magic    "TBBC"
+//	version  u16
+//	constants u32 count, then per constant a kind byte and an i64, an f64
+//	         or a u32 length followed by the UTF-8 bytes of a string
+//	slots    u16 count, then per slot a u16 length and the name
+//	data     u32 count, then a u32 constant index per value
+//	code     u32 length, then the instructions
+func (p *Program) MarshalBinary() ([]byte, error) {
+	out := []byte(Magic)
+	out = binary.LittleEndian.AppendUint16(out, Version)
+
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(p.Constants)))
+	for _, constant := range p.Constants {
+		out = append(out, byte(constant.Kind))
+		switch constant.Kind {
+		case Integer:
+			out = binary.LittleEndian.AppendUint64(out, uint64(constant.Int))
+		case Float:
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(constant.Float))
+		case String:
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(constant.Text)))
+			out = append(out, constant.Text...)
+		default:
+			return nil, fmt.Errorf("cannot serialize %s constant", constant.Kind)
+		}
+	}
+
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(p.Slots)))
+	for _, slot := range p.Slots {
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(slot)))
+		out = append(out, slot...)
+	}
+
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(p.Data)))
+	for _, index := range p.Data {
+		out = binary.LittleEndian.AppendUint32(out, uint32(index))
+	}
+
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(p.Code)))
+	return append(out, p.Code...), nil
+}
+
+var errTruncated = errors.New("truncated bytecode file")
+
+// UnmarshalBinary reads a program serialized by MarshalBinary and checks
+// that its instructions only refer to existing constants, slots and
+// addresses, so the VM can run files it did not compile.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	r := &reader{data: data}
+
+	if string(r.bytes(len(Magic))) != Magic {
+		return errors.New("not a Tiny BASIC bytecode file")
+	}
+	if version := r.uint16(); r.err == nil && version != Version {
+		return fmt.Errorf("unsupported bytecode version %d, expected %d", version, Version)
+	}
+
+	p.Constants = nil
+	for count := r.uint32(); count > 0 && r.err == nil; count-- {
+		kind := Kind(r.byte())
+		switch kind {
+		case Integer:
+			p.Constants = append(p.Constants, IntegerValue(int64(r.uint64())))
+		case Float:
+			p.Constants = append(p.Constants, FloatValue(math.Float64frombits(r.uint64())))
+		case String:
+			p.Constants = append(p.Constants, StringValue(string(r.bytes(int(r.uint32())))))
+		default:
+			return fmt.Errorf("invalid constant kind %d", kind)
+		}
+	}
+
+	p.Slots = nil
+	for count := r.uint16(); count > 0 && r.err == nil; count-- {
+		p.Slots = append(p.Slots, string(r.bytes(int(r.uint16()))))
+	}
+
+	p.Data = nil
+	for count := r.uint32(); count > 0 && r.err == nil; count-- {
+		p.Data = append(p.Data, int(r.uint32()))
+	}
+
+	p.Code = r.bytes(int(r.uint32()))
+	if r.err != nil {
+		return r.err
+	}
+	if r.offset != len(data) {
+		return errors.New("unexpected data after the code section")
+	}
+	return p.verify()
+}
+
+func (p *Program) verify() error {
+	for _, index := range p.Data {
+		if index >= len(p.Constants) {
+			return fmt.Errorf("DATA value refers to missing constant %d", index)
+		}
+	}
+
+	// Jumps must land on the start of an instruction or at the end of the code
+	starts := map[int]bool{len(p.Code): true}
+	for address := 0; address < len(p.Code); {
+		_, _, next, err := decodeInstruction(p.Code, address)
+		if err != nil {
+			return err
+		}
+		starts[address] = true
+		address = next
+	}
+
+	for address := 0; address < len(p.Code); {
+		op, operand, next, _ := decodeInstruction(p.Code, address)
+
+		switch op {
+		case OpConst:
+			if operand >= len(p.Constants) {
+				return fmt.Errorf("%s at %04d refers to missing constant %d", op, address, operand)
+			}
+		case OpLoad, OpStore:
+			if operand >= len(p.Slots) {
+				return fmt.Errorf("%s at %04d refers to missing slot %d", op, address, operand)
+			}
+		case OpJump, OpJumpIfFalse:
+			if !starts[operand] {
+				return fmt.Errorf("%s at %04d jumps to invalid address %04d", op, address, operand)
+			}
+		case OpRead:
+			if Kind(operand) > String {
+				return fmt.Errorf("%s at %04d reads invalid kind %d", op, address, operand)
+			}
+		}
+		address = next
+	}
+	return nil
+}
+
+// reader decodes little endian values and remembers the first read past the
+// end of data.
+type reader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data)-r.offset {
+		r.err = errTruncated
+		return nil
+	}
+	r.offset += n
+	return r.data[r.offset-n : r.offset]
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
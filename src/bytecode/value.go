@@ -0,0 +1,124 @@
+package bytecode
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a Value. The constant pool only holds integers, floats
+// and strings; booleans are the result of comparisons.
+type Kind byte
+
+const (
+	Integer Kind = iota
+	Float
+	String
+	Boolean
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Integer:
+		return "integer"
+	case Float:
+		return "float"
+	case String:
+		return "string"
+	case Boolean:
+		return "boolean"
+	}
+	return "unknown"
+}
+
+// Value is a value on the stack of the VM, in a variable slot or in the
+// constant pool. Only the field matching Kind is meaningful.
+type Value struct {
+	Kind  Kind
+	Int   int64
+	Float float64
+	Text  string
+	Bool  bool
+}
+
+func IntegerValue(value int64) Value {
+	return Value{Kind: Integer, Int: value}
+}
+
+func FloatValue(value float64) Value {
+	return Value{Kind: Float, Float: value}
+}
+
+func StringValue(value string) Value {
+	return Value{Kind: String, Text: value}
+}
+
+func BooleanValue(value bool) Value {
+	return Value{Kind: Boolean, Bool: value}
+}
+
+// Format returns the text PRINT writes for the value, which is what the
+// JavaScript backend prints for it.
+func (v Value) Format() string {
+	switch v.Kind {
+	case Integer:
+		return strconv.FormatInt(v.Int, 10)
+	case Float:
+		return formatFloat(v.Float)
+	case Boolean:
+		return strconv.FormatBool(v.Bool)
+	}
+	return v.Text
+}
+
+// number returns the value as a float, for operations mixing integers and
+// floats.
+func (v Value) number() float64 {
+	if v.Kind == Integer {
+		return float64(v.Int)
+	}
+	return v.Float
+}
+
+// formatFloat formats a float like JavaScript's Number.prototype.toString.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "Infinity"
+	case math.IsInf(value, -1):
+		return "-Infinity"
+	case value == 0:
+		return "0"
+	}
+
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	mantissa, exponentText, _ := strings.Cut(strconv.FormatFloat(value, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	exponent, _ := strconv.Atoi(exponentText)
+	exponent++
+
+	switch {
+	case len(digits) <= exponent && exponent <= 21:
+		return sign + digits + strings.Repeat("0", exponent-len(digits))
+	case 0 < exponent && exponent <= 21:
+		return sign + digits[:exponent] + "." + digits[exponent:]
+	case -6 < exponent && exponent <= 0:
+		return sign + "0." + strings.Repeat("0", -exponent) + digits
+	}
+
+	result := sign + digits[:1]
+	if len(digits) > 1 {
+		result += "." + digits[1:]
+	}
+	if exponent > 0 {
+		return result + "e+" + strconv.Itoa(exponent-1)
+	}
+	return result + "e-" + strconv.Itoa(1-exponent)
+}
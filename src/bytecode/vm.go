@@ -0,0 +1,198 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInstructionLimit is returned by Run when the program executed more
+// instructions than the limit of the VM.
+var ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+// VM executes a Program.
+type VM struct {
+	program *Program
+	output  io.Writer
+	// Limit is the maximum number of instructions Run executes, 0 means no
+	// limit. It stops programs that never reach END.
+	Limit int
+
+	stack       []Value
+	slots       []Value
+	dataPointer int
+}
+
+func NewVM(program *Program, output io.Writer) *VM {
+	return &VM{program: program, output: output}
+}
+
+// Run executes the program from its first instruction until it halts or a
+// run time error occurs.
+func (vm *VM) Run() error {
+	vm.stack = vm.stack[:0]
+	vm.slots = make([]Value, len(vm.program.Slots))
+	vm.dataPointer = 0
+
+	code := vm.program.Code
+	executed := 0
+	for address := 0; address < len(code); {
+		if vm.Limit > 0 && executed >= vm.Limit {
+			return ErrInstructionLimit
+		}
+		executed++
+
+		op, operand, next, err := decodeInstruction(code, address)
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case OpConst:
+			vm.push(vm.program.Constants[operand])
+		case OpLoad:
+			vm.push(vm.slots[operand])
+		case OpStore:
+			vm.slots[operand] = vm.pop()
+		case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpLess, OpGreater:
+			right := vm.pop()
+			left := vm.pop()
+			result, err := binaryOperation(op, left, right)
+			if err != nil {
+				return fmt.Errorf("runtime error at %04d: %w", address, err)
+			}
+			vm.push(result)
+		case OpToFloat:
+			vm.push(FloatValue(vm.pop().number()))
+		case OpJump:
+			next = operand
+		case OpJumpIfFalse:
+			if condition := vm.pop(); condition.Kind != Boolean || !condition.Bool {
+				next = operand
+			}
+		case OpPrint:
+			if _, err := fmt.Fprintln(vm.output, vm.pop().Format()); err != nil {
+				return err
+			}
+		case OpRead:
+			value, err := vm.read(Kind(operand))
+			if err != nil {
+				return fmt.Errorf("runtime error at %04d: %w", address, err)
+			}
+			vm.push(value)
+		case OpRestore:
+			vm.dataPointer = 0
+		case OpHalt:
+			return nil
+		}
+		address = next
+	}
+	return nil
+}
+
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+// pop returns the value on top of the stack. Compiled code never pops an
+// empty stack; hand written code gets a zero value instead of a crash.
+func (vm *VM) pop() Value {
+	if len(vm.stack) == 0 {
+		return Value{}
+	}
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) read(kind Kind) (Value, error) {
+	if vm.dataPointer >= len(vm.program.Data) {
+		return Value{}, errors.New("out of data")
+	}
+	value := vm.program.Constants[vm.program.Data[vm.dataPointer]]
+	vm.dataPointer++
+
+	switch {
+	case value.Kind == kind:
+		return value, nil
+	case value.Kind == Integer && kind == Float:
+		return FloatValue(value.number()), nil
+	}
+	return Value{}, errors.New("type mismatch in READ")
+}
+
+// Apply applies a binary operator of the language to two values, with the
+// semantics of the VM.
+func Apply(operator string, left Value, right Value) (Value, error) {
+	op, found := binaryOpcodes[operator]
+	if !found {
+		return Value{}, fmt.Errorf("unsupported operator '%s'", operator)
+	}
+	return binaryOperation(op, left, right)
+}
+
+// binaryOperation applies an arithmetic or comparison instruction. Integer
+// operands are promoted to floats when the other operand is a float, and
+// integer division truncates toward zero.
+func binaryOperation(op Opcode, left Value, right Value) (Value, error) {
+	switch {
+	case left.Kind == String && right.Kind == String:
+		switch op {
+		case OpAdd:
+			return StringValue(left.Text + right.Text), nil
+		case OpEqual:
+			return BooleanValue(left.Text == right.Text), nil
+		case OpLess:
+			return BooleanValue(left.Text < right.Text), nil
+		case OpGreater:
+			return BooleanValue(left.Text > right.Text), nil
+		}
+
+	case left.Kind == Integer && right.Kind == Integer:
+		a, b := left.Int, right.Int
+		switch op {
+		case OpAdd:
+			return IntegerValue(a + b), nil
+		case OpSub:
+			return IntegerValue(a - b), nil
+		case OpMul:
+			return IntegerValue(a * b), nil
+		case OpDiv:
+			if b == 0 {
+				return Value{}, errors.New("division by zero")
+			}
+			return IntegerValue(a / b), nil
+		case OpEqual:
+			return BooleanValue(a == b), nil
+		case OpLess:
+			return BooleanValue(a < b), nil
+		case OpGreater:
+			return BooleanValue(a > b), nil
+		}
+
+	case isNumber(left) && isNumber(right):
+		a, b := left.number(), right.number()
+		switch op {
+		case OpAdd:
+			return FloatValue(a + b), nil
+		case OpSub:
+			return FloatValue(a - b), nil
+		case OpMul:
+			return FloatValue(a * b), nil
+		case OpDiv:
+			return FloatValue(a / b), nil
+		case OpEqual:
+			return BooleanValue(a == b), nil
+		case OpLess:
+			return BooleanValue(a < b), nil
+		case OpGreater:
+			return BooleanValue(a > b), nil
+		}
+	}
+
+	return Value{}, fmt.Errorf("%s cannot be applied to %s and %s", op, left.Kind, right.Kind)
+}
+
+func isNumber(value Value) bool {
+	return value.Kind == Integer || value.Kind == Float
+}
@@ -0,0 +1,204 @@
+// Package cfg builds the control-flow graph of a program: basic blocks of
+// statements executed one after the other, linked by the jumps of IF, WHILE
+// and END.
+package cfg
+
+import (
+	"tiny-basic/src/ast"
+)
+
+// Graph is the control-flow graph of a program. Entry and Exit hold no
+// statements: Entry leads to the first block, and Exit is reached by END or
+// by running past the last statement.
+type Graph struct {
+	Entry *Block
+	Exit  *Block
+	// Blocks lists every block in source order, Entry first and Exit last
+	Blocks []*Block
+}
+
+// Block is a basic block: its statements run in order, then its Branch, if
+// any, picks the successor. Blocks following an END that nothing jumps to
+// are kept, without predecessors, to show the code that never runs.
+type Block struct {
+	// ID numbers the blocks from 1 in source order. Entry and Exit are 0.
+	ID int
+	// Statements are PRINT, LET, assignments, READ, RESTORE and END.
+	// Comments and DATA, which do not run, are left out.
+	Statements []ast.Statement
+	// Branch is the IF or WHILE statement whose condition ends the block.
+	Branch     ast.Statement
+	Successors []Edge
+}
+
+// Edge is a jump from a block to a successor.
+type Edge struct {
+	To   *Block
+	Kind EdgeKind
+}
+
+// EdgeKind tells why control goes from a block to a successor.
+type EdgeKind string
+
+const (
+	// Next is control flowing into the following block
+	Next EdgeKind = ""
+	// Then and Else leave an IF for its branches. Without an ELSE branch the
+	// Else edge goes to the statement after the IF.
+	Then EdgeKind = "then"
+	Else EdgeKind = "else"
+	// True enters the body of a WHILE and False leaves the loop
+	True  EdgeKind = "true"
+	False EdgeKind = "false"
+	// Loop goes back from the end of a WHILE body to its condition
+	Loop EdgeKind = "loop"
+	// End goes from an END statement to the exit
+	End EdgeKind = "end"
+)
+
+func (b *Block) link(to *Block, kind EdgeKind) {
+	b.Successors = append(b.Successors, Edge{To: to, Kind: kind})
+}
+
+func (b *Block) empty() bool {
+	return len(b.Statements) == 0 && b.Branch == nil
+}
+
+// Build returns the control-flow graph of a parsed program. It fails on the
+// bad nodes of recovery mode, which do not say how control flows.
+func Build(program *ast.Program) (graph *Graph, err error) {
+	defer ast.Recover(&err)
+
+	b := &builder{graph: &Graph{Entry: &Block{}, Exit: &Block{}}}
+	b.graph.Blocks = []*Block{b.graph.Entry}
+	first := b.newBlock()
+	b.graph.Entry.link(first, Next)
+	if last := b.sequence(first, program.Statements); last != nil {
+		last.link(b.graph.Exit, Next)
+	}
+	b.graph.Blocks = append(b.graph.Blocks, b.graph.Exit)
+
+	b.graph.simplify()
+	for i, block := range b.graph.Blocks[1 : len(b.graph.Blocks)-1] {
+		block.ID = i + 1
+	}
+	return b.graph, nil
+}
+
+type builder struct {
+	graph *Graph
+}
+
+func (b *builder) newBlock() *Block {
+	block := &Block{}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+// linked returns a new block that from jumps to.
+func (b *builder) linked(from *Block, kind EdgeKind) *Block {
+	block := b.newBlock()
+	from.link(block, kind)
+	return block
+}
+
+// sequence adds statements to the graph, starting in the block current. It
+// returns the block control reaches after them, or nil when it never does.
+func (b *builder) sequence(current *Block, statements []ast.Statement) *Block {
+	for _, stmt := range statements {
+		if current == nil {
+			// Statements after an END start a block nothing jumps to
+			current = b.newBlock()
+		}
+		current = b.statement(current, stmt)
+	}
+	return current
+}
+
+func (b *builder) statement(current *Block, stmt ast.Statement) *Block {
+	switch stmt := stmt.(type) {
+	case *ast.CommentStatement, *ast.DataStatement:
+		return current
+	case *ast.PrintStatement, *ast.LetStatement, *ast.AssignmentStatement, *ast.ReadStatement, *ast.RestoreStatement:
+		current.Statements = append(current.Statements, stmt)
+		return current
+	case *ast.EndStatement:
+		current.Statements = append(current.Statements, stmt)
+		current.link(b.graph.Exit, End)
+		return nil
+	case *ast.IfStatement:
+		current.Branch = stmt
+		ends := []*Block{b.statement(b.linked(current, Then), stmt.ThenBranch)}
+		if stmt.ElseBranch != nil {
+			ends = append(ends, b.statement(b.linked(current, Else), stmt.ElseBranch))
+		}
+		join := b.newBlock()
+		if stmt.ElseBranch == nil {
+			current.link(join, Else)
+		}
+		for _, end := range ends {
+			if end != nil {
+				end.link(join, Next)
+			}
+		}
+		return join
+	case *ast.WhileStatement:
+		// The condition is a jump target, so it starts a block
+		header := current
+		if !current.empty() {
+			header = b.linked(current, Next)
+		}
+		header.Branch = stmt
+		if end := b.sequence(b.linked(header, True), stmt.DoBranch); end != nil {
+			end.link(header, Loop)
+		}
+		return b.linked(header, False)
+	}
+	panic(&ast.UnsupportedError{Node: stmt})
+}
+
+// simplify removes the empty blocks the builder leaves where branches join
+// and after loops, linking their predecessors to their successor, and the
+// empty blocks nothing jumps to.
+func (g *Graph) simplify() {
+	for changed := true; changed; {
+		changed = false
+		predecessors := g.predecessors()
+		for i, block := range g.Blocks {
+			if block == g.Entry || block == g.Exit || !block.empty() {
+				continue
+			}
+			if len(predecessors[block]) > 0 && (len(block.Successors) != 1 || block.Successors[0].To == block) {
+				continue
+			}
+
+			for _, predecessor := range predecessors[block] {
+				for j, edge := range predecessor.Successors {
+					if edge.To != block {
+						continue
+					}
+					predecessor.Successors[j].To = block.Successors[0].To
+					if edge.Kind == Next {
+						predecessor.Successors[j].Kind = block.Successors[0].Kind
+					}
+				}
+			}
+			g.Blocks = append(g.Blocks[:i], g.Blocks[i+1:]...)
+			changed = true
+			break
+		}
+	}
+}
+
+// predecessors returns the blocks jumping to every block.
+func (g *Graph) predecessors() map[*Block][]*Block {
+	predecessors := map[*Block][]*Block{}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			if len(predecessors[edge.To]) == 0 || predecessors[edge.To][len(predecessors[edge.To])-1] != block {
+				predecessors[edge.To] = append(predecessors[edge.To], block)
+			}
+		}
+	}
+	return predecessors
+}
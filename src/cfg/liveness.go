@@ -0,0 +1,103 @@
+package cfg
+
+import (
+	"sort"
+	"tiny-basic/src/ast"
+)
+
+// Live holds the variables live on entry to a block and on exit from it:
+// those whose current value may still be read on some path from there.
+type Live struct {
+	In  []string
+	Out []string
+}
+
+// Liveness computes the live variables of every block of a graph.
+func Liveness(g *Graph) map[*Block]Live {
+	in := map[*Block]map[string]bool{}
+	out := map[*Block]map[string]bool{}
+	for _, block := range g.Blocks {
+		in[block] = map[string]bool{}
+		out[block] = map[string]bool{}
+	}
+
+	// Liveness flows backwards, so visiting the blocks from the last one
+	// settles most of them in a single pass
+	for changed := true; changed; {
+		changed = false
+		for i := len(g.Blocks) - 1; i >= 0; i-- {
+			block := g.Blocks[i]
+			for _, edge := range block.Successors {
+				for name := range in[edge.To] {
+					out[block][name] = true
+				}
+			}
+			for name := range transfer(block, out[block]) {
+				if !in[block][name] {
+					in[block][name] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	live := map[*Block]Live{}
+	for _, block := range g.Blocks {
+		live[block] = Live{In: sorted(in[block]), Out: sorted(out[block])}
+	}
+	return live
+}
+
+// transfer returns the variables live on entry to a block from those live
+// on exit: the condition of the branch is evaluated last, and every
+// statement before it kills the variables it assigns and reads those of its
+// expressions.
+func transfer(block *Block, out map[string]bool) map[string]bool {
+	live := map[string]bool{}
+	for name := range out {
+		live[name] = true
+	}
+
+	switch branch := block.Branch.(type) {
+	case *ast.IfStatement:
+		use(live, branch.Condition)
+	case *ast.WhileStatement:
+		use(live, branch.Condition)
+	}
+	for i := len(block.Statements) - 1; i >= 0; i-- {
+		switch stmt := block.Statements[i].(type) {
+		case *ast.LetStatement:
+			delete(live, stmt.Identifier.Name)
+			use(live, stmt.Value)
+		case *ast.AssignmentStatement:
+			delete(live, stmt.Identifier.Name)
+			use(live, stmt.Value)
+		case *ast.ReadStatement:
+			for _, identifier := range stmt.Identifiers {
+				delete(live, identifier.Name)
+			}
+		case *ast.PrintStatement:
+			use(live, stmt.Expression)
+		}
+	}
+	return live
+}
+
+// use marks the variables an expression reads as live.
+func use(live map[string]bool, expr ast.Expression) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok {
+			live[identifier.Name] = true
+		}
+		return true
+	})
+}
+
+func sorted(set map[string]bool) []string {
+	names := []string{}
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/printer"
+)
+
+// Formats of graphs.
+const (
+	DOT     = "dot"
+	Mermaid = "mermaid"
+)
+
+// Write writes a graph in format, a Graphviz digraph or a Mermaid
+// flowchart. Every block shows its statements with their line numbers, and
+// the variables live on entry and exit when live is not nil.
+func Write(w io.Writer, g *Graph, format string, live map[*Block]Live) error {
+	var builder strings.Builder
+	switch format {
+	case DOT:
+		writeDOT(&builder, g, live)
+	case Mermaid:
+		writeMermaid(&builder, g, live)
+	default:
+		return fmt.Errorf("unknown format '%s', expected %s or %s", format, DOT, Mermaid)
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func writeDOT(builder *strings.Builder, g *Graph, live map[*Block]Live) {
+	builder.WriteString("digraph CFG {\n")
+	builder.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for _, block := range g.Blocks {
+		if block == g.Entry || block == g.Exit {
+			fmt.Fprintf(builder, "  %s [label=\"%s\", shape=oval];\n", name(g, block), lines(g, block, live)[0])
+			continue
+		}
+		// \l ends left-aligned lines
+		label := ""
+		for _, line := range lines(g, block, live) {
+			label += dotEscape(line) + `\l`
+		}
+		fmt.Fprintf(builder, "  %s [label=\"%s\"];\n", name(g, block), label)
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			attributes := ""
+			switch {
+			case edge.Kind == Loop:
+				attributes = fmt.Sprintf(" [label=\"%s\", style=dashed]", edge.Kind)
+			case edge.Kind != Next:
+				attributes = fmt.Sprintf(" [label=\"%s\"]", edge.Kind)
+			}
+			fmt.Fprintf(builder, "  %s -> %s%s;\n", name(g, block), name(g, edge.To), attributes)
+		}
+	}
+	builder.WriteString("}\n")
+}
+
+func writeMermaid(builder *strings.Builder, g *Graph, live map[*Block]Live) {
+	builder.WriteString("flowchart TD\n")
+	for _, block := range g.Blocks {
+		escaped := []string{}
+		for _, line := range lines(g, block, live) {
+			escaped = append(escaped, mermaidEscape(line))
+		}
+		label := strings.Join(escaped, "<br/>")
+		if block == g.Entry || block == g.Exit {
+			fmt.Fprintf(builder, "    %s([\"%s\"])\n", name(g, block), label)
+			continue
+		}
+		fmt.Fprintf(builder, "    %s[\"%s\"]\n", name(g, block), label)
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			switch {
+			case edge.Kind == Loop:
+				fmt.Fprintf(builder, "    %s -.->|%s| %s\n", name(g, block), edge.Kind, name(g, edge.To))
+			case edge.Kind != Next:
+				fmt.Fprintf(builder, "    %s -->|%s| %s\n", name(g, block), edge.Kind, name(g, edge.To))
+			default:
+				fmt.Fprintf(builder, "    %s --> %s\n", name(g, block), name(g, edge.To))
+			}
+		}
+	}
+}
+
+// name returns the identifier of a block in the output.
+func name(g *Graph, block *Block) string {
+	switch block {
+	case g.Entry:
+		return "entry"
+	case g.Exit:
+		return "exit"
+	}
+	return fmt.Sprintf("b%d", block.ID)
+}
+
+// lines returns the text of a block: its name, its statements and branch
+// prefixed with their line, and its live variables.
+func lines(g *Graph, block *Block, live map[*Block]Live) []string {
+	text := []string{}
+	switch block {
+	case g.Entry:
+		text = append(text, "ENTRY")
+	case g.Exit:
+		text = append(text, "EXIT")
+	default:
+		text = append(text, fmt.Sprintf("B%d", block.ID))
+	}
+
+	for _, stmt := range block.Statements {
+		program := &ast.Program{Statements: []ast.Statement{stmt}}
+		text = append(text, fmt.Sprintf("%d: %s", ast.PositionOf(stmt).Line, strings.TrimSuffix(printer.Print(program), "\n")))
+	}
+	switch branch := block.Branch.(type) {
+	case *ast.IfStatement:
+		text = append(text, fmt.Sprintf("%d: IF %s THEN", branch.Pos.Line, printer.Expression(branch.Condition)))
+	case *ast.WhileStatement:
+		text = append(text, fmt.Sprintf("%d: WHILE %s DO", branch.Pos.Line, printer.Expression(branch.Condition)))
+	}
+
+	if live != nil && block != g.Entry && block != g.Exit {
+		text = append(text, strings.TrimSpace("live in: "+strings.Join(live[block].In, ", ")), strings.TrimSpace("live out: "+strings.Join(live[block].Out, ", ")))
+	}
+	return text
+}
+
+// dotEscape escapes text for a double-quoted DOT string.
+func dotEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text)
+}
+
+// mermaidEscape replaces the characters Mermaid gives a meaning to in
+// labels with entity codes.
+func mermaidEscape(text string) string {
+	return strings.NewReplacer("#", "#35;", `"`, "#quot;", "<", "#lt;", ">", "#gt;", "&", "#amp;").Replace(text)
+}
@@ -2,104 +2,372 @@ package codegen
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"tiny-basic/src/ast"
+	"tiny-basic/src/semantic"
 )
 
 type CodeGenerator struct {
-	builder          strings.Builder
-	indentationLevel int
+	out      *writer
+	names    *nameTable
+	mappings []Mapping
+	types    *semantic.Types
+	options  Options
+}
+
+// Mapping links a position in the generated JavaScript to the Tiny BASIC
+// source it came from. Lines and columns are 0-based on the JavaScript side,
+// like in source maps, and 1-based on the BASIC side, like in the tokenizer.
+// Name is set when the mapping points at a variable.
+type Mapping struct {
+	GeneratedLine   int
+	GeneratedColumn int
+	Source          ast.Position
+	Name            string
 }
 
 func NewCodeGenerator() *CodeGenerator {
-	return &CodeGenerator{}
+	return NewCodeGeneratorWithOptions(Options{})
+}
+
+func NewCodeGeneratorWithOptions(options Options) *CodeGenerator {
+	if options.Mode == "" {
+		options.Mode = NodeScript
+	}
+	return &CodeGenerator{names: newNameTable(), options: options, out: &writer{compact: options.Minify}}
 }
 
-func (cg *CodeGenerator) Generate(program *ast.Program) string {
+// Generate returns the JavaScript for a program that passed semantic
+// analysis. It fails on node types the generator does not handle.
+func (cg *CodeGenerator) Generate(program *ast.Program) (code string, err error) {
+	defer ast.Recover(&err)
+
+	if cg.types, err = semantic.InferTypes(program); err != nil {
+		return "", err
+	}
+
+	cg.openWrapper()
+	if cg.usesIntegerDivision(program) {
+		cg.generateDivide()
+	}
+	if usesData(program.Statements) {
+		cg.generateDataPool(semantic.CollectData(program))
+	}
+	cg.generateDeclarations()
 	for _, stmt := range program.Statements {
-		cg.builder.WriteString(cg.generateStatement(stmt) + "\n")
+		cg.generateStatement(stmt)
+	}
+	cg.closeWrapper()
+
+	return cg.out.String(), nil
+}
+
+// Mappings returns the origin of every statement emitted by the last call to
+// Generate, in the order they appear in the JavaScript output.
+func (cg *CodeGenerator) Mappings() []Mapping {
+	return cg.mappings
+}
+
+// emit writes one line of JavaScript at the current indentation and records
+// that it was generated from the statement at pos.
+func (cg *CodeGenerator) emit(pos ast.Position, code string) {
+	line, column := cg.out.writeLine(code)
+	cg.mappings = append(cg.mappings, Mapping{GeneratedLine: line, GeneratedColumn: column, Source: pos})
+}
+
+// emitAssignment writes a line that assigns a variable and maps the variable
+// to its BASIC name, so debuggers can show the original identifier.
+func (cg *CodeGenerator) emitAssignment(pos ast.Position, identifier ast.Identifier, code string) {
+	line, column := cg.out.writeLine(code)
+	cg.mappings = append(cg.mappings,
+		Mapping{GeneratedLine: line, GeneratedColumn: column, Source: pos},
+		Mapping{GeneratedLine: line, GeneratedColumn: column, Source: identifier.Pos, Name: identifier.Name})
+}
+
+// emitComment writes a comment, which minified output leaves out.
+func (cg *CodeGenerator) emitComment(pos ast.Position, text string) {
+	if !cg.options.Minify {
+		cg.emit(pos, "//"+text)
+	}
+}
+
+// generateDeclarations declares every variable at the top of the program
+// with the zero value of its type. Variables belong to the whole program, as
+// in the other targets, while a let where LET appears would only reach the
+// end of the enclosing block.
+func (cg *CodeGenerator) generateDeclarations() {
+	for _, name := range cg.types.Variables() {
+		cg.out.writeLine(fmt.Sprintf("let %s = %s;", cg.names.mangle(name), zeroValue(cg.types.Variable(name))))
+	}
+}
+
+func zeroValue(t semantic.Type) string {
+	switch t {
+	case semantic.Integer:
+		return "0n"
+	case semantic.Float:
+		return "0"
+	case semantic.String:
+		return `""`
+	case semantic.Boolean:
+		return "false"
+	}
+	return "undefined"
+}
+
+// generateDataPool emits the static DATA pool together with the read pointer
+// and the helper that READ statements call to consume it. Every value is
+// stored with its type, which __read checks against the type of the target
+// variable as the other targets do.
+func (cg *CodeGenerator) generateDataPool(pool []ast.Expression) {
+	values := []string{}
+	for _, value := range pool {
+		values = append(values, fmt.Sprintf("[%q, %s]", dataType(cg.types.Of(value)), cg.generateExpression(value, false)))
 	}
 
-	return cg.builder.String()
+	cg.out.writeLine(fmt.Sprintf("const __data = [%s];", strings.Join(values, ", ")))
+	cg.out.writeLine("let __dataPtr = 0;")
+	cg.out.writeLine("function __read(type) {")
+	cg.out.indent()
+	cg.out.writeLine("if (__dataPtr >= __data.length) {")
+	cg.out.indent()
+	cg.out.writeLine(`throw new Error("out of data");`)
+	cg.out.dedent()
+	cg.out.writeLine("}")
+	cg.out.writeLine("const [valueType, value] = __data[__dataPtr++];")
+	cg.out.writeLine(`if (valueType === "integer" && type === "float") {`)
+	cg.out.indent()
+	cg.out.writeLine("return Number(value);")
+	cg.out.dedent()
+	cg.out.writeLine("}")
+	cg.out.writeLine("if (valueType !== type) {")
+	cg.out.indent()
+	cg.out.writeLine(`throw new Error("type mismatch in READ");`)
+	cg.out.dedent()
+	cg.out.writeLine("}")
+	cg.out.writeLine("return value;")
+	cg.out.dedent()
+	cg.out.writeLine("}")
+}
+
+// dataType names a type in the DATA pool and in the calls of __read.
+func dataType(t semantic.Type) string {
+	return strings.ToLower(t.String())
 }
 
-func (cg *CodeGenerator) generateStatement(stmt ast.Statement) string {
+// generateDivide emits the helper dividing integers. BigInt division
+// truncates toward zero but throws a RangeError on a zero divisor, which
+// fails with the message of the other targets instead.
+func (cg *CodeGenerator) generateDivide() {
+	cg.out.writeLine("function __divide(left, right) {")
+	cg.out.indent()
+	cg.out.writeLine("if (right === 0n) {")
+	cg.out.indent()
+	cg.out.writeLine(`throw new Error("division by zero");`)
+	cg.out.dedent()
+	cg.out.writeLine("}")
+	cg.out.writeLine("return BigInt.asIntN(64, left / right);")
+	cg.out.dedent()
+	cg.out.writeLine("}")
+}
+
+// usesIntegerDivision reports whether the program needs __divide.
+func (cg *CodeGenerator) usesIntegerDivision(program *ast.Program) bool {
+	found := false
+	ast.Inspect(program, func(node ast.Node) bool {
+		if expr, ok := node.(*ast.BinaryExpression); ok && cg.isIntegerDivision(expr) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (cg *CodeGenerator) isIntegerDivision(expr *ast.BinaryExpression) bool {
+	return expr.Operator == "/" && cg.types.Of(expr) == semantic.Integer
+}
+
+// usesData reports whether the statements need the DATA pool and __read.
+func usesData(statements []ast.Statement) bool {
+	found := false
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node.(type) {
+			case *ast.DataStatement, *ast.ReadStatement, *ast.RestoreStatement:
+				found = true
+			case ast.Expression:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+func (cg *CodeGenerator) generateStatement(stmt ast.Statement) {
 	switch stmt := stmt.(type) {
 	case *ast.PrintStatement:
-		return cg.generatePrintStatement(stmt)
+		cg.generatePrintStatement(stmt)
 	case *ast.IfStatement:
-		return cg.generateIfStatement(stmt)
+		cg.generateIfStatement(stmt)
 	case *ast.LetStatement:
-		return cg.generateLetStatement(stmt)
+		cg.generateLetStatement(stmt)
 	case *ast.WhileStatement:
-		return cg.generateWhileStatement(stmt)
+		cg.generateWhileStatement(stmt)
 	case *ast.AssignmentStatement:
-		return cg.generateAssignmentStatement(stmt)
+		cg.generateAssignmentStatement(stmt)
 	case *ast.EndStatement:
-		return "process.exit(0);"
+		cg.emit(stmt.Pos, cg.options.Mode.end())
 	case *ast.CommentStatement:
-		return "// " + stmt.Text
+		cg.emitComment(stmt.Pos, stmt.Text)
+	case *ast.DataStatement:
+		cg.generateDataStatement(stmt)
+	case *ast.ReadStatement:
+		cg.generateReadStatement(stmt)
+	case *ast.RestoreStatement:
+		cg.emit(stmt.Pos, "__dataPtr = 0;")
 	default:
-		return ""
+		panic(&ast.UnsupportedError{Node: stmt})
 	}
 }
 
-func (cg *CodeGenerator) generatePrintStatement(stmt *ast.PrintStatement) string {
-	return "console.log(" + cg.generateExpression(stmt.Expression, false) + ");"
+// generatePrintStatement prints integers as strings, since console.log would
+// add the "n" suffix of BigInt literals.
+func (cg *CodeGenerator) generatePrintStatement(stmt *ast.PrintStatement) {
+	value := cg.generateExpression(stmt.Expression, false)
+	if cg.types.Of(stmt.Expression) == semantic.Integer {
+		value = "String(" + value + ")"
+	}
+	cg.emit(stmt.Pos, cg.options.Mode.print()+"("+value+");")
 }
 
-func (cg *CodeGenerator) generateIfStatement(stmt *ast.IfStatement) string {
-	condition := cg.generateExpression(stmt.Condition, false)
-	thenBranch := cg.generateStatement(stmt.ThenBranch)
-	elseBranch := ""
+func (cg *CodeGenerator) generateIfStatement(stmt *ast.IfStatement) {
+	cg.emit(stmt.Pos, fmt.Sprintf("if (%s) {", cg.generateExpression(stmt.Condition, false)))
+	cg.generateBlock(stmt.ThenBranch)
 
 	if stmt.ElseBranch != nil {
-		elseBranch = fmt.Sprintf(" else {\n\t%s\n}", cg.generateStatement(stmt.ElseBranch))
+		cg.emit(stmt.Pos, "} else {")
+		cg.generateBlock(stmt.ElseBranch)
 	}
 
-	return fmt.Sprintf("if (%s) {\n\t%s\n}%s", condition, thenBranch, elseBranch)
+	cg.emit(stmt.Pos, "}")
 }
 
-func (cg *CodeGenerator) generateWhileStatement(stmt *ast.WhileStatement) string {
-	condition := cg.generateExpression(stmt.Condition, false)
-	cg.indentationLevel++
+func (cg *CodeGenerator) generateWhileStatement(stmt *ast.WhileStatement) {
+	cg.emit(stmt.Pos, fmt.Sprintf("while (%s) {", cg.generateExpression(stmt.Condition, false)))
+	cg.generateBlock(stmt.DoBranch...)
+	cg.emit(stmt.Pos, "}")
+}
 
-	doBranch := []string{}
-	for _, statement := range stmt.DoBranch {
-		doBranch = append(doBranch, fmt.Sprintf("%s%s", strings.Repeat("\t", cg.indentationLevel), cg.generateStatement(statement)))
+func (cg *CodeGenerator) generateBlock(statements ...ast.Statement) {
+	cg.out.indent()
+	for _, statement := range statements {
+		cg.generateStatement(statement)
 	}
+	cg.out.dedent()
+}
 
-	cg.indentationLevel--
-	return fmt.Sprintf("while (%s) {\n%s\n%s}",
-		condition,
-		strings.Join(doBranch, "\n"),
-		strings.Repeat("\t", cg.indentationLevel))
+// generateLetStatement assigns the variable, which generateDeclarations
+// declared with the program.
+func (cg *CodeGenerator) generateLetStatement(stmt *ast.LetStatement) {
+	cg.generateAssignment(stmt.Pos, stmt.Identifier, stmt.Value)
 }
 
-func (cg *CodeGenerator) generateLetStatement(stmt *ast.LetStatement) string {
-	return fmt.Sprintf("let %s = %s;", stmt.Identifier.Name, cg.generateExpression(stmt.Value, false))
+func (cg *CodeGenerator) generateAssignmentStatement(stmt *ast.AssignmentStatement) {
+	cg.generateAssignment(stmt.Pos, stmt.Identifier, stmt.Value)
 }
 
-func (cg *CodeGenerator) generateAssignmentStatement(stmt *ast.AssignmentStatement) string {
-	return fmt.Sprintf("%s = %s;", stmt.Identifier.Name, cg.generateExpression(stmt.Value, false))
+func (cg *CodeGenerator) generateAssignment(pos ast.Position, identifier ast.Identifier, value ast.Expression) {
+	code := cg.generateValue(value, cg.types.Variable(identifier.Name), false)
+	cg.emitAssignment(pos, identifier, fmt.Sprintf("%s = %s;", cg.names.mangle(identifier.Name), code))
+}
+
+// generateDataStatement writes the values of a DATA statement in a comment,
+// as they appear in the source.
+func (cg *CodeGenerator) generateDataStatement(stmt *ast.DataStatement) {
+	values := []string{}
+	for _, value := range stmt.Values {
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			values = append(values, strconv.Itoa(value.Value))
+		default:
+			values = append(values, cg.generateExpression(value, false))
+		}
+	}
+	cg.emitComment(stmt.Pos, " DATA "+strings.Join(values, ", "))
+}
+
+func (cg *CodeGenerator) generateReadStatement(stmt *ast.ReadStatement) {
+	reads := []string{}
+	for _, identifier := range stmt.Identifiers {
+		reads = append(reads, fmt.Sprintf("%s = __read(%q);", cg.names.mangle(identifier.Name), dataType(cg.types.Variable(identifier.Name))))
+	}
+	cg.emit(stmt.Pos, strings.Join(reads, " "))
 }
 
 func (cg *CodeGenerator) generateExpression(expr ast.Expression, addParentheses bool) string {
 	switch expr := expr.(type) {
 	case *ast.Identifier:
-		return expr.Name
+		return cg.names.mangle(expr.Name)
 	case *ast.FloatLiteral:
 		return fmt.Sprintf("%v", expr.Value)
 	case *ast.IntegerLiteral:
-		return fmt.Sprintf("%v", expr.Value)
+		return fmt.Sprintf("%dn", expr.Value)
+	case *ast.StringLiteral:
+		return strconv.Quote(expr.Value)
 	case *ast.BinaryExpression:
-		left := cg.generateExpression(expr.Left, true)
-		right := cg.generateExpression(expr.Right, true)
+		// BigInt and numbers do not mix, so an integer operand of a float
+		// operation is converted
+		operands := cg.types.Of(expr.Left)
+		if cg.types.Of(expr.Right) == semantic.Float {
+			operands = semantic.Float
+		}
+		if cg.types.Of(expr) == semantic.Integer {
+			left := cg.generateExpression(expr.Left, false)
+			right := cg.generateExpression(expr.Right, false)
+			if cg.isIntegerDivision(expr) {
+				return fmt.Sprintf("__divide(%s, %s)", left, right)
+			}
+			// BigInt values never overflow, so results are wrapped around to
+			// 64 bits
+			return fmt.Sprintf("BigInt.asIntN(64, %s %s %s)", left, expr.Operator, right)
+		}
+
+		left := cg.generateValue(expr.Left, operands, true)
+		right := cg.generateValue(expr.Right, operands, true)
 		if addParentheses {
 			return fmt.Sprintf("(%s %s %s)", left, expr.Operator, right)
 		}
 		return fmt.Sprintf("%s %s %s", left, expr.Operator, right)
 	default:
-		return "/* unsupported expression */"
+		panic(&ast.UnsupportedError{Node: expr})
 	}
 }
+
+// generateValue generates an expression used where a value of type want is
+// expected: integers become numbers where a float is expected.
+func (cg *CodeGenerator) generateValue(expr ast.Expression, want semantic.Type, addParentheses bool) string {
+	if want == semantic.Float && cg.types.Of(expr) == semantic.Integer {
+		if literal, ok := expr.(*ast.IntegerLiteral); ok {
+			return strconv.Itoa(literal.Value)
+		}
+		return "Number(" + cg.generateExpression(expr, false) + ")"
+	}
+	return cg.generateExpression(expr, addParentheses)
+}
+
+// Names returns the JavaScript name used for every BASIC variable of the
+// last generated program, sorted by the BASIC name.
+func (cg *CodeGenerator) Names() []NameMapping {
+	return cg.names.mappings()
+}
+
+// Expression returns the JavaScript for an expression over the variables of
+// the last generated program, as debuggers evaluate them in the running code.
+// The value has the type want, or the type of the expression when want is
+// Unknown.
+func (cg *CodeGenerator) Expression(expr ast.Expression, want semantic.Type) (code string, err error) {
+	defer ast.Recover(&err)
+	return cg.generateValue(expr, want, false), nil
+}
@@ -0,0 +1,123 @@
+package codegen
+
+import (
+	"fmt"
+)
+
+// Mode selects how the generated JavaScript is packaged.
+type Mode string
+
+const (
+	// NodeScript runs the program at the top level of a Node.js script,
+	// printing with console.log and ending with process.exit.
+	NodeScript Mode = "node"
+	// ESModule exports a run({print, input}) function. print defaults to
+	// console.log; input is accepted for programs reading from the host.
+	ESModule Mode = "module"
+	// Browser runs the program once the page is loaded and appends its
+	// output to the element with the id BrowserElement.
+	Browser Mode = "browser"
+)
+
+// BrowserElement is the id of the element browser bundles write to.
+const BrowserElement = "output"
+
+// Options configures a CodeGenerator.
+type Options struct {
+	// Mode defaults to NodeScript.
+	Mode Mode
+	// SourceFile, when set, is named in a header comment.
+	SourceFile string
+	// Strict adds a "use strict" directive. ES modules are always strict
+	// and do not need one.
+	Strict bool
+	// Minify writes the program without indentation, line breaks, optional
+	// spaces and comments, except for the header comment.
+	Minify bool
+}
+
+// ParseMode validates the name of an output mode. An empty name selects
+// NodeScript.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return NodeScript, nil
+	case NodeScript, ESModule, Browser:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown JavaScript mode '%s', expected %s, %s or %s", name, NodeScript, ESModule, Browser)
+}
+
+// openWrapper writes the header comment, the strict mode directive and the
+// code placed before the statements of the program.
+func (cg *CodeGenerator) openWrapper() {
+	if cg.options.SourceFile != "" {
+		cg.out.writeComment(" Generated by tiny-basic from " + cg.options.SourceFile)
+	}
+
+	switch cg.options.Mode {
+	case NodeScript:
+		cg.writeStrict()
+	case ESModule:
+		cg.out.writeLine("export function run({ print = console.log, input } = {}) {")
+		cg.out.indent()
+	case Browser:
+		cg.out.writeLine("(function () {")
+		cg.out.indent()
+		cg.writeStrict()
+		cg.out.writeLine("function run() {")
+		cg.out.indent()
+		cg.out.writeLine(fmt.Sprintf("const __output = document.getElementById(%q);", BrowserElement))
+		cg.out.writeLine("function print(value) {")
+		cg.out.indent()
+		cg.out.writeLine(`__output.append(value + "\n");`)
+		cg.out.dedent()
+		cg.out.writeLine("}")
+	}
+}
+
+// closeWrapper writes the code placed after the statements of the program.
+func (cg *CodeGenerator) closeWrapper() {
+	switch cg.options.Mode {
+	case ESModule:
+		cg.out.dedent()
+		cg.out.writeLine("}")
+	case Browser:
+		cg.out.dedent()
+		cg.out.writeLine("}")
+		cg.out.writeLine(`if (document.readyState === "loading") {`)
+		cg.out.indent()
+		cg.out.writeLine(`document.addEventListener("DOMContentLoaded", run);`)
+		cg.out.dedent()
+		cg.out.writeLine("} else {")
+		cg.out.indent()
+		cg.out.writeLine("run();")
+		cg.out.dedent()
+		cg.out.writeLine("}")
+		cg.out.dedent()
+		cg.out.writeLine("})();")
+	}
+}
+
+func (cg *CodeGenerator) writeStrict() {
+	if cg.options.Strict {
+		cg.out.writeLine(`"use strict";`)
+	}
+}
+
+// print returns the function PRINT calls.
+func (m Mode) print() string {
+	if m == NodeScript {
+		return "console.log"
+	}
+	return "print"
+}
+
+// end returns the statement END compiles to. Outside of Node the program is
+// the body of a function, so returning from it ends the program.
+func (m Mode) end() string {
+	if m == NodeScript {
+		return "process.exit(0);"
+	}
+	return "return;"
+}
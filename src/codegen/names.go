@@ -0,0 +1,90 @@
+package codegen
+
+import (
+	"sort"
+	"strings"
+)
+
+// reservedNames lists every JavaScript reserved word, literal and global that
+// a BASIC variable must not shadow, plus the helpers of the generated runtime.
+var reservedNames = map[string]bool{
+	// Keywords and future reserved words
+	"await": true, "break": true, "case": true, "catch": true, "class": true,
+	"const": true, "continue": true, "debugger": true, "default": true,
+	"delete": true, "do": true, "else": true, "enum": true, "export": true,
+	"extends": true, "finally": true, "for": true, "function": true, "if": true,
+	"implements": true, "import": true, "in": true, "instanceof": true,
+	"interface": true, "let": true, "new": true, "package": true,
+	"private": true, "protected": true, "public": true, "return": true,
+	"static": true, "super": true, "switch": true, "this": true, "throw": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true,
+	"with": true, "yield": true, "async": true, "of": true, "get": true,
+	"set": true,
+
+	// Literals and values that cannot be rebound safely
+	"null": true, "true": true, "false": true, "undefined": true, "NaN": true,
+	"Infinity": true, "arguments": true, "eval": true,
+
+	// Globals the generated program relies on or could break
+	"console": true, "process": true, "globalThis": true, "global": true,
+	"window": true, "document": true, "self": true, "require": true,
+	"module": true, "exports": true, "Math": true, "Number": true,
+	"String": true, "Object": true, "Array": true, "Error": true,
+	"Function": true, "Symbol": true, "Boolean": true, "JSON": true,
+	"Promise": true, "Reflect": true, "Proxy": true,
+
+	// Runtime helpers emitted by the code generator, and the names the
+	// module and browser wrappers define around the program
+	"__data": true, "__dataPtr": true, "__read": true, "__divide": true, "__output": true,
+	"run": true, "print": true, "input": true,
+}
+
+// NameMapping records the JavaScript name chosen for a BASIC variable.
+type NameMapping struct {
+	Generated string
+	Original  string
+}
+
+// nameTable mangles BASIC identifiers into JavaScript ones and remembers
+// every mapping it made. The scheme is deterministic and never collides:
+//   - a '$' (string) or '%' (integer) type suffix becomes "$s" or "$i",
+//     which is safe because BASIC names only contain '$' as their last rune;
+//   - a name that is reserved in JavaScript gets a leading '$', which no
+//     BASIC identifier can start with.
+type nameTable struct {
+	generated map[string]string
+}
+
+func newNameTable() *nameTable {
+	return &nameTable{generated: make(map[string]string)}
+}
+
+func (nt *nameTable) mangle(name string) string {
+	if generated, found := nt.generated[name]; found {
+		return generated
+	}
+
+	generated := name
+	switch {
+	case strings.HasSuffix(name, "$"):
+		generated = strings.TrimSuffix(name, "$") + "$s"
+	case strings.HasSuffix(name, "%"):
+		generated = strings.TrimSuffix(name, "%") + "$i"
+	case reservedNames[name]:
+		generated = "$" + name
+	}
+
+	nt.generated[name] = generated
+	return generated
+}
+
+func (nt *nameTable) mappings() []NameMapping {
+	mappings := []NameMapping{}
+	for original, generated := range nt.generated {
+		mappings = append(mappings, NameMapping{Generated: generated, Original: original})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Original < mappings[j].Original
+	})
+	return mappings
+}
@@ -0,0 +1,111 @@
+package codegen
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// SourceMap is a Source Map revision 3 document.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// SourceMap builds the source map of the last generated program. file is the
+// name of the JavaScript output, source the name and content of the .tb input.
+func (cg *CodeGenerator) SourceMap(file string, source string, content string) ([]byte, error) {
+	mappings := append([]Mapping{}, cg.mappings...)
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if mappings[i].GeneratedLine != mappings[j].GeneratedLine {
+			return mappings[i].GeneratedLine < mappings[j].GeneratedLine
+		}
+		return mappings[i].GeneratedColumn < mappings[j].GeneratedColumn
+	})
+
+	sourceMap := SourceMap{
+		Version:        3,
+		File:           file,
+		Sources:        []string{source},
+		SourcesContent: []string{content},
+		Names:          []string{},
+	}
+	nameIndexes := map[string]int{}
+
+	var builder strings.Builder
+	line, previousColumn, previousSourceLine, previousSourceColumn, previousName := 0, 0, 0, 0, 0
+	lineHasSegments := false
+	for _, mapping := range mappings {
+		if mapping.Source.Line == 0 {
+			continue
+		}
+
+		if mapping.GeneratedLine > line {
+			builder.WriteString(strings.Repeat(";", mapping.GeneratedLine-line))
+			line = mapping.GeneratedLine
+			previousColumn = 0
+			lineHasSegments = false
+		}
+		if lineHasSegments {
+			builder.WriteString(",")
+		}
+		lineHasSegments = true
+
+		sourceLine := mapping.Source.Line - 1
+		sourceColumn := mapping.Source.Column - 1
+		builder.WriteString(encodeVLQ(mapping.GeneratedColumn - previousColumn))
+		builder.WriteString(encodeVLQ(0))
+		builder.WriteString(encodeVLQ(sourceLine - previousSourceLine))
+		builder.WriteString(encodeVLQ(sourceColumn - previousSourceColumn))
+		previousColumn, previousSourceLine, previousSourceColumn = mapping.GeneratedColumn, sourceLine, sourceColumn
+
+		if mapping.Name != "" {
+			index, found := nameIndexes[mapping.Name]
+			if !found {
+				index = len(sourceMap.Names)
+				nameIndexes[mapping.Name] = index
+				sourceMap.Names = append(sourceMap.Names, mapping.Name)
+			}
+			builder.WriteString(encodeVLQ(index - previousName))
+			previousName = index
+		}
+	}
+	sourceMap.Mappings = builder.String()
+
+	return json.Marshal(sourceMap)
+}
+
+// InlineSourceMap returns the comment that embeds a source map in the
+// generated file as a data URL.
+func InlineSourceMap(sourceMap []byte) string {
+	return "//# sourceMappingURL=data:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(sourceMap)
+}
+
+// encodeVLQ encodes a value as a Base64 VLQ: the sign goes to the lowest bit
+// and the value is written in groups of five bits, least significant first.
+func encodeVLQ(value int) string {
+	vlq := value << 1
+	if value < 0 {
+		vlq = (-value << 1) | 1
+	}
+
+	encoded := ""
+	for {
+		digit := vlq & 31
+		vlq >>= 5
+		if vlq > 0 {
+			digit |= 32
+		}
+		encoded += string(base64Digits[digit])
+		if vlq == 0 {
+			return encoded
+		}
+	}
+}
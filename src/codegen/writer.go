@@ -0,0 +1,143 @@
+package codegen
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// writer builds the JavaScript output one line at a time, indenting every
+// line by the current nesting level and keeping track of the position of the
+// code it writes for source maps. In compact mode it drops the indentation,
+// the line breaks and the optional spaces, so the program ends up on a single
+// line.
+type writer struct {
+	builder strings.Builder
+	compact bool
+	level   int
+	line    int
+	column  int
+}
+
+func (w *writer) indent() {
+	w.level++
+}
+
+func (w *writer) dedent() {
+	w.level--
+}
+
+// writeLine writes one line of code and returns the 0-based line and column
+// where the code starts. Columns count UTF-16 code units, like JavaScript
+// engines do.
+func (w *writer) writeLine(code string) (int, int) {
+	if w.compact {
+		code = compactCode(code)
+	}
+	return w.write(code)
+}
+
+func (w *writer) write(code string) (int, int) {
+	if !w.compact {
+		indentation := strings.Repeat("\t", w.level)
+		w.builder.WriteString(indentation)
+		w.column += codeUnits(indentation)
+	}
+
+	line, column := w.line, w.column
+	w.builder.WriteString(code)
+	w.column += codeUnits(code)
+	if !w.compact {
+		w.newline()
+	}
+	return line, column
+}
+
+// writeComment writes a line comment. Line comments end at the line break,
+// so compact output breaks the line after them too.
+func (w *writer) writeComment(text string) {
+	if w.compact && w.column > 0 {
+		w.newline()
+	}
+	w.write("//" + text)
+	if w.compact {
+		w.newline()
+	}
+}
+
+func (w *writer) newline() {
+	w.builder.WriteString("\n")
+	w.line++
+	w.column = 0
+}
+
+// String returns the output, ending with a line break.
+func (w *writer) String() string {
+	if w.column > 0 {
+		w.newline()
+	}
+	return w.builder.String()
+}
+
+// codeUnits returns the length of code in UTF-16 code units, the unit of
+// columns in source maps.
+func codeUnits(code string) int {
+	units := 0
+	for _, r := range code {
+		units += utf16.RuneLen(r)
+	}
+	return units
+}
+
+// compactCode removes the spaces that JavaScript does not need from a line
+// of generated code: those next to punctuation, outside of string literals.
+// A space between two '+' or '-' signs stays, as "a - -1" must not become
+// "a--1".
+func compactCode(code string) string {
+	var out strings.Builder
+	var quote byte
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && i+1 < len(code) {
+				out.WriteByte(ch)
+				i++
+				ch = code[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'' || ch == '`':
+			quote = ch
+		case ch == ' ':
+			previous := lastByte(&out)
+			next := byte(0)
+			if i+1 < len(code) {
+				next = code[i+1]
+			}
+			if next == ' ' {
+				continue
+			}
+			if isIdentifierByte(previous) && isIdentifierByte(next) || isSign(previous) && isSign(next) {
+				break
+			}
+			continue
+		}
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
+
+func lastByte(out *strings.Builder) byte {
+	if out.Len() == 0 {
+		return 0
+	}
+	return out.String()[out.Len()-1]
+}
+
+func isIdentifierByte(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '$' || ch >= 0x80
+}
+
+func isSign(ch byte) bool {
+	return ch == '+' || ch == '-'
+}
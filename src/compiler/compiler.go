@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/optimizer"
+	"tiny-basic/src/parser"
+	"tiny-basic/src/semantic"
+	"tiny-basic/src/tokenizer"
+)
+
+// Result is what the front end knows about a program once it passed
+// semantic analysis, ready to be handed to a backend.
+type Result struct {
+	Program  *ast.Program
+	Analyzer *semantic.SemanticAnalyzer
+	Warnings []string
+}
+
+// Parse tokenizes and parses source. The parser reports errors by panicking,
+// Parse turns those panics into errors. Syntax errors are *parser.Error.
+func Parse(source string, options tokenizer.Options) (program *ast.Program, err error) {
+	tokens, err := tokenizer.TokenizeWithOptions(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if parseErr, ok := r.(*parser.Error); ok {
+				program, err = nil, parseErr
+				return
+			}
+			program, err = nil, errors.New(fmt.Sprint(r))
+		}
+	}()
+
+	return parser.NewParser(tokens).ParseProgram(), nil
+}
+
+// ParseExpression tokenizes and parses a single expression.
+func ParseExpression(source string, options tokenizer.Options) (expression ast.Expression, err error) {
+	tokens, err := tokenizer.TokenizeWithOptions(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if parseErr, ok := r.(*parser.Error); ok {
+				expression, err = nil, parseErr
+				return
+			}
+			expression, err = nil, errors.New(fmt.Sprint(r))
+		}
+	}()
+
+	return parser.NewParser(tokens).ParseExpression(), nil
+}
+
+// ParsePartial parses source in recovery mode and returns every syntax error
+// along with the program, in which BadStatement and BadExpression nodes
+// stand for the malformed parts. The program is nil only when the tokenizer
+// fails, or when a literal cannot be converted.
+func ParsePartial(source string, options tokenizer.Options) (program *ast.Program, errs []error) {
+	tokens, err := tokenizer.TokenizeWithOptions(source, options)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			program, errs = nil, []error{errors.New(fmt.Sprint(r))}
+		}
+	}()
+
+	p := parser.NewParser(tokens)
+	p.Recover = true
+	program = p.ParseProgram()
+	for _, err := range p.Errors() {
+		errs = append(errs, err)
+	}
+	return program, errs
+}
+
+// Compile runs the whole front end: parsing, optimization and semantic analysis.
+func Compile(source string, options tokenizer.Options) (*Result, error) {
+	program, err := Parse(source, options)
+	if err != nil {
+		return nil, err
+	}
+	return Analyze(program)
+}
+
+// Analyze optimizes a parsed program and runs semantic analysis on it.
+// Malformed parts of a program parsed by ParsePartial are skipped.
+func Analyze(program *ast.Program) (*Result, error) {
+	program = optimizer.Optimize(program)
+
+	sa := semantic.NewSemanticAnalyzer()
+	if err := sa.Analyze(program); err != nil {
+		return nil, fmt.Errorf("Error during semantic analysis: %w", err)
+	}
+
+	return &Result{
+		Program:  program,
+		Analyzer: sa,
+		Warnings: sa.CheckUnusedVariables(),
+	}, nil
+}
+
+// AnalyzeTree analyzes a syntax tree that was not parsed from source, such
+// as one read with ast.UnmarshalProgram. Trees holding the bad nodes of
+// recovery mode are rejected, since those stand for code that did not parse.
+func AnalyzeTree(program *ast.Program) (*Result, error) {
+	var bad ast.Node
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BadStatement, *ast.BadExpression:
+			if bad == nil {
+				bad = node
+			}
+		}
+		return bad == nil
+	})
+	if bad != nil {
+		return nil, fmt.Errorf("the syntax tree has a malformed part at line %d", ast.PositionOf(bad).Line)
+	}
+	return Analyze(program)
+}
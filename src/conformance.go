@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/conformance"
+)
+
+// runConformance compiles and runs the conformance suite with every target
+// that can execute its output locally, or with the targets given by -target.
+// Without -target, it also checks that the suite uses every node type and
+// passes through the phases that do not run programs.
+func runConformance(args []string) int {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	targets := flags.String("target", "", "comma separated targets to check, all runnable targets by default")
+	flags.Parse(args)
+
+	names := backend.Names()
+	if *targets != "" {
+		names = strings.Split(*targets, ",")
+	}
+
+	cases, err := conformance.Cases()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	dir, err := os.MkdirTemp("", "tiny-basic-conformance")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	failed := 0
+	for _, target := range names {
+		b, err := backend.Lookup(target)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if _, ok := b.(backend.Runner); !ok && *targets == "" {
+			continue
+		}
+
+		for _, c := range cases {
+			if err := conformance.Check(context.Background(), target, c, dir); err != nil {
+				fmt.Printf("FAIL %s/%s: %v\n", target, c.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("PASS %s/%s\n", target, c.Name)
+		}
+	}
+
+	// The phases that do not run programs on a target are checked with the
+	// whole suite only
+	if *targets == "" {
+		if err := conformance.Coverage(cases); err != nil {
+			fmt.Printf("FAIL coverage: %v\n", err)
+			failed++
+		}
+		for _, c := range cases {
+			if err := conformance.CheckPhases(context.Background(), c); err != nil {
+				fmt.Printf("FAIL phases/%s: %v\n", c.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("PASS phases/%s\n", c.Name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d conformance checks failed\n", failed)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package conformance
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/tokenizer"
+)
+
+// programs holds the conformance suite: every NAME.tb program comes with a
+// NAME.out file containing the exact output it must print on every target.
+//
+//go:embed programs
+var programs embed.FS
+
+type Case struct {
+	Name     string
+	Source   string
+	Expected string
+}
+
+// Cases returns the programs of the suite sorted by name.
+func Cases() ([]Case, error) {
+	entries, err := programs.ReadDir("programs")
+	if err != nil {
+		return nil, err
+	}
+
+	cases := []Case{}
+	for _, entry := range entries {
+		name, isSource := strings.CutSuffix(entry.Name(), ".tb")
+		if !isSource {
+			continue
+		}
+
+		source, err := programs.ReadFile("programs/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		expected, err := programs.ReadFile("programs/" + name + ".out")
+		if err != nil {
+			return nil, fmt.Errorf("program '%s' has no expected output: %w", name, err)
+		}
+		cases = append(cases, Case{Name: name, Source: string(source), Expected: string(expected)})
+	}
+
+	sort.Slice(cases, func(i, j int) bool {
+		return cases[i].Name < cases[j].Name
+	})
+	return cases, nil
+}
+
+// Check compiles a case for target into dir, runs it with the target's local
+// toolchain and compares what it prints with the expected output.
+func Check(ctx context.Context, target string, c Case, dir string) error {
+	b, err := backend.Lookup(target)
+	if err != nil {
+		return err
+	}
+	runner, ok := b.(backend.Runner)
+	if !ok {
+		return fmt.Errorf("target '%s' cannot run its output", target)
+	}
+
+	result, err := compiler.Compile(c.Source, tokenizer.Options{})
+	if err != nil {
+		return err
+	}
+
+	options := backend.Options{
+		SourceFile: c.Name + ".tb",
+		Source:     c.Source,
+		OutputFile: filepath.Join(dir, c.Name+b.FileExtension()),
+		Analyzer:   result.Analyzer,
+	}
+	code, err := b.Generate(result.Program, options)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(options.OutputFile, code, 0644); err != nil {
+		return err
+	}
+
+	output, err := runner.Run(ctx, options.OutputFile)
+	if err != nil {
+		return err
+	}
+
+	if normalize(string(output)) != normalize(c.Expected) {
+		return fmt.Errorf("unexpected output:\n--- expected\n%s\n--- got\n%s", c.Expected, output)
+	}
+	return nil
+}
+
+func normalize(output string) string {
+	return strings.TrimRight(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+}
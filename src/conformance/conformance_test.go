@@ -0,0 +1,78 @@
+package conformance_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/conformance"
+
+	_ "tiny-basic/src/backend/c"
+	_ "tiny-basic/src/backend/golang"
+	_ "tiny-basic/src/backend/js"
+	_ "tiny-basic/src/backend/python"
+	_ "tiny-basic/src/backend/vm"
+	_ "tiny-basic/src/backend/wasm"
+	_ "tiny-basic/src/backend/x86"
+)
+
+// TestConformance runs the suite on every registered target that can run
+// its output. Targets whose toolchain is not installed are skipped.
+func TestConformance(t *testing.T) {
+	cases, err := conformance.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range backend.Names() {
+		t.Run(target, func(t *testing.T) {
+			b, err := backend.Lookup(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := b.(backend.Runner); !ok {
+				t.Skipf("target '%s' cannot run its output", target)
+			}
+			t.Parallel()
+
+			dir := t.TempDir()
+			for _, c := range cases {
+				err := conformance.Check(context.Background(), target, c, dir)
+				if errors.Is(err, exec.ErrNotFound) {
+					t.Skipf("toolchain of target '%s' not installed", target)
+				}
+				if err != nil {
+					t.Errorf("%s: %v", c.Name, err)
+				}
+			}
+		})
+	}
+}
+
+// TestCoverage checks that the suite uses every node type.
+func TestCoverage(t *testing.T) {
+	cases, err := conformance.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conformance.Coverage(cases); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPhases runs the suite through the phases that do not execute it on a
+// target.
+func TestPhases(t *testing.T) {
+	cases, err := conformance.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := conformance.CheckPhases(context.Background(), c); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
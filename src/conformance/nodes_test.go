@@ -0,0 +1,190 @@
+package conformance_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/cfg"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/dump"
+	"tiny-basic/src/interpreter"
+	"tiny-basic/src/optimizer"
+	"tiny-basic/src/printer"
+	"tiny-basic/src/semantic"
+)
+
+// programFor builds a small program holding a node of the type of node, in
+// a place where the phases accept it.
+func programFor(t *testing.T, node ast.Node) *ast.Program {
+	one := &ast.IntegerLiteral{Value: 1}
+	x := ast.Identifier{Name: "X"}
+	let := &ast.LetStatement{Identifier: x, Value: one}
+	printX := &ast.PrintStatement{Expression: &ast.Identifier{Name: "X"}}
+	data := &ast.DataStatement{Values: []ast.Expression{one, &ast.FloatLiteral{Value: 2.5}, &ast.StringLiteral{Value: "A"}}}
+	read := &ast.ReadStatement{Identifiers: []ast.Identifier{x}}
+	less := &ast.BinaryExpression{Left: &ast.Identifier{Name: "X"}, Operator: "<", Right: &ast.IntegerLiteral{Value: 2}}
+
+	var statements []ast.Statement
+	switch node.(type) {
+	case *ast.Program:
+	case *ast.PrintStatement, *ast.StringLiteral:
+		statements = []ast.Statement{&ast.PrintStatement{Expression: &ast.StringLiteral{Value: "A"}}}
+	case *ast.LetStatement, *ast.IntegerLiteral, *ast.Identifier:
+		statements = []ast.Statement{let, printX}
+	case *ast.AssignmentStatement:
+		statements = []ast.Statement{let, &ast.AssignmentStatement{Identifier: x, Value: &ast.IntegerLiteral{Value: 2}}, printX}
+	case *ast.IfStatement:
+		statements = []ast.Statement{let, &ast.IfStatement{Condition: less, ThenBranch: printX, ElseBranch: &ast.EndStatement{}}}
+	case *ast.WhileStatement, *ast.BinaryExpression:
+		increment := &ast.AssignmentStatement{Identifier: x, Value: &ast.BinaryExpression{Left: &ast.Identifier{Name: "X"}, Operator: "+", Right: one}}
+		statements = []ast.Statement{let, &ast.WhileStatement{Condition: less, DoBranch: []ast.Statement{increment}}, printX}
+	case *ast.CommentStatement:
+		statements = []ast.Statement{&ast.CommentStatement{Text: " A"}}
+	case *ast.EndStatement:
+		statements = []ast.Statement{let, printX, &ast.EndStatement{}, printX}
+	case *ast.DataStatement, *ast.ReadStatement, *ast.FloatLiteral:
+		statements = []ast.Statement{let, data, read, printX}
+	case *ast.RestoreStatement:
+		statements = []ast.Statement{let, data, read, &ast.RestoreStatement{}, read, printX}
+	case *ast.BadStatement:
+		statements = []ast.Statement{&ast.BadStatement{Text: "PRINT +"}}
+	case *ast.BadExpression:
+		statements = []ast.Statement{&ast.PrintStatement{Expression: &ast.BadExpression{Text: "+"}}}
+	default:
+		t.Fatalf("no program for %T", node)
+	}
+
+	program := &ast.Program{Statements: statements}
+	found := false
+	ast.Inspect(program, func(n ast.Node) bool {
+		found = found || fmt.Sprintf("%T", n) == fmt.Sprintf("%T", node)
+		return true
+	})
+	if !found {
+		t.Fatalf("the program for %T does not hold one", node)
+	}
+	return program
+}
+
+// phase runs one phase of the compiler on a program.
+type phase struct {
+	name string
+	run  func(program *ast.Program) error
+}
+
+func phases() []phase {
+	list := []phase{
+		{"semantic", func(program *ast.Program) error {
+			return semantic.NewSemanticAnalyzer().Analyze(program)
+		}},
+		{"optimizer", func(program *ast.Program) error {
+			optimizer.Optimize(program)
+			return nil
+		}},
+		{"printer", func(program *ast.Program) (err error) {
+			defer ast.Recover(&err)
+			printer.Print(program)
+			return nil
+		}},
+		{"json", func(program *ast.Program) error {
+			content, err := ast.MarshalProgram(program)
+			if err != nil {
+				return err
+			}
+			decoded, err := ast.UnmarshalProgram(content)
+			if err != nil {
+				return err
+			}
+			if !ast.Equal(program, decoded) {
+				return fmt.Errorf("the decoded program differs from the encoded one")
+			}
+			return nil
+		}},
+		{"clone", func(program *ast.Program) error {
+			if !ast.Equal(program, ast.Clone(program)) {
+				return fmt.Errorf("the clone differs from the program")
+			}
+			return nil
+		}},
+		{"dump", func(program *ast.Program) error {
+			for _, format := range []string{dump.Tree, dump.DOT} {
+				if err := dump.Program(io.Discard, program, format); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"cfg", func(program *ast.Program) error {
+			graph, err := cfg.Build(program)
+			if err != nil {
+				return err
+			}
+			for _, format := range []string{cfg.DOT, cfg.Mermaid} {
+				if err := cfg.Write(io.Discard, graph, format, cfg.Liveness(graph)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"interpreter", func(program *ast.Program) error {
+			result, err := compiler.Analyze(program)
+			if err != nil {
+				return err
+			}
+			var output bytes.Buffer
+			return interpreter.New(&output).Run(context.Background(), result.Program, result.Analyzer.Types())
+		}},
+	}
+
+	for _, target := range backend.Names() {
+		list = append(list, phase{target, func(program *ast.Program) error {
+			b, err := backend.Lookup(target)
+			if err != nil {
+				return err
+			}
+			result, err := compiler.Analyze(program)
+			if err != nil {
+				return err
+			}
+			options := backend.Options{SourceFile: "node.tb", OutputFile: "node" + b.FileExtension(), Analyzer: result.Analyzer}
+			if _, err := b.Generate(result.Program, options); err != nil {
+				return err
+			}
+			if mapper, ok := b.(backend.SourceMapper); ok {
+				_, err = mapper.SourceMap(options)
+			}
+			return err
+		}})
+	}
+	return list
+}
+
+// TestPhasesHandleEveryNode drives every phase over a program holding each
+// type of node. The phases must handle every node type; the bad nodes of
+// recovery mode may be rejected, but with an error rather than a panic.
+func TestPhasesHandleEveryNode(t *testing.T) {
+	for _, node := range ast.Nodes() {
+		program := programFor(t, node)
+		_, bad := node.(*ast.BadStatement)
+		if _, ok := node.(*ast.BadExpression); ok {
+			bad = true
+		}
+
+		for _, phase := range phases() {
+			t.Run(fmt.Sprintf("%T/%s", node, phase.name), func(t *testing.T) {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("panic: %v", r)
+					}
+				}()
+				if err := phase.run(ast.Clone(program)); err != nil && !bad {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	"tiny-basic/src/cfg"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/dump"
+	"tiny-basic/src/interpreter"
+	"tiny-basic/src/printer"
+	"tiny-basic/src/tokenizer"
+)
+
+// Coverage checks that the programs of the suite use every node type of the
+// ast package, so that CheckPhases and Check exercise every phase on every
+// node type. The bad nodes of recovery mode never reach the phases behind
+// the parser and are left out.
+func Coverage(cases []Case) error {
+	used := map[string]bool{}
+	for _, c := range cases {
+		program, err := compiler.Parse(c.Source, tokenizer.Options{})
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Name, err)
+		}
+		ast.Inspect(program, func(node ast.Node) bool {
+			used[fmt.Sprintf("%T", node)] = true
+			return true
+		})
+	}
+
+	missing := []string{}
+	for _, node := range ast.Nodes() {
+		switch node.(type) {
+		case *ast.BadStatement, *ast.BadExpression:
+			continue
+		}
+		if name := fmt.Sprintf("%T", node); !used[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no program uses %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CheckPhases runs a case through the phases that do not execute it on a
+// target: the program must print back to the same tree, survive a JSON
+// round trip and cloning, dump in every format, make a control-flow graph
+// with its live variables in every format, generate code for every
+// registered target, and print the expected output in the interpreter.
+func CheckPhases(ctx context.Context, c Case) error {
+	program, err := compiler.Parse(c.Source, tokenizer.Options{})
+	if err != nil {
+		return err
+	}
+
+	printed, err := compiler.Parse(printer.Print(program), tokenizer.Options{})
+	if err != nil {
+		return fmt.Errorf("printer: %w", err)
+	}
+	if !ast.Equal(program, printed) {
+		return fmt.Errorf("printer: the printed program parses to a different tree")
+	}
+
+	content, err := ast.MarshalProgram(program)
+	if err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	decoded, err := ast.UnmarshalProgram(content)
+	if err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+	if !ast.Equal(program, decoded) {
+		return fmt.Errorf("json: the decoded program differs from the encoded one")
+	}
+
+	if clone := ast.Clone(program); clone == program || !ast.Equal(program, clone) {
+		return fmt.Errorf("ast: the clone differs from the program")
+	}
+
+	for _, format := range []string{dump.Tree, dump.DOT} {
+		if err := dump.Program(io.Discard, program, format); err != nil {
+			return fmt.Errorf("dump %s: %w", format, err)
+		}
+	}
+
+	graph, err := cfg.Build(program)
+	if err != nil {
+		return fmt.Errorf("cfg: %w", err)
+	}
+	for _, format := range []string{cfg.DOT, cfg.Mermaid} {
+		if err := cfg.Write(io.Discard, graph, format, cfg.Liveness(graph)); err != nil {
+			return fmt.Errorf("cfg %s: %w", format, err)
+		}
+	}
+
+	result, err := compiler.Analyze(program)
+	if err != nil {
+		return err
+	}
+	for _, target := range backend.Names() {
+		b, err := backend.Lookup(target)
+		if err != nil {
+			return err
+		}
+		options := backend.Options{
+			SourceFile: c.Name + ".tb",
+			Source:     c.Source,
+			OutputFile: c.Name + b.FileExtension(),
+			Analyzer:   result.Analyzer,
+		}
+		if _, err := b.Generate(result.Program, options); err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+	}
+
+	var output bytes.Buffer
+	if err := interpreter.New(&output).Run(ctx, result.Program, result.Analyzer.Types()); err != nil {
+		return fmt.Errorf("interpreter: %w", err)
+	}
+	if normalize(output.String()) != normalize(c.Expected) {
+		return fmt.Errorf("interpreter: unexpected output:\n--- expected\n%s\n--- got\n%s", c.Expected, output.String())
+	}
+	return nil
+}
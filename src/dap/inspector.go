@@ -0,0 +1,291 @@
+package dap
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// inspector is a client of the Chrome DevTools Protocol that Node.js serves
+// over a WebSocket when it runs with --inspect. Events are delivered in order
+// on their own goroutine, so handlers can make calls.
+type inspector struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	id     atomic.Int64
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[int64]chan inspectorMessage
+	closed  bool
+}
+
+type inspectorMessage struct {
+	ID     int64           `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// errInspectorClosed is returned by calls once the connection is gone.
+var errInspectorClosed = errors.New("the inspector connection is closed")
+
+// webSocketGUID is the key suffix the WebSocket handshake hashes (RFC 6455).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// dialInspector opens the WebSocket at address and calls handle with every
+// event until the connection closes, after which it calls handle with an
+// empty method.
+func dialInspector(address string, handle func(method string, params json.RawMessage)) (*inspector, error) {
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("tcp", target.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", target.RequestURI(), target.Host, key)
+
+	reader := bufio.NewReader(conn)
+	handshake, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	handshake.Body.Close()
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	if handshake.StatusCode != http.StatusSwitchingProtocols || handshake.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		conn.Close()
+		return nil, fmt.Errorf("the inspector refused the connection: %s", handshake.Status)
+	}
+
+	in := &inspector{conn: conn, reader: reader, pending: make(map[int64]chan inspectorMessage)}
+	go in.receive(handle)
+	return in, nil
+}
+
+// receive reads the messages of the connection, answering calls and queueing
+// events for handle.
+func (in *inspector) receive(handle func(method string, params json.RawMessage)) {
+	var (
+		queueMu sync.Mutex
+		queue   []inspectorMessage
+		ready   = make(chan struct{}, 1)
+	)
+	go func() {
+		for {
+			_, open := <-ready
+			queueMu.Lock()
+			messages := queue
+			queue = nil
+			queueMu.Unlock()
+			for _, message := range messages {
+				handle(message.Method, message.Params)
+			}
+			if !open {
+				handle("", nil)
+				return
+			}
+		}
+	}()
+
+	for {
+		content, err := in.readFrame()
+		if err != nil {
+			break
+		}
+		var message inspectorMessage
+		if err := json.Unmarshal(content, &message); err != nil {
+			continue
+		}
+		if message.Method == "" {
+			in.mu.Lock()
+			reply, found := in.pending[message.ID]
+			delete(in.pending, message.ID)
+			in.mu.Unlock()
+			if found {
+				reply <- message
+			}
+			continue
+		}
+		queueMu.Lock()
+		queue = append(queue, message)
+		queueMu.Unlock()
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	}
+
+	in.mu.Lock()
+	in.closed = true
+	for id, reply := range in.pending {
+		close(reply)
+		delete(in.pending, id)
+	}
+	in.mu.Unlock()
+	close(ready)
+}
+
+// call sends a command and decodes its result into result, unless result is
+// nil.
+func (in *inspector) call(method string, params any, result any) error {
+	id := in.id.Add(1)
+	reply := make(chan inspectorMessage, 1)
+	in.mu.Lock()
+	if in.closed {
+		in.mu.Unlock()
+		return errInspectorClosed
+	}
+	in.pending[id] = reply
+	in.mu.Unlock()
+
+	if params == nil {
+		params = struct{}{}
+	}
+	content, err := json.Marshal(map[string]any{"id": id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	if err := in.writeFrame(content); err != nil {
+		return err
+	}
+
+	message, ok := <-reply
+	if !ok {
+		return errInspectorClosed
+	}
+	if message.Error != nil {
+		return errors.New(message.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(message.Result, result)
+}
+
+func (in *inspector) close() {
+	in.conn.Close()
+}
+
+// WebSocket opcodes
+const (
+	continuationFrame = 0x0
+	textFrame         = 0x1
+	closeFrame        = 0x8
+	pingFrame         = 0x9
+	pongFrame         = 0xA
+)
+
+// writeFrame sends a text message in one frame. Frames from clients are
+// masked.
+func (in *inspector) writeFrame(payload []byte) error {
+	return in.write(textFrame, payload)
+}
+
+func (in *inspector) write(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, 0x80|byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	header = append(header, mask...)
+
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	in.writeMu.Lock()
+	defer in.writeMu.Unlock()
+	_, err := in.conn.Write(append(header, masked...))
+	return err
+}
+
+// readFrame reads the next message, joining fragmented frames and answering
+// pings.
+func (in *inspector) readFrame() ([]byte, error) {
+	message := []byte{}
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(in.reader, header); err != nil {
+			return nil, err
+		}
+		final, opcode := header[0]&0x80 != 0, header[0]&0x0F
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			if _, err := io.ReadFull(in.reader, extended); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			if _, err := io.ReadFull(in.reader, extended); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(extended)
+		}
+		var mask []byte
+		if header[1]&0x80 != 0 {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(in.reader, mask); err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(in.reader, payload); err != nil {
+			return nil, err
+		}
+		for i := range mask {
+			for j := i; j < len(payload); j += 4 {
+				payload[j] ^= mask[i]
+			}
+		}
+
+		switch opcode {
+		case closeFrame:
+			return nil, io.EOF
+		case pingFrame:
+			if err := in.write(pongFrame, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case pongFrame:
+			continue
+		case textFrame, continuationFrame:
+			message = append(message, payload...)
+		}
+		if final {
+			return message, nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package dap
+
+import (
+	"sync"
+	"tiny-basic/src/debugger"
+)
+
+// interpreterSession runs the program on the debugger of the interpreter.
+type interpreterSession struct {
+	server   *Server
+	debugger *debugger.Debugger
+
+	mu          sync.Mutex
+	currentLine int
+}
+
+func newInterpreterSession(s *Server, program string, source string) (session, error) {
+	d, err := debugger.New(source, s.options, output{server: s, category: "stdout"})
+	if err != nil {
+		return nil, err
+	}
+	return &interpreterSession{server: s, debugger: d}, nil
+}
+
+func (is *interpreterSession) setBreakpoints(lines []int) []Breakpoint {
+	is.debugger.ClearBreakpoints()
+	breakpoints := []Breakpoint{}
+	for _, requested := range lines {
+		line, err := is.debugger.SetBreakpoint(requested)
+		if err != nil {
+			breakpoints = append(breakpoints, Breakpoint{Verified: false, Message: err.Error()})
+			continue
+		}
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: line})
+	}
+	return breakpoints
+}
+
+// start runs the program and forwards the events of the debugger.
+func (is *interpreterSession) start(stopOnEntry bool) error {
+	if err := is.debugger.Start(stopOnEntry); err != nil {
+		return err
+	}
+
+	go func() {
+		for e := range is.debugger.Events() {
+			if e.Reason == debugger.Exited {
+				is.server.exited(e.Err)
+				return
+			}
+
+			is.mu.Lock()
+			is.currentLine = e.Line
+			is.mu.Unlock()
+			is.server.stopped(e.Reason)
+		}
+	}()
+	return nil
+}
+
+func (is *interpreterSession) line() int {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return is.currentLine
+}
+
+func (is *interpreterSession) variables() ([]Variable, error) {
+	variables, err := is.debugger.Variables()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Variable{}
+	for _, variable := range variables {
+		result = append(result, Variable{Name: variable.Name, Value: debugger.Describe(variable.Value), Type: variable.Type.String()})
+	}
+	return result, nil
+}
+
+func (is *interpreterSession) setVariable(name string, value string) (string, error) {
+	if err := is.debugger.SetVariable(name, value); err != nil {
+		return "", err
+	}
+	return is.evaluate(name)
+}
+
+func (is *interpreterSession) evaluate(expression string) (string, error) {
+	value, err := is.debugger.Evaluate(expression)
+	if err != nil {
+		return "", err
+	}
+	return debugger.Describe(value), nil
+}
+
+func (is *interpreterSession) resume(how resumption) (func() error, error) {
+	if err := is.debugger.Resumable(); err != nil {
+		return nil, err
+	}
+	switch how {
+	case stepping:
+		return is.debugger.Step, nil
+	case nexting:
+		return is.debugger.Next, nil
+	case finishing:
+		return is.debugger.StepOut, nil
+	}
+	return is.debugger.Continue, nil
+}
+
+func (is *interpreterSession) pause() error {
+	is.debugger.Pause()
+	return nil
+}
+
+func (is *interpreterSession) stop() {
+	is.debugger.Stop()
+}
@@ -0,0 +1,602 @@
+package dap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/codegen"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/debugger"
+	"tiny-basic/src/semantic"
+	"tiny-basic/src/tokenizer"
+)
+
+// nodeSession runs the JavaScript generated for the program under the
+// inspector of Node.js. Breakpoints and stops are translated between BASIC
+// lines and JavaScript locations with the mappings of the code generator,
+// and variables are shown with their BASIC names. Steps go from statement to
+// statement of the BASIC program: the JavaScript lines that were not
+// generated from one, such as the DATA pool, are stepped over.
+type nodeSession struct {
+	server    *Server
+	options   tokenizer.Options
+	types     *semantic.Types
+	generator *codegen.CodeGenerator
+	// statements maps BASIC lines to the first JavaScript statement
+	// generated for them
+	statements map[int]codegen.Mapping
+	// origins maps JavaScript lines to the BASIC statement they come from
+	origins map[int]codegen.Mapping
+	// names maps the JavaScript names of the variables to the BASIC ones,
+	// generated the other way round
+	names     map[string]string
+	generated map[string]string
+
+	dir       string
+	url       string
+	cmd       *exec.Cmd
+	inspector *inspector
+	done      chan struct{}
+
+	mu          sync.Mutex
+	scriptID    string
+	breakpoints []string
+	started     bool
+	stopOnEntry bool
+	// entering is set until the program stops on entry
+	entering bool
+	stopping bool
+	// frame is the top stack frame while the program is stopped
+	frame       *callFrame
+	currentLine int
+	how         resumption
+	pausing     bool
+	// depth is the indentation of the statement a step started from
+	depth int
+}
+
+// The Chrome DevTools Protocol types the session uses.
+
+type callFrame struct {
+	CallFrameID string `json:"callFrameId"`
+	Location    struct {
+		ScriptID   string `json:"scriptId"`
+		LineNumber int    `json:"lineNumber"`
+	} `json:"location"`
+	ScopeChain []struct {
+		Type   string       `json:"type"`
+		Object remoteObject `json:"object"`
+	} `json:"scopeChain"`
+}
+
+type remoteObject struct {
+	Type                string          `json:"type"`
+	Value               json.RawMessage `json:"value,omitempty"`
+	UnserializableValue string          `json:"unserializableValue,omitempty"`
+	Description         string          `json:"description,omitempty"`
+	ObjectID            string          `json:"objectId,omitempty"`
+}
+
+// listenTimeout bounds the wait for Node.js to open its inspector.
+const listenTimeout = 10 * time.Second
+
+func newNodeSession(s *Server, program string, source string) (session, error) {
+	result, err := compiler.Compile(source, s.options)
+	if err != nil {
+		return nil, err
+	}
+	generator := codegen.NewCodeGeneratorWithOptions(codegen.Options{SourceFile: filepath.Base(program)})
+	code, err := generator.Generate(result.Program)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "tiny-basic-dap")
+	if err != nil {
+		return nil, err
+	}
+	// Node.js names scripts by their real path
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+	script := filepath.Join(dir, strings.TrimSuffix(filepath.Base(program), filepath.Ext(program))+".js")
+	if err := os.WriteFile(script, []byte(code), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	ns := &nodeSession{
+		server:     s,
+		options:    s.options,
+		types:      result.Analyzer.Types(),
+		generator:  generator,
+		statements: make(map[int]codegen.Mapping),
+		origins:    make(map[int]codegen.Mapping),
+		names:      make(map[string]string),
+		generated:  make(map[string]string),
+		dir:        dir,
+		url:        (&url.URL{Scheme: "file", Path: filepath.ToSlash(script)}).String(),
+		done:       make(chan struct{}),
+	}
+	lines := strings.Split(code, "\n")
+	for _, mapping := range generator.Mappings() {
+		// Comments and DATA, which is written as one, cannot be stopped at
+		if mapping.Name != "" || strings.HasPrefix(strings.TrimSpace(lines[mapping.GeneratedLine]), "//") {
+			continue
+		}
+		if _, found := ns.statements[mapping.Source.Line]; !found {
+			ns.statements[mapping.Source.Line] = mapping
+		}
+		if _, found := ns.origins[mapping.GeneratedLine]; !found {
+			ns.origins[mapping.GeneratedLine] = mapping
+		}
+	}
+	for _, name := range generator.Names() {
+		ns.names[name.Generated] = name.Original
+		ns.generated[name.Original] = name.Generated
+	}
+
+	if err := ns.launch(script); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return ns, nil
+}
+
+// launch starts Node.js stopped before the script and connects to its
+// inspector.
+func (ns *nodeSession) launch(script string) error {
+	stderr := &nodeStderr{server: ns.server, listening: make(chan string, 1)}
+	ns.cmd = exec.Command("node", "--inspect-brk=127.0.0.1:0", script)
+	ns.cmd.Stdout = output{server: ns.server, category: "stdout"}
+	ns.cmd.Stderr = stderr
+	if err := ns.cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start node: %w", err)
+	}
+
+	var address string
+	select {
+	case address = <-stderr.listening:
+	case <-time.After(listenTimeout):
+		ns.cmd.Process.Kill()
+		ns.cmd.Wait()
+		return errors.New("node did not open its inspector")
+	}
+
+	in, err := dialInspector(address, ns.event)
+	if err == nil {
+		ns.inspector = in
+		err = in.call("Runtime.enable", nil, nil)
+	}
+	if err == nil {
+		err = in.call("Debugger.enable", nil, nil)
+	}
+	if err != nil {
+		ns.cmd.Process.Kill()
+		ns.cmd.Wait()
+		return fmt.Errorf("cannot connect to the inspector of node: %w", err)
+	}
+	return nil
+}
+
+// event handles the events of the inspector. The empty method tells that the
+// connection closed.
+func (ns *nodeSession) event(method string, params json.RawMessage) {
+	switch method {
+	case "Debugger.scriptParsed":
+		var script struct {
+			ScriptID string `json:"scriptId"`
+			URL      string `json:"url"`
+		}
+		if json.Unmarshal(params, &script) == nil && script.URL == ns.url {
+			ns.mu.Lock()
+			ns.scriptID = script.ScriptID
+			ns.mu.Unlock()
+		}
+	case "Debugger.paused":
+		ns.paused(params)
+	case "Runtime.executionContextDestroyed":
+		// The script ended and Node.js waits for the debugger to disconnect
+		ns.inspector.close()
+	case "":
+		ns.exit()
+	}
+}
+
+// paused decides whether the program stops where V8 paused it or goes on to
+// a statement of the BASIC program.
+func (ns *nodeSession) paused(params json.RawMessage) {
+	var paused struct {
+		CallFrames     []callFrame `json:"callFrames"`
+		HitBreakpoints []string    `json:"hitBreakpoints"`
+	}
+	if json.Unmarshal(params, &paused) != nil || len(paused.CallFrames) == 0 {
+		return
+	}
+	top := paused.CallFrames[0]
+
+	ns.mu.Lock()
+	origin, mapped := ns.origins[top.Location.LineNumber]
+	inScript := top.Location.ScriptID == ns.scriptID
+	entry := !ns.started
+	ns.started = true
+
+	command, reason := "Debugger.stepOver", ""
+	switch {
+	case entry && !ns.stopOnEntry:
+		command = "Debugger.resume"
+	case !inScript:
+		command = "Debugger.stepOut"
+	case !mapped:
+	case len(paused.HitBreakpoints) > 0:
+		reason = debugger.Breakpoint
+	case ns.entering:
+		reason = debugger.Entry
+	case ns.pausing, ns.how == continuing:
+		reason = debugger.Pause
+	case ns.how == stepping,
+		ns.how == nexting && origin.GeneratedColumn <= ns.depth,
+		ns.how == finishing && origin.GeneratedColumn < ns.depth:
+		reason = debugger.Step
+	}
+
+	if reason != "" {
+		ns.frame, ns.currentLine, ns.pausing, ns.entering = &top, origin.Source.Line, false, false
+	}
+	ns.mu.Unlock()
+
+	if reason != "" {
+		ns.server.stopped(reason)
+		return
+	}
+	ns.inspector.call(command, nil, nil)
+}
+
+// exit reports the end of Node.js once the inspector connection closed.
+func (ns *nodeSession) exit() {
+	err := ns.cmd.Wait()
+	os.RemoveAll(ns.dir)
+
+	ns.mu.Lock()
+	ns.frame = nil
+	stopping := ns.stopping
+	ns.mu.Unlock()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !stopping {
+		err = fmt.Errorf("node exited with status %d", exitErr.ExitCode())
+	} else {
+		err = nil
+	}
+	ns.server.exited(err)
+	close(ns.done)
+}
+
+func (ns *nodeSession) setBreakpoints(lines []int) []Breakpoint {
+	ns.mu.Lock()
+	previous := ns.breakpoints
+	ns.breakpoints = nil
+	ns.mu.Unlock()
+	for _, id := range previous {
+		ns.inspector.call("Debugger.removeBreakpoint", map[string]any{"breakpointId": id}, nil)
+	}
+
+	last := 0
+	for line := range ns.statements {
+		last = max(last, line)
+	}
+	breakpoints := []Breakpoint{}
+	for _, requested := range lines {
+		line := requested
+		for ; line <= last; line++ {
+			if _, found := ns.statements[line]; found {
+				break
+			}
+		}
+		if line > last {
+			breakpoints = append(breakpoints, Breakpoint{Verified: false, Message: fmt.Sprintf("no statement at or after line %d", requested)})
+			continue
+		}
+
+		mapping := ns.statements[line]
+		var result struct {
+			BreakpointID string `json:"breakpointId"`
+		}
+		err := ns.inspector.call("Debugger.setBreakpointByUrl", map[string]any{
+			"url":          ns.url,
+			"lineNumber":   mapping.GeneratedLine,
+			"columnNumber": mapping.GeneratedColumn,
+		}, &result)
+		if err != nil {
+			breakpoints = append(breakpoints, Breakpoint{Verified: false, Message: err.Error()})
+			continue
+		}
+		ns.mu.Lock()
+		ns.breakpoints = append(ns.breakpoints, result.BreakpointID)
+		ns.mu.Unlock()
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: line})
+	}
+	return breakpoints
+}
+
+func (ns *nodeSession) start(stopOnEntry bool) error {
+	ns.mu.Lock()
+	ns.stopOnEntry, ns.entering, ns.how = stopOnEntry, stopOnEntry, stepping
+	ns.mu.Unlock()
+	return ns.inspector.call("Runtime.runIfWaitingForDebugger", nil, nil)
+}
+
+func (ns *nodeSession) line() int {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.currentLine
+}
+
+// stoppedFrame returns the top stack frame of the stopped program.
+func (ns *nodeSession) stoppedFrame() (*callFrame, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.frame == nil {
+		return nil, debugger.ErrRunning
+	}
+	return ns.frame, nil
+}
+
+// scopeVariable is a variable of the program found in a scope of a stack
+// frame.
+type scopeVariable struct {
+	scope     int
+	generated string
+	value     remoteObject
+}
+
+// scopeVariables lists the variables of the program that are defined in the
+// function and block scopes of frame, innermost first.
+func (ns *nodeSession) scopeVariables(frame *callFrame) ([]scopeVariable, error) {
+	variables := []scopeVariable{}
+	for i, scope := range frame.ScopeChain {
+		if scope.Type != "local" && scope.Type != "block" {
+			continue
+		}
+		var properties struct {
+			Result []struct {
+				Name  string        `json:"name"`
+				Value *remoteObject `json:"value"`
+			} `json:"result"`
+		}
+		if err := ns.inspector.call("Runtime.getProperties", map[string]any{"objectId": scope.Object.ObjectID, "ownProperties": true}, &properties); err != nil {
+			return nil, err
+		}
+		for _, property := range properties.Result {
+			if _, found := ns.names[property.Name]; found && property.Value != nil {
+				variables = append(variables, scopeVariable{scope: i, generated: property.Name, value: *property.Value})
+			}
+		}
+	}
+	return variables, nil
+}
+
+func (ns *nodeSession) variables() ([]Variable, error) {
+	frame, err := ns.stoppedFrame()
+	if err != nil {
+		return nil, err
+	}
+	found, err := ns.scopeVariables(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	variables := []Variable{}
+	for _, variable := range found {
+		name := ns.names[variable.generated]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		variables = append(variables, Variable{Name: name, Value: describe(variable.value), Type: ns.types.Variable(name).String()})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+	return variables, nil
+}
+
+func (ns *nodeSession) setVariable(name string, value string) (string, error) {
+	frame, err := ns.stoppedFrame()
+	if err != nil {
+		return "", err
+	}
+	name = ns.options.NormalizeName(name)
+	variableType := ns.types.Variable(name)
+	if variableType == semantic.Unknown {
+		return "", fmt.Errorf("variable '%s' not declared", name)
+	}
+	expr, err := debugger.ParseExpression(value, ns.options, ns.types)
+	if err != nil {
+		return "", err
+	}
+	if valueType := ns.types.Of(expr); valueType != variableType && !(valueType == semantic.Integer && variableType == semantic.Float) {
+		return "", fmt.Errorf("cannot assign %s value to variable '%s' of type %s", strings.ToLower(valueType.String()), name, variableType)
+	}
+
+	variables, err := ns.scopeVariables(frame)
+	if err != nil {
+		return "", err
+	}
+	scope := -1
+	for _, variable := range variables {
+		if variable.generated == ns.generated[name] {
+			scope = variable.scope
+			break
+		}
+	}
+	if scope < 0 {
+		return "", fmt.Errorf("variable '%s' was not reached yet", name)
+	}
+
+	result, err := ns.evaluateOn(frame, expr, variableType)
+	if err != nil {
+		return "", err
+	}
+	newValue := map[string]any{"value": result.Value}
+	if result.UnserializableValue != "" {
+		newValue = map[string]any{"unserializableValue": result.UnserializableValue}
+	}
+	err = ns.inspector.call("Debugger.setVariableValue", map[string]any{
+		"scopeNumber":  scope,
+		"variableName": ns.generated[name],
+		"newValue":     newValue,
+		"callFrameId":  frame.CallFrameID,
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return describe(result), nil
+}
+
+func (ns *nodeSession) evaluate(expression string) (string, error) {
+	frame, err := ns.stoppedFrame()
+	if err != nil {
+		return "", err
+	}
+	expr, err := debugger.ParseExpression(expression, ns.options, ns.types)
+	if err != nil {
+		return "", err
+	}
+	result, err := ns.evaluateOn(frame, expr, semantic.Unknown)
+	if err != nil {
+		return "", err
+	}
+	return describe(result), nil
+}
+
+// evaluateOn evaluates an expression in a stack frame, translated to
+// JavaScript, to a value of type want, or of its own type when want is
+// Unknown.
+func (ns *nodeSession) evaluateOn(frame *callFrame, expr ast.Expression, want semantic.Type) (remoteObject, error) {
+	expression, err := ns.generator.Expression(expr, want)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	var evaluation struct {
+		Result           remoteObject `json:"result"`
+		ExceptionDetails *struct {
+			Text      string        `json:"text"`
+			Exception *remoteObject `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	err = ns.inspector.call("Debugger.evaluateOnCallFrame", map[string]any{
+		"callFrameId": frame.CallFrameID,
+		"expression":  expression,
+		"silent":      true,
+	}, &evaluation)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	if details := evaluation.ExceptionDetails; details != nil {
+		if details.Exception != nil && details.Exception.Description != "" {
+			message, _, _ := strings.Cut(details.Exception.Description, "\n")
+			return remoteObject{}, errors.New(message)
+		}
+		return remoteObject{}, errors.New(details.Text)
+	}
+	return evaluation.Result, nil
+}
+
+func (ns *nodeSession) resume(how resumption) (func() error, error) {
+	ns.mu.Lock()
+	if ns.frame == nil {
+		ns.mu.Unlock()
+		return nil, debugger.ErrRunning
+	}
+	ns.how, ns.depth = how, ns.origins[ns.frame.Location.LineNumber].GeneratedColumn
+	ns.frame = nil
+	ns.mu.Unlock()
+
+	command := "Debugger.stepOver"
+	if how == continuing {
+		command = "Debugger.resume"
+	}
+	return func() error { return ns.inspector.call(command, nil, nil) }, nil
+}
+
+func (ns *nodeSession) pause() error {
+	ns.mu.Lock()
+	ns.pausing = true
+	ns.mu.Unlock()
+	return ns.inspector.call("Debugger.pause", nil, nil)
+}
+
+// stop kills Node.js and waits until its end was reported.
+func (ns *nodeSession) stop() {
+	ns.mu.Lock()
+	ns.stopping = true
+	ns.mu.Unlock()
+	ns.cmd.Process.Kill()
+	<-ns.done
+}
+
+// describe formats a JavaScript value like debugger.Describe formats the
+// values of the interpreter: strings are quoted, and integers, which are
+// BigInt values, lose the "n" suffix.
+func describe(value remoteObject) string {
+	switch {
+	case value.Type == "string":
+		var text string
+		json.Unmarshal(value.Value, &text)
+		return strconv.Quote(text)
+	case value.Type == "bigint":
+		return strings.TrimSuffix(value.UnserializableValue, "n")
+	case value.UnserializableValue != "":
+		return value.UnserializableValue
+	case len(value.Value) > 0:
+		return string(value.Value)
+	case value.Description != "":
+		return value.Description
+	}
+	return value.Type
+}
+
+// nodeStderr forwards what Node.js writes to its standard error as output
+// events, except for the messages of the inspector, and hands over the
+// address the inspector listens on.
+type nodeStderr struct {
+	server    *Server
+	listening chan string
+	pending   []byte
+}
+
+func (w *nodeStderr) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		line := string(w.pending[:end+1])
+		w.pending = w.pending[end+1:]
+
+		switch {
+		case strings.HasPrefix(line, "Debugger listening on "):
+			select {
+			case w.listening <- strings.TrimSpace(strings.TrimPrefix(line, "Debugger listening on ")):
+			default:
+			}
+		case strings.HasPrefix(line, "Debugger "), strings.HasPrefix(line, "For help, see: "), strings.HasPrefix(line, "Waiting for the debugger"):
+		default:
+			output{server: w.server, category: "stderr"}.Write([]byte(line))
+		}
+	}
+}
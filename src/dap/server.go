@@ -0,0 +1,373 @@
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"tiny-basic/src/framing"
+	"tiny-basic/src/tokenizer"
+)
+
+// Server is a debug adapter for Tiny BASIC programs. It serves one debug
+// session, which runs the program on the interpreter or, with the "js"
+// target of the launch request, runs the generated JavaScript under Node.js.
+type Server struct {
+	options tokenizer.Options
+	conn    *framing.Conn
+	seq     atomic.Int64
+
+	session     session
+	program     string
+	stopOnEntry bool
+	// resuming resumes the program once the request resuming it is answered
+	resuming func() error
+}
+
+// session runs a launched program. Sessions report where the program stops
+// with Server.stopped and its end with Server.exited; lines are those of the
+// BASIC source.
+type session interface {
+	setBreakpoints(lines []int) []Breakpoint
+	start(stopOnEntry bool) error
+	// line is the line the program stopped at.
+	line() int
+	variables() ([]Variable, error)
+	setVariable(name string, value string) (string, error)
+	evaluate(expression string) (string, error)
+	// resume checks that the program can be resumed and returns what
+	// resumes it. The server calls it once the response is written, so the
+	// client learns the program runs before it learns where it stopped.
+	resume(how resumption) (func() error, error)
+	pause() error
+	stop()
+}
+
+// resumption tells how far a stopped program runs.
+type resumption int
+
+const (
+	// continuing runs until a breakpoint or the end
+	continuing resumption = iota
+	// stepping stops at the next statement
+	stepping
+	// nexting steps over the bodies of WHILE loops and IF branches
+	nexting
+	// finishing runs until the innermost WHILE or IF is left
+	finishing
+)
+
+// targets lists the ways a program can be launched.
+var targets = map[string]func(s *Server, program string, source string) (session, error){
+	"":            newInterpreterSession,
+	"interpreter": newInterpreterSession,
+	"js":          newNodeSession,
+}
+
+func NewServer(options tokenizer.Options) *Server {
+	return &Server{options: options}
+}
+
+// errDisconnect ends Serve once the client disconnected.
+var errDisconnect = errors.New("disconnect")
+
+// Serve handles requests from in and writes responses and events to out
+// until the client disconnects or closes the input.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.conn = framing.NewConn(in, out)
+	defer func() {
+		if s.session != nil {
+			s.session.stop()
+		}
+	}()
+
+	for {
+		content, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return fmt.Errorf("malformed request: %w", err)
+		}
+
+		handler, found := handlers[req.Command]
+		if !found {
+			if err := s.respond(req, nil, fmt.Errorf("unsupported request '%s'", req.Command)); err != nil {
+				return err
+			}
+			continue
+		}
+		body, err := handler(s, req.Arguments)
+		if err == errDisconnect {
+			return s.respond(req, nil, nil)
+		}
+		failed := err != nil
+		if err := s.respond(req, body, err); err != nil {
+			return err
+		}
+		if after, found := afterResponse[req.Command]; found && !failed {
+			if err := after(s); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handlers maps the requests the server implements to their handler, which
+// returns the body of the response.
+var handlers = map[string]func(s *Server, arguments json.RawMessage) (any, error){
+	"initialize":        (*Server).initialize,
+	"launch":            (*Server).launch,
+	"setBreakpoints":    (*Server).setBreakpoints,
+	"configurationDone": func(*Server, json.RawMessage) (any, error) { return nil, nil },
+	"threads":           (*Server).threads,
+	"stackTrace":        (*Server).stackTrace,
+	"scopes":            (*Server).scopes,
+	"variables":         (*Server).variables,
+	"setVariable":       (*Server).setVariable,
+	"evaluate":          (*Server).evaluate,
+	"continue":          resume(continuing),
+	"next":              resume(nexting),
+	"stepIn":            resume(stepping),
+	"stepOut":           resume(finishing),
+	"pause":             (*Server).pause,
+	"terminate":         (*Server).terminate,
+	"disconnect":        func(*Server, json.RawMessage) (any, error) { return nil, errDisconnect },
+}
+
+// afterResponse holds what happens once some requests are answered: the
+// client expects the initialized event after the launch response, the
+// program starts when the configuration is done, and it runs again only
+// once the request resuming it is answered.
+var afterResponse = map[string]func(s *Server) error{
+	"launch":            func(s *Server) error { return s.send("initialized", nil) },
+	"configurationDone": (*Server).start,
+	"continue":          (*Server).resumed,
+	"next":              (*Server).resumed,
+	"stepIn":            (*Server).resumed,
+	"stepOut":           (*Server).resumed,
+}
+
+func decode[T any](arguments json.RawMessage) (T, error) {
+	var value T
+	if len(arguments) == 0 {
+		return value, nil
+	}
+	err := json.Unmarshal(arguments, &value)
+	return value, err
+}
+
+func (s *Server) respond(req request, body any, err error) error {
+	r := response{Seq: int(s.seq.Add(1)), Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		r.Message = err.Error()
+	}
+	return s.conn.Write(r)
+}
+
+func (s *Server) send(name string, body any) error {
+	return s.conn.Write(event{Seq: int(s.seq.Add(1)), Type: "event", Event: name, Body: body})
+}
+
+// output sends what the program prints as output events.
+type output struct {
+	server   *Server
+	category string
+}
+
+func (o output) Write(p []byte) (int, error) {
+	if err := o.server.send("output", map[string]any{"category": o.category, "output": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *Server) stopped(reason string) {
+	s.send("stopped", map[string]any{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+}
+
+// exited reports the end of the program, with the error that stopped it if
+// any.
+func (s *Server) exited(err error) {
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		output{server: s, category: "stderr"}.Write([]byte(err.Error() + "\n"))
+	}
+	s.send("exited", map[string]any{"exitCode": exitCode})
+	s.send("terminated", nil)
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	return map[string]any{
+		"supportsConfigurationDoneRequest": true,
+		"supportsSetVariable":              true,
+		"supportsEvaluateForHovers":        true,
+		"supportsTerminateRequest":         true,
+	}, nil
+}
+
+func (s *Server) launch(arguments json.RawMessage) (any, error) {
+	args, err := decode[launchArguments](arguments)
+	if err != nil {
+		return nil, err
+	}
+	if s.session != nil {
+		return nil, errors.New("a program was already launched")
+	}
+	newSession, found := targets[args.Target]
+	if !found {
+		return nil, fmt.Errorf("unknown target '%s', expected interpreter or js", args.Target)
+	}
+
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return nil, err
+	}
+	session, err := newSession(s, args.Program, string(source))
+	if err != nil {
+		return nil, err
+	}
+	s.session, s.program, s.stopOnEntry = session, args.Program, args.StopOnEntry
+	return nil, nil
+}
+
+// start runs the program once the configuration is done.
+func (s *Server) start() error {
+	if s.session == nil {
+		return nil
+	}
+	return s.session.start(s.stopOnEntry)
+}
+
+func (s *Server) launched() (session, error) {
+	if s.session == nil {
+		return nil, errors.New("no program was launched")
+	}
+	return s.session, nil
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (any, error) {
+	args, err := decode[setBreakpointsArguments](arguments)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []int{}
+	for _, breakpoint := range args.Breakpoints {
+		lines = append(lines, breakpoint.Line)
+	}
+	return map[string]any{"breakpoints": session.setBreakpoints(lines)}, nil
+}
+
+func (s *Server) threads(json.RawMessage) (any, error) {
+	return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "main"}}}, nil
+}
+
+func (s *Server) stackTrace(json.RawMessage) (any, error) {
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	frame := StackFrame{ID: 1, Name: "main", Source: Source{Name: filepath.Base(s.program), Path: s.program}, Line: session.line(), Column: 1}
+	return map[string]any{"stackFrames": []StackFrame{frame}, "totalFrames": 1}, nil
+}
+
+func (s *Server) scopes(json.RawMessage) (any, error) {
+	return map[string]any{"scopes": []Scope{{Name: "Variables", VariablesReference: 1}}}, nil
+}
+
+func (s *Server) variables(json.RawMessage) (any, error) {
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	variables, err := session.variables()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"variables": variables}, nil
+}
+
+func (s *Server) setVariable(arguments json.RawMessage) (any, error) {
+	args, err := decode[setVariableArguments](arguments)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	value, err := session.setVariable(args.Name, args.Value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"value": value}, nil
+}
+
+func (s *Server) evaluate(arguments json.RawMessage) (any, error) {
+	args, err := decode[evaluateArguments](arguments)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	value, err := session.evaluate(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"result": value, "variablesReference": 0}, nil
+}
+
+// resume returns the handler of a request resuming the program.
+func resume(how resumption) func(s *Server, arguments json.RawMessage) (any, error) {
+	return func(s *Server, arguments json.RawMessage) (any, error) {
+		session, err := s.launched()
+		if err != nil {
+			return nil, err
+		}
+		resuming, err := session.resume(how)
+		if err != nil {
+			return nil, err
+		}
+		s.resuming = resuming
+		return map[string]any{"allThreadsContinued": true}, nil
+	}
+}
+
+func (s *Server) resumed() error {
+	resuming := s.resuming
+	s.resuming = nil
+	return resuming()
+}
+
+func (s *Server) pause(json.RawMessage) (any, error) {
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	return nil, session.pause()
+}
+
+func (s *Server) terminate(json.RawMessage) (any, error) {
+	session, err := s.launched()
+	if err != nil {
+		return nil, err
+	}
+	session.stop()
+	return nil, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"tiny-basic/src/dap"
+	"tiny-basic/src/debugger"
+)
+
+const debugHelp = `Commands:
+  break LINE (b)      set a breakpoint
+  delete LINE (d)     remove a breakpoint
+  breakpoints         list the breakpoints
+  run (r)             start the program
+  continue (c)        run until a breakpoint or the end
+  step (s)            run to the next line, entering loops and IF branches
+  next (n)            run to the next line, stepping over loops and IF branches
+  out (o)             run until the innermost loop body or IF branch is left
+  print EXPR (p)      evaluate an expression
+  set NAME = EXPR     change a variable
+  vars (v)            list the variables
+  watch EXPR (w)      evaluate an expression at every stop
+  unwatch N           remove a watch expression
+  list (l)            show the source around the current line
+  quit (q)            leave the debugger
+Ctrl-C pauses a running program.`
+
+// runDebugger debugs a program on the interpreter, from the command line or,
+// with -dap, for an editor speaking the Debug Adapter Protocol on the
+// standard input and output.
+func runDebugger(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	adapter := flags.Bool("dap", false, "serve the Debug Adapter Protocol on the standard input and output; the program comes from the launch request")
+	flags.Parse(args)
+
+	if *adapter {
+		if err := dap.NewServer(lexerOptions()).Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	inputFile := "input.tb"
+	if flags.NArg() > 0 {
+		inputFile = flags.Arg(0)
+	}
+	source, err := os.ReadFile(inputFile)
+	if err != nil {
+		fmt.Println("Error reading file: ", err)
+		return 1
+	}
+	d, err := debugger.New(string(source), lexerOptions(), os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	session := &debugSession{debugger: d}
+	fmt.Printf("Debugging %s. Type help for the commands.\n", inputFile)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(tbdb) ")
+		if !scanner.Scan() {
+			d.Stop()
+			return 0
+		}
+		if !session.command(strings.TrimSpace(scanner.Text())) {
+			d.Stop()
+			return 0
+		}
+	}
+}
+
+type debugSession struct {
+	debugger *debugger.Debugger
+	started  bool
+	exited   bool
+	line     int
+}
+
+// command runs a debugger command and reports whether the session goes on.
+func (s *debugSession) command(line string) bool {
+	d := s.debugger
+	name, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch name {
+	case "":
+	case "help", "h":
+		fmt.Println(debugHelp)
+	case "break", "b":
+		number, err := strconv.Atoi(argument)
+		if err != nil {
+			fmt.Println("break needs a line number")
+			break
+		}
+		if number, err = d.SetBreakpoint(number); err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Printf("Breakpoint at line %d\n", number)
+	case "delete", "d":
+		number, err := strconv.Atoi(argument)
+		if err != nil {
+			fmt.Println("delete needs a line number")
+			break
+		}
+		d.ClearBreakpoint(number)
+	case "breakpoints":
+		for _, number := range d.Breakpoints() {
+			fmt.Printf("%5d  %s\n", number, d.Line(number))
+		}
+	case "run", "r":
+		if s.started {
+			fmt.Println("The program was already started")
+			break
+		}
+		s.start(false)
+	case "continue", "c":
+		s.resume(d.Continue)
+	case "step", "s":
+		s.resume(d.Step)
+	case "next", "n":
+		s.resume(d.Next)
+	case "out", "o":
+		s.resume(d.StepOut)
+	case "print", "p":
+		value, err := d.Evaluate(argument)
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println(debugger.Describe(value))
+	case "set":
+		variable, expression, found := strings.Cut(argument, "=")
+		if !found {
+			fmt.Println("set needs NAME = EXPR")
+			break
+		}
+		if err := d.SetVariable(strings.TrimSpace(variable), strings.TrimSpace(expression)); err != nil {
+			fmt.Println(err)
+		}
+	case "vars", "v":
+		variables, err := d.Variables()
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		for _, variable := range variables {
+			fmt.Printf("%s (%s) = %s\n", variable.Name, variable.Type, debugger.Describe(variable.Value))
+		}
+	case "watch", "w":
+		if err := d.AddWatch(argument); err != nil {
+			fmt.Println(err)
+		}
+	case "unwatch":
+		index, err := strconv.Atoi(argument)
+		if err == nil {
+			err = d.RemoveWatch(index - 1)
+		}
+		if err != nil {
+			fmt.Println("unwatch needs the number of a watch expression")
+		}
+	case "list", "l":
+		for number := max(1, s.line-5); number <= s.line+5; number++ {
+			marker := " "
+			if number == s.line {
+				marker = ">"
+			}
+			if text := d.Line(number); text != "" || number <= s.line {
+				fmt.Printf("%s%4d  %s\n", marker, number, text)
+			}
+		}
+	case "quit", "q":
+		return false
+	default:
+		fmt.Printf("Unknown command '%s', type help for the commands\n", name)
+	}
+	return true
+}
+
+func (s *debugSession) start(stopOnEntry bool) {
+	s.started = true
+	s.debugger.Start(stopOnEntry)
+	s.wait()
+}
+
+// resume runs the program on, or starts it stopped before its first line.
+func (s *debugSession) resume(resume func() error) {
+	if !s.started {
+		s.start(true)
+		return
+	}
+	if s.exited {
+		fmt.Println("The program has exited")
+		return
+	}
+	if err := resume(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	s.wait()
+}
+
+// wait waits for the program to stop and shows where it did.
+func (s *debugSession) wait() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	var event debugger.Event
+	for waiting := true; waiting; {
+		select {
+		case <-interrupts:
+			s.debugger.Pause()
+		case event = <-s.debugger.Events():
+			waiting = false
+		}
+	}
+
+	if event.Reason == debugger.Exited {
+		s.exited = true
+		if event.Err != nil {
+			fmt.Println("Program stopped:", event.Err)
+		} else {
+			fmt.Println("Program exited")
+		}
+		return
+	}
+
+	s.line = event.Line
+	fmt.Printf("Stopped at line %d (%s)\n%5d  %s\n", event.Line, event.Reason, event.Line, strings.TrimSpace(s.debugger.Line(event.Line)))
+	for i, watch := range s.debugger.Watches() {
+		if watch.Err != nil {
+			fmt.Printf("  %d: %s = <%v>\n", i+1, watch.Expression, watch.Err)
+			continue
+		}
+		fmt.Printf("  %d: %s = %s\n", i+1, watch.Expression, debugger.Describe(watch.Value))
+	}
+}
@@ -0,0 +1,449 @@
+package debugger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/bytecode"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/interpreter"
+	"tiny-basic/src/semantic"
+	"tiny-basic/src/tokenizer"
+)
+
+// Reasons a program stops for.
+const (
+	Entry      = "entry"
+	Breakpoint = "breakpoint"
+	Step       = "step"
+	Pause      = "pause"
+	// Exited is the last event of a program. Its error is set when the
+	// program stopped with a run time error.
+	Exited = "exited"
+)
+
+// Event tells that the program stopped, at a line for every reason but
+// Exited.
+type Event struct {
+	Reason string
+	Line   int
+	Err    error
+}
+
+// Variable is a variable of the program and its current value.
+type Variable struct {
+	Name  string
+	Type  semantic.Type
+	Value bytecode.Value
+}
+
+// Watch is a watch expression and its value at the last stop.
+type Watch struct {
+	Expression string
+	Value      bytecode.Value
+	Err        error
+}
+
+type mode int
+
+const (
+	running mode = iota
+	stepping
+	// nexting steps over the bodies of WHILE loops and IF branches
+	nexting
+	// finishing runs until the innermost WHILE or IF is left
+	finishing
+	quitting
+)
+
+// ErrRunning is returned when the program is asked something only a stopped
+// program can answer.
+var ErrRunning = errors.New("the program is running")
+
+// errTerminated stops the interpreter when the debugger is stopped.
+var errTerminated = errors.New("terminated")
+
+// Debugger runs a program on the interpreter and stops it at breakpoints and
+// after steps. Execution happens on its own goroutine: Start and the methods
+// resuming the program return at once, and Events delivers where it stopped.
+// The state of the program can be read and changed while it is stopped.
+type Debugger struct {
+	Source  string
+	options tokenizer.Options
+	program *ast.Program
+	types   *semantic.Types
+	in      *interpreter.Interpreter
+	// lines holds the lines that have a statement to stop at
+	lines map[int]bool
+
+	events chan Event
+	resume chan mode
+	pause  atomic.Bool
+	stop   atomic.Bool
+
+	mu          sync.Mutex
+	started     bool
+	stopped     bool
+	exited      bool
+	breakpoints map[int]bool
+	watches     []string
+
+	// Owned by the goroutine of the program
+	mode      mode
+	lastLine  int
+	stopDepth int
+}
+
+// New compiles source for debugging. The output of the program goes to
+// output.
+func New(source string, options tokenizer.Options, output io.Writer) (*Debugger, error) {
+	result, err := compiler.Compile(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Debugger{
+		Source:      source,
+		options:     options,
+		program:     result.Program,
+		types:       result.Analyzer.Types(),
+		in:          interpreter.New(output),
+		lines:       make(map[int]bool),
+		events:      make(chan Event, 1),
+		resume:      make(chan mode, 1),
+		breakpoints: make(map[int]bool),
+	}
+	d.in.Hook = d.hook
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.CommentStatement, *ast.DataStatement, ast.Expression:
+			return false
+		case ast.Statement:
+			d.lines[ast.PositionOf(node).Line] = true
+		}
+		return true
+	})
+	return d, nil
+}
+
+// Events delivers an event every time the program stops, and when it exits.
+func (d *Debugger) Events() <-chan Event {
+	return d.events
+}
+
+// SetBreakpoint sets a breakpoint on the first line with a statement at or
+// after line, and returns that line. It fails when no statement follows.
+func (d *Debugger) SetBreakpoint(line int) (int, error) {
+	last := 0
+	for candidate := range d.lines {
+		last = max(last, candidate)
+	}
+	for candidate := line; candidate <= last; candidate++ {
+		if d.lines[candidate] {
+			d.mu.Lock()
+			d.breakpoints[candidate] = true
+			d.mu.Unlock()
+			return candidate, nil
+		}
+	}
+	return 0, fmt.Errorf("no statement at or after line %d", line)
+}
+
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, line)
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints returns the lines with a breakpoint in ascending order.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := []int{}
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Start runs the program, stopping before its first statement when
+// stopOnEntry is set.
+func (d *Debugger) Start(stopOnEntry bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started {
+		return errors.New("the program was already started")
+	}
+	d.started = true
+
+	d.mode = running
+	if stopOnEntry {
+		d.mode = stepping
+	}
+	go func() {
+		err := d.in.Run(context.Background(), d.program, d.types)
+		if err == errTerminated {
+			err = nil
+		}
+		d.mu.Lock()
+		d.stopped, d.exited = true, true
+		d.mu.Unlock()
+		d.events <- Event{Reason: Exited, Err: err}
+	}()
+	return nil
+}
+
+// Continue runs the program until a breakpoint or its end.
+func (d *Debugger) Continue() error {
+	return d.resumeWith(running)
+}
+
+// Step runs the program until the next line, entering loop bodies and IF
+// branches.
+func (d *Debugger) Step() error {
+	return d.resumeWith(stepping)
+}
+
+// Next runs the program until the next line at the same nesting level or an
+// outer one, so loop bodies and IF branches are stepped over.
+func (d *Debugger) Next() error {
+	return d.resumeWith(nexting)
+}
+
+// StepOut runs the program until it leaves the innermost loop body or IF
+// branch.
+func (d *Debugger) StepOut() error {
+	return d.resumeWith(finishing)
+}
+
+// Pause stops a running program at its next statement.
+func (d *Debugger) Pause() {
+	d.pause.Store(true)
+}
+
+// Stop ends a started program, whether it runs or is stopped. An Exited event
+// follows unless the program already exited.
+func (d *Debugger) Stop() {
+	d.stop.Store(true)
+	d.resumeWith(quitting)
+}
+
+// Resumable tells why the program cannot be resumed, or returns nil when it
+// is stopped.
+func (d *Debugger) Resumable() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.resumable()
+}
+
+func (d *Debugger) resumable() error {
+	switch {
+	case !d.started:
+		return errors.New("the program was not started")
+	case d.exited:
+		return errors.New("the program has exited")
+	case !d.stopped:
+		return ErrRunning
+	}
+	return nil
+}
+
+func (d *Debugger) resumeWith(m mode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.resumable(); err != nil {
+		return err
+	}
+	d.stopped = false
+	d.resume <- m
+	return nil
+}
+
+// hook decides before every statement whether the program stops there, and
+// waits to be resumed when it does.
+func (d *Debugger) hook(stmt ast.Statement, depth int) error {
+	if d.stop.Load() {
+		return errTerminated
+	}
+
+	current := ast.PositionOf(stmt).Line
+	reason := ""
+	newLine := current != d.lastLine
+	switch {
+	case d.pause.Swap(false):
+		reason = Pause
+	case newLine && d.mode == stepping && d.lastLine == 0:
+		reason = Entry
+	case newLine && d.mode == stepping:
+		reason = Step
+	case newLine && d.mode == nexting && depth <= d.stopDepth:
+		reason = Step
+	case d.mode == finishing && depth < d.stopDepth:
+		reason = Step
+	case newLine && d.hasBreakpoint(current):
+		reason = Breakpoint
+	}
+	d.lastLine = current
+	if reason == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+	d.events <- Event{Reason: reason, Line: current}
+
+	d.mode = <-d.resume
+	d.stopDepth = depth
+	if d.mode == quitting {
+		return errTerminated
+	}
+	return nil
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[line]
+}
+
+// inspect runs f if the program is stopped or has exited.
+func (d *Debugger) inspect(f func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started && !d.stopped {
+		return ErrRunning
+	}
+	return f()
+}
+
+// Variables returns every variable of the program in alphabetical order.
+// Variables that were not assigned yet hold the zero value of their type.
+func (d *Debugger) Variables() ([]Variable, error) {
+	variables := []Variable{}
+	err := d.inspect(func() error {
+		for _, name := range d.types.Variables() {
+			variables = append(variables, Variable{Name: name, Type: d.types.Variable(name), Value: d.in.Variable(name)})
+		}
+		return nil
+	})
+	return variables, err
+}
+
+// Evaluate computes an expression with the current values of the variables.
+func (d *Debugger) Evaluate(source string) (value bytecode.Value, err error) {
+	expr, err := d.parse(source)
+	if err != nil {
+		return bytecode.Value{}, err
+	}
+	err = d.inspect(func() error {
+		value, err = d.in.Evaluate(expr)
+		return err
+	})
+	return value, err
+}
+
+// SetVariable assigns the value of an expression to a variable.
+func (d *Debugger) SetVariable(name string, source string) error {
+	name = d.options.NormalizeName(name)
+	value, err := d.Evaluate(source)
+	if err != nil {
+		return err
+	}
+	return d.inspect(func() error {
+		return d.in.SetVariable(name, value)
+	})
+}
+
+// AddWatch adds an expression evaluated at every stop.
+func (d *Debugger) AddWatch(source string) error {
+	if _, err := d.parse(source); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watches = append(d.watches, source)
+	return nil
+}
+
+// RemoveWatch removes the watch expression with the given index.
+func (d *Debugger) RemoveWatch(index int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if index < 0 || index >= len(d.watches) {
+		return fmt.Errorf("no watch expression %d", index)
+	}
+	d.watches = append(d.watches[:index], d.watches[index+1:]...)
+	return nil
+}
+
+// Watches evaluates the watch expressions.
+func (d *Debugger) Watches() []Watch {
+	d.mu.Lock()
+	sources := append([]string{}, d.watches...)
+	d.mu.Unlock()
+
+	watches := []Watch{}
+	for _, source := range sources {
+		value, err := d.Evaluate(source)
+		watches = append(watches, Watch{Expression: source, Value: value, Err: err})
+	}
+	return watches
+}
+
+func (d *Debugger) parse(source string) (ast.Expression, error) {
+	return ParseExpression(source, d.options, d.types)
+}
+
+// ParseExpression parses an expression entered while debugging and checks
+// that it only names variables of the program, whose types are types.
+func ParseExpression(source string, options tokenizer.Options, types *semantic.Types) (ast.Expression, error) {
+	expr, err := compiler.ParseExpression(source, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNames(expr, types); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func checkNames(expr ast.Expression, types *semantic.Types) (err error) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok && err == nil && types.Variable(identifier.Name) == semantic.Unknown {
+			err = fmt.Errorf("variable '%s' not declared", identifier.Name)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// Line returns the text of a line of the source.
+func (d *Debugger) Line(number int) string {
+	lines := strings.Split(d.Source, "\n")
+	if number < 1 || number > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[number-1], "\r")
+}
+
+// Describe formats a value for display: strings are quoted.
+func Describe(value bytecode.Value) string {
+	if value.Kind == bytecode.String {
+		return fmt.Sprintf("%q", value.Text)
+	}
+	return value.Format()
+}
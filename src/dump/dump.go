@@ -0,0 +1,155 @@
+// Package dump prints what the front end of the compiler produces: the tokens
+// of a source, and syntax trees as an indented tree, JSON or Graphviz DOT.
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/tokenizer"
+)
+
+// Formats of syntax trees.
+const (
+	Tree = "tree"
+	JSON = "json"
+	DOT  = "dot"
+)
+
+// Formats of tokens.
+const (
+	Text = "text"
+)
+
+// Program writes a syntax tree in format. JSON follows the versioned schema
+// of ast.MarshalProgram.
+func Program(w io.Writer, program *ast.Program, format string) (err error) {
+	defer ast.Recover(&err)
+
+	switch format {
+	case Tree:
+		return writeTree(w, programNode(program))
+	case JSON:
+		content, err := ast.MarshalProgram(program)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	case DOT:
+		return writeDOT(w, programNode(program))
+	}
+	return fmt.Errorf("unknown format '%s', expected %s, %s or %s", format, Tree, JSON, DOT)
+}
+
+// Tokens writes tokens in format: one per line with their position, type and
+// value as text, or as a JSON array.
+func Tokens(w io.Writer, tokens []tokenizer.Token, format string) error {
+	switch format {
+	case Text:
+		for _, token := range tokens {
+			position := fmt.Sprintf("%d:%d", token.Line, token.Column)
+			if _, err := fmt.Fprintf(w, "%-8s %-20s %q\n", position, token.Type, token.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		type jsonToken struct {
+			Type   tokenizer.TokenType `json:"type"`
+			Value  string              `json:"value"`
+			Line   int                 `json:"line"`
+			Column int                 `json:"column"`
+		}
+		list := []jsonToken{}
+		for _, token := range tokens {
+			list = append(list, jsonToken{Type: token.Type, Value: token.Value, Line: token.Line, Column: token.Column})
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+	return fmt.Errorf("unknown format '%s', expected %s or %s", format, Text, JSON)
+}
+
+// writeTree writes a node per line, indented by two spaces per level:
+//
+//	LetStatement 1:1
+//	  identifier: Identifier 1:5 name="X"
+func writeTree(w io.Writer, root *node) error {
+	var builder strings.Builder
+	var write func(n *node, label string, level int)
+	write = func(n *node, label string, level int) {
+		builder.WriteString(strings.Repeat("  ", level) + label + n.kind)
+		if n.pos != nil {
+			fmt.Fprintf(&builder, " %d:%d", n.pos.Line, n.pos.Column)
+		}
+		for _, attribute := range n.attributes {
+			fmt.Fprintf(&builder, " %s=%s", attribute.name, format(attribute.value))
+		}
+		builder.WriteString("\n")
+
+		for _, edge := range n.edges {
+			for i, child := range edge.nodes {
+				label := edge.name + ": "
+				if edge.list {
+					label = fmt.Sprintf("%s[%d]: ", edge.name, i)
+				}
+				write(child, label, level+1)
+			}
+		}
+	}
+	write(root, "", 0)
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// writeDOT writes a Graphviz digraph with a box per node, labelled with its
+// kind, attributes and position, and edges labelled with the child names.
+func writeDOT(w io.Writer, root *node) error {
+	var builder strings.Builder
+	builder.WriteString("digraph AST {\n")
+	builder.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+
+	count := 0
+	var write func(n *node) string
+	write = func(n *node) string {
+		id := fmt.Sprintf("n%d", count)
+		count++
+
+		label := []string{dotEscape(n.kind)}
+		for _, attribute := range n.attributes {
+			label = append(label, dotEscape(attribute.name+" = "+format(attribute.value)))
+		}
+		if n.pos != nil {
+			label = append(label, fmt.Sprintf("%d:%d", n.pos.Line, n.pos.Column))
+		}
+		fmt.Fprintf(&builder, "  %s [label=\"%s\"];\n", id, strings.Join(label, `\n`))
+
+		for _, edge := range n.edges {
+			for i, child := range edge.nodes {
+				name := edge.name
+				if edge.list {
+					name = fmt.Sprintf("%s[%d]", edge.name, i)
+				}
+				childID := write(child)
+				fmt.Fprintf(&builder, "  %s -> %s [label=\"%s\"];\n", id, childID, dotEscape(name))
+			}
+		}
+		return id
+	}
+	write(root)
+	builder.WriteString("}\n")
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// dotEscape escapes text for a double-quoted DOT string.
+func dotEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text)
+}
@@ -0,0 +1,126 @@
+package dump
+
+import (
+	"fmt"
+	"tiny-basic/src/ast"
+)
+
+// node is the shape the dump formats share: a syntax tree node with its kind,
+// position, plain attributes and children, in a fixed order.
+type node struct {
+	kind string
+	// pos is nil for the program, which has no position
+	pos        *ast.Position
+	attributes []attribute
+	edges      []edge
+}
+
+type attribute struct {
+	name  string
+	value any
+}
+
+// edge links a node to a child, or to a list of children when list is set.
+type edge struct {
+	name  string
+	nodes []*node
+	list  bool
+}
+
+func positioned(kind string, pos ast.Position) *node {
+	return &node{kind: kind, pos: &pos}
+}
+
+func (n *node) attribute(name string, value any) *node {
+	n.attributes = append(n.attributes, attribute{name: name, value: value})
+	return n
+}
+
+func (n *node) child(name string, child *node) *node {
+	n.edges = append(n.edges, edge{name: name, nodes: []*node{child}})
+	return n
+}
+
+func (n *node) list(name string, children []*node) *node {
+	n.edges = append(n.edges, edge{name: name, nodes: children, list: true})
+	return n
+}
+
+func programNode(program *ast.Program) *node {
+	statements := []*node{}
+	for _, stmt := range program.Statements {
+		statements = append(statements, statementNode(stmt))
+	}
+	return (&node{kind: "Program"}).list("statements", statements)
+}
+
+func statementNode(stmt ast.Statement) *node {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		return positioned("PrintStatement", stmt.Pos).child("expression", expressionNode(stmt.Expression))
+	case *ast.LetStatement:
+		return positioned("LetStatement", stmt.Pos).child("identifier", expressionNode(&stmt.Identifier)).child("value", expressionNode(stmt.Value))
+	case *ast.AssignmentStatement:
+		return positioned("AssignmentStatement", stmt.Pos).child("identifier", expressionNode(&stmt.Identifier)).child("value", expressionNode(stmt.Value))
+	case *ast.IfStatement:
+		n := positioned("IfStatement", stmt.Pos).child("condition", expressionNode(stmt.Condition)).child("then", statementNode(stmt.ThenBranch))
+		if stmt.ElseBranch != nil {
+			n.child("else", statementNode(stmt.ElseBranch))
+		}
+		return n
+	case *ast.WhileStatement:
+		body := []*node{}
+		for _, statement := range stmt.DoBranch {
+			body = append(body, statementNode(statement))
+		}
+		return positioned("WhileStatement", stmt.Pos).child("condition", expressionNode(stmt.Condition)).list("do", body)
+	case *ast.CommentStatement:
+		return positioned("CommentStatement", stmt.Pos).attribute("text", stmt.Text)
+	case *ast.EndStatement:
+		return positioned("EndStatement", stmt.Pos)
+	case *ast.DataStatement:
+		values := []*node{}
+		for _, value := range stmt.Values {
+			values = append(values, expressionNode(value))
+		}
+		return positioned("DataStatement", stmt.Pos).list("values", values)
+	case *ast.ReadStatement:
+		identifiers := []*node{}
+		for i := range stmt.Identifiers {
+			identifiers = append(identifiers, expressionNode(&stmt.Identifiers[i]))
+		}
+		return positioned("ReadStatement", stmt.Pos).list("identifiers", identifiers)
+	case *ast.RestoreStatement:
+		return positioned("RestoreStatement", stmt.Pos)
+	case *ast.BadStatement:
+		return positioned("BadStatement", stmt.Pos).attribute("text", stmt.Text)
+	}
+	panic(&ast.UnsupportedError{Node: stmt})
+}
+
+func expressionNode(expr ast.Expression) *node {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return positioned("IntegerLiteral", expr.Pos).attribute("value", expr.Value)
+	case *ast.FloatLiteral:
+		return positioned("FloatLiteral", expr.Pos).attribute("value", expr.Value)
+	case *ast.StringLiteral:
+		return positioned("StringLiteral", expr.Pos).attribute("value", expr.Value)
+	case *ast.Identifier:
+		return positioned("Identifier", expr.Pos).attribute("name", expr.Name)
+	case *ast.BinaryExpression:
+		return positioned("BinaryExpression", expr.Pos).attribute("operator", expr.Operator).child("left", expressionNode(expr.Left)).child("right", expressionNode(expr.Right))
+	case *ast.BadExpression:
+		return positioned("BadExpression", expr.Pos).attribute("text", expr.Text)
+	}
+	panic(&ast.UnsupportedError{Node: expr})
+}
+
+// format writes an attribute value: strings quoted, numbers as Go prints
+// them.
+func format(value any) string {
+	if text, ok := value.(string); ok {
+		return fmt.Sprintf("%q", text)
+	}
+	return fmt.Sprint(value)
+}
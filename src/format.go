@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"tiny-basic/src/printer"
+)
+
+// runFormat prints the canonical form of .tb files. With -check it lists the
+// files that are not formatted instead, with -write it rewrites them.
+func runFormat(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	check := flags.Bool("check", false, "list the files whose formatting differs and exit with status 1 if there are any")
+	write := flags.Bool("write", false, "write the result to the source files instead of printing it")
+	flags.Parse(args)
+
+	files := flags.Args()
+	if len(files) == 0 && (*check || *write) {
+		files = []string{"input.tb"}
+	}
+
+	// Without files the source is read from the standard input
+	if len(files) == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("Error reading standard input: ", err)
+			return 1
+		}
+		formatted, err := printer.Format(string(source), lexerOptions())
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Println("Error reading file: ", err)
+			status = 1
+			continue
+		}
+
+		formatted, err := printer.Format(string(source), lexerOptions())
+		if err != nil {
+			fmt.Printf("%s: %v\n", file, err)
+			status = 1
+			continue
+		}
+
+		switch {
+		case *check:
+			if formatted != string(source) {
+				fmt.Println(file)
+				status = 1
+			}
+		case *write:
+			if formatted != string(source) {
+				if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+					fmt.Println("Error writing file: ", err)
+					status = 1
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
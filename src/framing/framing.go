@@ -0,0 +1,79 @@
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Conn reads and writes JSON messages framed by a Content-Length header, the
+// base protocol the Language Server Protocol and the Debug Adapter Protocol
+// share. Writes may come from several goroutines.
+type Conn struct {
+	in  *bufio.Reader
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func NewConn(in io.Reader, out io.Writer) *Conn {
+	return &Conn{in: bufio.NewReader(in), out: out}
+}
+
+// Read returns the content of the next message. It returns io.EOF when the
+// input ends between messages.
+func (c *Conn) Read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading message header: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed message header '%s'", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length '%s'", strings.TrimSpace(value))
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length header")
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.in, content); err != nil {
+		return nil, fmt.Errorf("reading message content: %w", err)
+	}
+	return content, nil
+}
+
+// Write sends a value as a JSON message.
+func (c *Conn) Write(value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = c.out.Write(content)
+	return err
+}
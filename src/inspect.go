@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/cfg"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/dump"
+	"tiny-basic/src/tokenizer"
+)
+
+// runTokens prints the tokens of a file, or of the standard input.
+func runTokens(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	format := flags.String("format", dump.Text, "output format: "+dump.Text+"|"+dump.JSON)
+	flags.Parse(args)
+
+	source, err := readSource(flags)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	tokens, err := tokenizer.TokenizeWithOptions(source, lexerOptions())
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := dump.Tokens(os.Stdout, tokens, *format); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// runAST prints the syntax tree the parser builds for a file, or for the
+// standard input. With -recover the parser skips malformed statements and
+// the tree shows them as bad nodes.
+func runAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	format := flags.String("format", dump.Tree, "output format: "+dump.Tree+"|"+dump.JSON+"|"+dump.DOT)
+	recovery := flags.Bool("recover", false, "recover from syntax errors, reporting them on the standard error")
+	flags.Parse(args)
+
+	source, err := readSource(flags)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	status := 0
+	var program *ast.Program
+	if *recovery {
+		var errs []error
+		program, errs = compiler.ParsePartial(source, lexerOptions())
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+		if program == nil {
+			return 1
+		}
+	} else if program, err = compiler.Parse(source, lexerOptions()); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if err := dump.Program(os.Stdout, program, *format); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return status
+}
+
+// runCFG prints the control-flow graph of a file, or of the standard input,
+// with the live variables of every block when -live is set.
+func runCFG(args []string) int {
+	flags := flag.NewFlagSet("cfg", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	format := flags.String("format", cfg.DOT, "output format: "+cfg.DOT+"|"+cfg.Mermaid)
+	live := flags.Bool("live", false, "annotate every block with the variables live on entry and exit")
+	flags.Parse(args)
+
+	source, err := readSource(flags)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	program, err := compiler.Parse(source, lexerOptions())
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	graph, err := cfg.Build(program)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	var liveness map[*cfg.Block]cfg.Live
+	if *live {
+		liveness = cfg.Liveness(graph)
+	}
+	if err := cfg.Write(os.Stdout, graph, *format, liveness); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// readSource reads the file named by the first argument, or the standard
+// input when there is none.
+func readSource(flags *flag.FlagSet) (string, error) {
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("Error reading standard input: %w", err)
+		}
+		return string(source), nil
+	}
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return "", fmt.Errorf("Error reading file: %w", err)
+	}
+	return string(source), nil
+}
@@ -0,0 +1,304 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/bytecode"
+	"tiny-basic/src/semantic"
+)
+
+// Error is a run time error at a statement or an expression of the program.
+type Error struct {
+	Pos     ast.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("runtime error at line %d: %s", e.Pos.Line, e.Message)
+}
+
+// errEnd unwinds the execution when the program reaches END.
+var errEnd = errors.New("end")
+
+// Interpreter executes programs by walking their syntax tree. Values and
+// operations are those of the bytecode VM, so the interpreter prints what the
+// compiled targets print. Variables and the DATA pool persist between calls
+// to Run, which lets a program be executed in parts.
+type Interpreter struct {
+	// Hook, when set, is called before every statement executes and before
+	// every evaluation of a WHILE condition. depth counts the WHILE bodies
+	// and IF branches the statement is nested in. An error stops the program
+	// and is returned by Run.
+	Hook func(stmt ast.Statement, depth int) error
+
+	output      io.Writer
+	variables   map[string]bytecode.Value
+	types       *semantic.Types
+	data        []ast.Expression
+	dataPointer int
+}
+
+func New(output io.Writer) *Interpreter {
+	return &Interpreter{output: output, variables: make(map[string]bytecode.Value)}
+}
+
+// Reset forgets the variables and the DATA pool.
+func (in *Interpreter) Reset() {
+	in.variables = make(map[string]bytecode.Value)
+	in.types = nil
+	in.data = nil
+	in.dataPointer = 0
+}
+
+// Fork returns an interpreter that holds the variables and DATA pool in
+// holds. Running a program on the fork leaves in unchanged, so the effects
+// of a part of a program that fails can be dropped.
+func (in *Interpreter) Fork() *Interpreter {
+	fork := *in
+	fork.variables = make(map[string]bytecode.Value, len(in.variables))
+	for name, value := range in.variables {
+		fork.variables[name] = value
+	}
+	fork.data = append([]ast.Expression(nil), in.data...)
+	return &fork
+}
+
+// Run executes a program until its last statement or END. types are the
+// types semantic analysis inferred for the program, including the variables
+// of the parts executed before it. Loops stop with an error when ctx is done.
+func (in *Interpreter) Run(ctx context.Context, program *ast.Program, types *semantic.Types) error {
+	in.types = types
+	// Earlier parts may have left integers in variables that are now floats
+	for name, value := range in.variables {
+		in.variables[name] = convert(value, types.Variable(name))
+	}
+	in.data = append(in.data, semantic.CollectData(program)...)
+
+	for _, stmt := range program.Statements {
+		if err := in.execute(ctx, stmt, 0); err != nil {
+			if err == errEnd {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Variables returns the names of the variables that hold a value, in
+// alphabetical order.
+func (in *Interpreter) Variables() []string {
+	names := []string{}
+	for name := range in.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Variable returns the value of a variable. Variables that were never
+// assigned hold the zero value of their type.
+func (in *Interpreter) Variable(name string) bytecode.Value {
+	if value, found := in.variables[name]; found {
+		return value
+	}
+	variableType := semantic.Unknown
+	if in.types != nil {
+		variableType = in.types.Variable(name)
+	}
+	return zeroValue(variableType)
+}
+
+// Evaluate computes the value of an expression with the current values of the
+// variables.
+func (in *Interpreter) Evaluate(expr ast.Expression) (bytecode.Value, error) {
+	return in.evaluate(expr)
+}
+
+// SetVariable changes the value of a variable, which must fit its type.
+func (in *Interpreter) SetVariable(name string, value bytecode.Value) error {
+	variableType := semantic.Unknown
+	if in.types != nil {
+		variableType = in.types.Variable(name)
+	}
+	if variableType == semantic.Unknown {
+		return fmt.Errorf("variable '%s' not declared", name)
+	}
+	if value.Kind != kind(variableType) && !(value.Kind == bytecode.Integer && variableType == semantic.Float) {
+		return fmt.Errorf("cannot assign %s value to variable '%s' of type %s", value.Kind, name, variableType)
+	}
+	in.assign(name, value)
+	return nil
+}
+
+func (in *Interpreter) assign(name string, value bytecode.Value) {
+	if in.types != nil {
+		value = convert(value, in.types.Variable(name))
+	}
+	in.variables[name] = value
+}
+
+func (in *Interpreter) execute(ctx context.Context, stmt ast.Statement, depth int) error {
+	switch stmt.(type) {
+	case *ast.CommentStatement, *ast.DataStatement, *ast.WhileStatement:
+		// Comments and DATA do nothing, WHILE hooks every iteration below
+	default:
+		if err := in.hook(stmt, depth); err != nil {
+			return err
+		}
+	}
+
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		value, err := in.evaluate(stmt.Expression)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(in.output, value.Format())
+		return err
+	case *ast.LetStatement:
+		value, err := in.evaluate(stmt.Value)
+		if err != nil {
+			return err
+		}
+		in.assign(stmt.Identifier.Name, value)
+	case *ast.AssignmentStatement:
+		value, err := in.evaluate(stmt.Value)
+		if err != nil {
+			return err
+		}
+		in.assign(stmt.Identifier.Name, value)
+	case *ast.IfStatement:
+		condition, err := in.evaluate(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		if condition.Kind == bytecode.Boolean && condition.Bool {
+			return in.execute(ctx, stmt.ThenBranch, depth+1)
+		}
+		if stmt.ElseBranch != nil {
+			return in.execute(ctx, stmt.ElseBranch, depth+1)
+		}
+	case *ast.WhileStatement:
+		for {
+			if ctx.Err() != nil {
+				return &Error{Pos: stmt.Pos, Message: "interrupted"}
+			}
+			if err := in.hook(stmt, depth); err != nil {
+				return err
+			}
+			condition, err := in.evaluate(stmt.Condition)
+			if err != nil {
+				return err
+			}
+			if condition.Kind != bytecode.Boolean || !condition.Bool {
+				return nil
+			}
+			for _, statement := range stmt.DoBranch {
+				if err := in.execute(ctx, statement, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	case *ast.EndStatement:
+		return errEnd
+	case *ast.CommentStatement, *ast.DataStatement:
+		return nil
+	case *ast.ReadStatement:
+		for _, identifier := range stmt.Identifiers {
+			value, err := in.read(in.types.Variable(identifier.Name))
+			if err != nil {
+				return &Error{Pos: identifier.Pos, Message: err.Error()}
+			}
+			in.assign(identifier.Name, value)
+		}
+	case *ast.RestoreStatement:
+		in.dataPointer = 0
+	default:
+		return &ast.UnsupportedError{Node: stmt}
+	}
+	return nil
+}
+
+func (in *Interpreter) hook(stmt ast.Statement, depth int) error {
+	if in.Hook == nil {
+		return nil
+	}
+	return in.Hook(stmt, depth)
+}
+
+// read takes the next value of the DATA pool for a variable of type want.
+func (in *Interpreter) read(want semantic.Type) (bytecode.Value, error) {
+	if in.dataPointer >= len(in.data) {
+		return bytecode.Value{}, errors.New("out of data")
+	}
+	value, err := in.evaluate(in.data[in.dataPointer])
+	if err != nil {
+		return bytecode.Value{}, err
+	}
+	in.dataPointer++
+
+	switch {
+	case value.Kind == kind(want):
+		return value, nil
+	case value.Kind == bytecode.Integer && want == semantic.Float:
+		return convert(value, semantic.Float), nil
+	}
+	return bytecode.Value{}, errors.New("type mismatch in READ")
+}
+
+func (in *Interpreter) evaluate(expr ast.Expression) (bytecode.Value, error) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return bytecode.IntegerValue(int64(expr.Value)), nil
+	case *ast.FloatLiteral:
+		return bytecode.FloatValue(expr.Value), nil
+	case *ast.StringLiteral:
+		return bytecode.StringValue(expr.Value), nil
+	case *ast.Identifier:
+		return in.Variable(expr.Name), nil
+	case *ast.BinaryExpression:
+		left, err := in.evaluate(expr.Left)
+		if err != nil {
+			return bytecode.Value{}, err
+		}
+		right, err := in.evaluate(expr.Right)
+		if err != nil {
+			return bytecode.Value{}, err
+		}
+		result, err := bytecode.Apply(expr.Operator, left, right)
+		if err != nil {
+			return bytecode.Value{}, &Error{Pos: expr.Pos, Message: err.Error()}
+		}
+		return result, nil
+	}
+	return bytecode.Value{}, &ast.UnsupportedError{Node: expr}
+}
+
+// convert widens an integer stored in a float variable.
+func convert(value bytecode.Value, variableType semantic.Type) bytecode.Value {
+	if variableType == semantic.Float && value.Kind == bytecode.Integer {
+		return bytecode.FloatValue(float64(value.Int))
+	}
+	return value
+}
+
+func kind(t semantic.Type) bytecode.Kind {
+	switch t {
+	case semantic.Float:
+		return bytecode.Float
+	case semantic.String:
+		return bytecode.String
+	case semantic.Boolean:
+		return bytecode.Boolean
+	}
+	return bytecode.Integer
+}
+
+func zeroValue(t semantic.Type) bytecode.Value {
+	return bytecode.Value{Kind: kind(t)}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"tiny-basic/src/lsp"
+)
+
+// runLanguageServer serves the Language Server Protocol over the standard
+// input and output, for editors to start as a subprocess.
+func runLanguageServer(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	flags.Parse(args)
+
+	if err := lsp.NewServer(lexerOptions()).Serve(os.Stdin, os.Stdout); err != nil {
+		// Standard output carries the protocol, so errors go to standard error
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,228 @@
+package lsp
+
+import (
+	"errors"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/parser"
+	"tiny-basic/src/semantic"
+	"tiny-basic/src/tokenizer"
+	"unicode/utf8"
+)
+
+// occurrence is an identifier in the source. Declarations are the
+// identifiers of LET statements.
+type occurrence struct {
+	identifier  ast.Identifier
+	declaration *ast.LetStatement
+}
+
+// document is an open .tb file and what the front end found out about it.
+// Documents are analyzed whole on every change, Tiny BASIC programs are small.
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	occurrences []occurrence
+	// declarations maps a variable to its first LET statement
+	declarations map[string]*ast.LetStatement
+	types        *semantic.Types
+	diagnostics  []Diagnostic
+}
+
+func newDocument(uri string, text string, options tokenizer.Options) *document {
+	d := &document{
+		uri:          uri,
+		text:         text,
+		lines:        strings.Split(text, "\n"),
+		declarations: make(map[string]*ast.LetStatement),
+		diagnostics:  []Diagnostic{},
+	}
+
+	// Syntax errors do not stop the analysis, so editing a line keeps the
+	// rest of the document working
+	program, errs := compiler.ParsePartial(text, options)
+	for _, err := range errs {
+		d.diagnostics = append(d.diagnostics, d.syntaxDiagnostic(err))
+	}
+	if program == nil {
+		return d
+	}
+	d.collect(program)
+
+	result, err := compiler.Analyze(program)
+	if err != nil {
+		d.diagnostics = append(d.diagnostics, d.semanticDiagnostic(err))
+		// Types of a program with semantic errors are best effort
+		if types, err := semantic.InferTypes(program); err == nil {
+			d.types = types
+		}
+		return d
+	}
+	d.types = result.Analyzer.Types()
+	if len(errs) > 0 {
+		// Variables may well be used in the malformed parts
+		return d
+	}
+
+	for _, name := range result.Analyzer.UnusedVariables() {
+		if declaration := d.declarations[name]; declaration != nil {
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Range:    d.identifierRange(declaration.Identifier),
+				Severity: SeverityWarning,
+				Source:   "tiny-basic",
+				Message:  "variable '" + name + "' is declared but never used",
+			})
+		}
+	}
+	return d
+}
+
+func (d *document) syntaxDiagnostic(err error) Diagnostic {
+	diagnostic := Diagnostic{Severity: SeverityError, Source: "tiny-basic", Message: err.Error()}
+
+	var tokenizerErr *tokenizer.TokenizerError
+	var parseErr *parser.Error
+	switch {
+	case errors.As(err, &tokenizerErr):
+		line, column := d.offsetPosition(tokenizerErr.Position)
+		diagnostic.Range = d.tokenRange(line, column, 1)
+	case errors.As(err, &parseErr):
+		length := utf8.RuneCountInString(parseErr.Token.Value)
+		if parseErr.Token.Type == tokenizer.TOKEN_NEWLINE || parseErr.Token.Type == tokenizer.TOKEN_EOF {
+			length = 1
+		}
+		diagnostic.Range = d.tokenRange(parseErr.Token.Line, parseErr.Token.Column, length)
+		diagnostic.Message = parseErr.Message
+	}
+	return diagnostic
+}
+
+func (d *document) semanticDiagnostic(err error) Diagnostic {
+	diagnostic := Diagnostic{Severity: SeverityError, Source: "tiny-basic", Message: err.Error()}
+
+	var semanticErr *semantic.Error
+	if errors.As(err, &semanticErr) {
+		diagnostic.Message = semanticErr.Message
+		diagnostic.Range = d.tokenRange(semanticErr.Pos.Line, semanticErr.Pos.Column, 1)
+		for _, o := range d.occurrences {
+			if o.identifier.Pos == semanticErr.Pos {
+				diagnostic.Range = d.identifierRange(o.identifier)
+			}
+		}
+	}
+	return diagnostic
+}
+
+// collect records every identifier of the program, and the LET statement
+// declaring each variable.
+func (d *document) collect(program *ast.Program) {
+	var let *ast.LetStatement
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			let = node
+			if d.declarations[node.Identifier.Name] == nil {
+				d.declarations[node.Identifier.Name] = node
+			}
+		case *ast.Identifier:
+			o := occurrence{identifier: *node}
+			// Walk visits the identifier of a LET as a pointer into it
+			if let != nil && node == &let.Identifier {
+				o.declaration = let
+			}
+			d.occurrences = append(d.occurrences, o)
+		}
+		return true
+	})
+}
+
+// occurrenceAt returns the identifier under the cursor.
+func (d *document) occurrenceAt(position Position) (occurrence, bool) {
+	for _, o := range d.occurrences {
+		r := d.identifierRange(o.identifier)
+		if r.Start.Line == position.Line && r.Start.Character <= position.Character && position.Character <= r.End.Character {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// references returns every occurrence of a variable in source order.
+func (d *document) references(name string) []occurrence {
+	references := []occurrence{}
+	for _, o := range d.occurrences {
+		if o.identifier.Name == name {
+			references = append(references, o)
+		}
+	}
+	return references
+}
+
+func (d *document) typeOf(name string) semantic.Type {
+	if d.types == nil {
+		return semantic.Unknown
+	}
+	return d.types.Variable(name)
+}
+
+// identifierRange is the range an identifier covers in the source. Names may
+// have been case folded, but never change length.
+func (d *document) identifierRange(identifier ast.Identifier) Range {
+	return d.tokenRange(identifier.Pos.Line, identifier.Pos.Column, utf8.RuneCountInString(identifier.Name))
+}
+
+// tokenRange converts a 1-based line and rune column, as the tokenizer counts
+// them, and a length in runes to an LSP range.
+func (d *document) tokenRange(line int, column int, length int) Range {
+	start := Position{Line: line - 1, Character: d.character(line-1, column-1)}
+	end := Position{Line: line - 1, Character: d.character(line-1, column-1+length)}
+	return Range{Start: start, End: end}
+}
+
+// lineRange covers a line from a rune column to its end.
+func (d *document) lineRange(line int, column int) Range {
+	r := d.tokenRange(line, column, 0)
+	r.End.Character = d.character(line-1, utf8.RuneCountInString(d.line(line-1)))
+	return r
+}
+
+// character converts a rune offset in a line to UTF-16 code units.
+func (d *document) character(line int, runes int) int {
+	character := 0
+	for i, ch := range []rune(d.line(line)) {
+		if i >= runes {
+			break
+		}
+		character++
+		if ch >= 0x10000 {
+			character++
+		}
+	}
+	return character + max(0, runes-utf8.RuneCountInString(d.line(line)))
+}
+
+func (d *document) line(line int) string {
+	if line < 0 || line >= len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[line], "\r")
+}
+
+// offsetPosition converts a rune offset in the whole text to a 1-based line
+// and column.
+func (d *document) offsetPosition(offset int) (int, int) {
+	line, column := 1, 1
+	for i, ch := range []rune(d.text) {
+		if i == offset {
+			break
+		}
+		column++
+		if ch == '\n' {
+			line, column = line+1, 1
+		}
+	}
+	return line, column
+}
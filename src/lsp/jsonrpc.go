@@ -0,0 +1,36 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"tiny-basic/src/framing"
+)
+
+// connection exchanges JSON-RPC messages over the base protocol of LSP.
+type connection struct {
+	*framing.Conn
+}
+
+func newConnection(in io.Reader, out io.Writer) *connection {
+	return &connection{framing.NewConn(in, out)}
+}
+
+func (c *connection) reply(id json.RawMessage, result any) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(content)
+	return c.Write(response{JSONRPC: "2.0", ID: id, Result: &raw})
+}
+
+func (c *connection) replyError(id json.RawMessage, err *ResponseError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return c.Write(response{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (c *connection) notify(method string, params any) error {
+	return c.Write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,307 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"tiny-basic/src/tokenizer"
+)
+
+// Server is a language server for Tiny BASIC. It keeps the open documents in
+// memory and answers requests about them; it never reads files itself.
+type Server struct {
+	options   tokenizer.Options
+	conn      *connection
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer creates a server analyzing documents with the given lexer mode.
+func NewServer(options tokenizer.Options) *Server {
+	return &Server{options: options, documents: make(map[string]*document)}
+}
+
+// ErrNoShutdown is returned by Serve when the client exits without asking the
+// server to shut down first.
+var ErrNoShutdown = errors.New("exit before shutdown")
+
+// Serve handles messages from in and writes responses and notifications to
+// out until the client sends exit or closes the input.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.conn = newConnection(in, out)
+	for {
+		content, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			if err := s.conn.replyError(nil, &ResponseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches a request or a notification. Only failures to write are
+// returned, failed requests are answered with an error.
+func (s *Server) handle(req request) error {
+	handler, found := handlers[req.Method]
+	if !found {
+		if req.ID == nil {
+			// Unknown notifications, like $/cancelRequest, are ignored
+			return nil
+		}
+		return s.conn.replyError(req.ID, &ResponseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method})
+	}
+	if s.shutdown && req.ID != nil {
+		return s.conn.replyError(req.ID, &ResponseError{Code: codeInvalidRequest, Message: "server is shutting down"})
+	}
+
+	result, err := handler(s, req.Params)
+	if req.ID == nil {
+		return err
+	}
+	if err != nil {
+		var responseErr *ResponseError
+		if !errors.As(err, &responseErr) {
+			responseErr = &ResponseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		return s.conn.replyError(req.ID, responseErr)
+	}
+	return s.conn.reply(req.ID, result)
+}
+
+// handlers maps the methods the server implements to their handler. Handlers
+// of notifications return nil results.
+var handlers = map[string]func(s *Server, params json.RawMessage) (any, error){
+	"initialize":  (*Server).initialize,
+	"initialized": func(*Server, json.RawMessage) (any, error) { return nil, nil },
+	"shutdown":    func(s *Server, _ json.RawMessage) (any, error) { s.shutdown = true; return nil, nil },
+
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/rename":         (*Server).rename,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+}
+
+func decode[T any](params json.RawMessage) (T, error) {
+	var value T
+	if err := json.Unmarshal(params, &value); err != nil {
+		return value, &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return value, nil
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":       map[string]any{"openClose": true, "change": 1},
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"renameProvider":         true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]any{},
+		},
+		"serverInfo": map[string]any{"name": "tiny-basic"},
+	}, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	p, err := decode[didOpenParams](params)
+	if err != nil {
+		return nil, nil
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	p, err := decode[didChangeParams](params)
+	if err != nil || len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	p, err := decode[didCloseParams](params)
+	if err != nil {
+		return nil, nil
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update analyzes a new version of a document and publishes its diagnostics.
+func (s *Server) update(uri string, text string) error {
+	d := newDocument(uri, text, s.options)
+	s.documents[uri] = d
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics})
+}
+
+// lookup finds the document and the identifier a position request is about.
+// Requests outside an identifier have no result rather than failing.
+func (s *Server) lookup(p positionParams) (*document, occurrence, bool, error) {
+	d, found := s.documents[p.TextDocument.URI]
+	if !found {
+		return nil, occurrence{}, false, &ResponseError{Code: codeInvalidParams, Message: "unknown document " + p.TextDocument.URI}
+	}
+	o, found := d.occurrenceAt(p.Position)
+	return d, o, found, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, o, found, err := s.lookup(p)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	name := o.identifier.Name
+	value := fmt.Sprintf("```\n%s: %s\n```\n", name, d.typeOf(name))
+	if declaration := d.declarations[name]; declaration != nil {
+		line := declaration.Identifier.Pos.Line
+		value += fmt.Sprintf("Declared on line %d: `%s`", line, strings.TrimSpace(d.line(line-1)))
+	} else {
+		value += "Not declared with LET"
+	}
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: d.identifierRange(o.identifier)}, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, o, found, err := s.lookup(p)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	declaration := d.declarations[o.identifier.Name]
+	if declaration == nil {
+		return nil, nil
+	}
+	return Location{URI: d.uri, Range: d.identifierRange(declaration.Identifier)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	p, err := decode[referenceParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, o, found, err := s.lookup(p.positionParams)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	locations := []Location{}
+	for _, reference := range d.references(o.identifier.Name) {
+		if reference.declaration == d.declarations[o.identifier.Name] && reference.declaration != nil && !p.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: d.identifierRange(reference.identifier)})
+	}
+	return locations, nil
+}
+
+func (s *Server) rename(params json.RawMessage) (any, error) {
+	p, err := decode[renameParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, o, found, err := s.lookup(p.positionParams)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	// The new name must lex as a single identifier in the server's mode
+	tokens, err := tokenizer.TokenizeWithOptions(p.NewName, s.options)
+	if err != nil || len(tokens) != 2 || tokens[0].Type != tokenizer.TOKEN_IDENTIFIER {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("'%s' is not a valid variable name", p.NewName)}
+	}
+	newName := tokens[0].Value
+	if newName != o.identifier.Name && len(d.references(newName)) > 0 {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("variable '%s' already exists", newName)}
+	}
+
+	edits := []TextEdit{}
+	for _, reference := range d.references(o.identifier.Name) {
+		edits = append(edits, TextEdit{Range: d.identifierRange(reference.identifier), NewText: p.NewName})
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (any, error) {
+	p, err := decode[documentSymbolParams](params)
+	if err != nil {
+		return nil, err
+	}
+	d, found := s.documents[p.TextDocument.URI]
+	if !found {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: "unknown document " + p.TextDocument.URI}
+	}
+
+	symbols := []DocumentSymbol{}
+	for _, o := range d.occurrences {
+		if o.declaration == nil {
+			continue
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           o.identifier.Name,
+			Detail:         d.typeOf(o.identifier.Name).String(),
+			Kind:           symbolKindVariable,
+			Range:          d.lineRange(o.declaration.Pos.Line, o.declaration.Pos.Column),
+			SelectionRange: d.identifierRange(o.identifier),
+		})
+	}
+	return symbols, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	p, err := decode[positionParams](params)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []CompletionItem{}
+	for _, keyword := range tokenizer.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+	if d, found := s.documents[p.TextDocument.URI]; found {
+		for _, o := range d.occurrences {
+			if o.declaration == nil || d.declarations[o.identifier.Name] != o.declaration {
+				continue
+			}
+			items = append(items, CompletionItem{Label: o.identifier.Name, Kind: completionKindVariable, Detail: d.typeOf(o.identifier.Name).String()})
+		}
+	}
+	return items, nil
+}
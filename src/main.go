@@ -1,56 +1,182 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"tiny-basic/src/codegen"
-	"tiny-basic/src/optimizer"
-	"tiny-basic/src/parser"
-	"tiny-basic/src/semantic"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/backend"
+	_ "tiny-basic/src/backend/c"
+	_ "tiny-basic/src/backend/golang"
+	_ "tiny-basic/src/backend/js"
+	_ "tiny-basic/src/backend/python"
+	_ "tiny-basic/src/backend/vm"
+	_ "tiny-basic/src/backend/wasm"
+	_ "tiny-basic/src/backend/x86"
+	"tiny-basic/src/compiler"
 	"tiny-basic/src/tokenizer"
 )
 
+// commands maps the name of a subcommand to its implementation. Without a
+// subcommand the arguments are handed to compile.
+var commands = map[string]func(args []string) int{
+	"ast":         runAST,
+	"cfg":         runCFG,
+	"conformance": runConformance,
+	"debug":       runDebugger,
+	"disasm":      disassemble,
+	"fmt":         runFormat,
+	"lsp":         runLanguageServer,
+	"repl":        runREPL,
+	"run":         runBytecode,
+	"tokens":      runTokens,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+	os.Exit(compile(os.Args[1:]))
+}
+
+func compile(args []string) int {
+	flags := flag.NewFlagSet("tiny-basic", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	target := flags.String("target", "js", "code generation target: "+strings.Join(backend.Names(), "|"))
+	mode := flags.String("mode", "", "output mode of targets that have several, js: node|module|browser")
+	strict := flags.Bool("strict", false, "emit strict mode code, for targets that support it")
+	minify := flags.Bool("minify", false, "emit compact code without whitespace or comments, for targets that support it")
+	var sourceMap sourceMapMode
+	flags.Var(&sourceMap, "source-map", "emit a source map: 'file' (the default when no value is given) or 'inline'")
+	fromTree := flags.Bool("ast", false, "read the input as a JSON syntax tree, as written by 'ast -format=json', instead of source text")
+	flags.Parse(args)
+
 	inputFile := "input.tb"
-	outputFile := "output.js"
+	if flags.NArg() > 0 {
+		inputFile = flags.Arg(0)
+	}
+
+	b, err := backend.Lookup(*target)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	outputFile := "output" + b.FileExtension()
 
 	sourceCode, err := os.ReadFile(inputFile)
 	if err != nil {
 		fmt.Println("Error reading file: ", err)
-		return
+		return 1
 	}
 
-	tokens, err := tokenizer.Tokenize(string(sourceCode))
+	var result *compiler.Result
+	if *fromTree {
+		if sourceMap != "" {
+			fmt.Println("Source maps need the source text, they cannot be emitted with -ast")
+			return 1
+		}
+		var program *ast.Program
+		if program, err = ast.UnmarshalProgram(sourceCode); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		result, err = compiler.AnalyzeTree(program)
+	} else {
+		result, err = compiler.Compile(string(sourceCode), lexerOptions())
+	}
 	if err != nil {
 		fmt.Println(err)
-		return
+		return 1
+	}
+	for _, warning := range result.Warnings {
+		fmt.Println(warning)
 	}
 
-	p := parser.NewParser(tokens)
-
-	program := p.ParseProgram()
-	program = optimizer.Optimize(program)
-
-	sa := semantic.NewSemanticAnalyzer()
-	if err := sa.Analyze(program); err != nil {
-		fmt.Println("Error during semantic analysis:", err)
-		return
+	options := backend.Options{
+		SourceFile: inputFile,
+		Source:     string(sourceCode),
+		OutputFile: outputFile,
+		SourceMap:  string(sourceMap),
+		Mode:       *mode,
+		Strict:     *strict,
+		Minify:     *minify,
+		Analyzer:   result.Analyzer,
 	}
-	warnings := sa.CheckUnusedVariables()
-	for _, warning := range warnings {
-		fmt.Println(warning)
+	mapper, canMap := b.(backend.SourceMapper)
+	if sourceMap != "" && !canMap {
+		fmt.Printf("Target '%s' does not support source maps\n", b.Name())
+		return 1
+	}
+
+	code, err := b.Generate(result.Program, options)
+	if err != nil {
+		fmt.Println("Error during code generation:", err)
+		return 1
 	}
 
-	cg := codegen.NewCodeGenerator()
-	jsCode := cg.Generate(program)
+	if sourceMap == "file" {
+		mapData, err := mapper.SourceMap(options)
+		if err != nil {
+			fmt.Println("Error generating source map:", err)
+			return 1
+		}
+		if err := os.WriteFile(outputFile+".map", mapData, 0644); err != nil {
+			fmt.Println("Error writing source map:", err)
+			return 1
+		}
+	}
 
-	// Write the generated JavaScript code to a file
-	err = os.WriteFile(outputFile, []byte(jsCode), 0644)
+	err = os.WriteFile(outputFile, code, 0644)
 	if err != nil {
 		fmt.Println("Error writing output file:", err)
-		return
+		return 1
+	}
+
+	fmt.Println("Compilation successful! Output saved to", outputFile)
+	return 0
+}
+
+// lexerFlags registers the flags selecting the lexer mode and returns a
+// function building the tokenizer options once the flags are parsed.
+func lexerFlags(flags *flag.FlagSet) func() tokenizer.Options {
+	ignoreCase := flags.Bool("ignore-case", false, "match keywords regardless of case")
+	extendedNames := flags.Bool("extended-names", false, "allow digits, underscores and $/% suffixes in identifiers")
+	foldCase := flags.Bool("fold-case", false, "fold identifiers to uppercase instead of preserving their case")
+
+	return func() tokenizer.Options {
+		options := tokenizer.Options{IgnoreCase: *ignoreCase, ExtendedNames: *extendedNames}
+		if *foldCase {
+			options.Names = tokenizer.FoldCase
+		}
+		return options
 	}
+}
+
+// sourceMapMode is the value of the -source-map flag. It can be given without
+// a value, in which case the map is written next to the output file.
+type sourceMapMode string
 
-	fmt.Println("Compilation successful! JavaScript output saved to", outputFile)
+func (m *sourceMapMode) String() string {
+	return string(*m)
+}
+
+func (m *sourceMapMode) Set(value string) error {
+	switch value {
+	case "true", "file":
+		*m = "file"
+	case "false":
+		*m = ""
+	case "inline":
+		*m = "inline"
+	default:
+		return fmt.Errorf("unknown source map mode '%s'", value)
+	}
+	return nil
+}
 
+func (m *sourceMapMode) IsBoolFlag() bool {
+	return true
 }
@@ -6,12 +6,21 @@ import (
 
 func Optimize(program *ast.Program) *ast.Program {
 	newStmts := []ast.Statement{}
+	ended := false
 
 	for _, stmt := range program.Statements {
+		if ended {
+			// DATA is never executed, so values listed after END still belong to the pool
+			if _, ok := stmt.(*ast.DataStatement); ok {
+				newStmts = append(newStmts, stmt)
+			}
+			continue
+		}
+
 		newStmts = append(newStmts, stmt)
 
 		if _, ok := stmt.(*ast.EndStatement); ok {
-			break
+			ended = true
 		}
 	}
 
@@ -1,4 +1,5 @@
-//  Example Program
+// Generated by tiny-basic from input.tb
+// Example Program
 let X = 0;
 let Y = 0;
 process.exit(0);
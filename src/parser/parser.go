@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"tiny-basic/src/ast"
 	"tiny-basic/src/tokenizer"
 )
@@ -10,6 +11,14 @@ import (
 type Parser struct {
 	tokens  []tokenizer.Token
 	current int
+	// Recover makes the parser record syntax errors and carry on instead of
+	// stopping at the first one. Malformed statements and expressions become
+	// BadStatement and BadExpression nodes, so tools working on source that
+	// is being edited still get a tree.
+	Recover bool
+	errors  []*Error
+	// parens is the number of parentheses open around the current expression
+	parens int
 }
 
 func NewParser(tokens []tokenizer.Token) *Parser {
@@ -19,17 +28,83 @@ func NewParser(tokens []tokenizer.Token) *Parser {
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 
+	p.skipSeparators()
 	for p.current < len(p.tokens)-1 {
-		statement := p.parseStatement()
-		program.Statements = append(program.Statements, statement)
+		statement := p.parseLine()
 		if statement == nil {
 			return program
 		}
+		program.Statements = append(program.Statements, statement)
+		p.skipSeparators()
 	}
 
 	return program
 }
 
+// ParseExpression parses source made of a single expression, as tools that
+// evaluate expressions against a running program take them.
+func (p *Parser) ParseExpression() ast.Expression {
+	expression := p.parseExpression()
+	p.match(tokenizer.TOKEN_NEWLINE)
+	if p.peek().Type != tokenizer.TOKEN_EOF {
+		p.parseError("Expected end of expression")
+	}
+	return expression
+}
+
+// Errors returns the syntax errors the parser recovered from, in the order
+// they were found.
+func (p *Parser) Errors() []*Error {
+	return p.errors
+}
+
+// parseLine parses a statement and its terminator. In recovery mode a
+// statement that fails to parse becomes a BadStatement made of the tokens up
+// to the end of the statement.
+func (p *Parser) parseLine() (statement ast.Statement) {
+	start := p.current
+	if p.Recover {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			err, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			p.report(err)
+			p.skipUntil(tokenizer.TOKEN_NEWLINE, tokenizer.TOKEN_COLON, tokenizer.TOKEN_COMMENT, tokenizer.TOKEN_EOF)
+			statement = &ast.BadStatement{Text: p.text(start, p.current), Pos: position(p.tokens[start])}
+		}()
+	}
+
+	statement = p.parseStatement()
+	if statement != nil {
+		p.endStatement()
+	}
+	return statement
+}
+
+// endStatement makes sure a complete statement is followed by a newline, a ':'
+// separator or the end of the file, and consumes that terminator. A comment
+// may also follow a statement on the same line; it becomes the next statement.
+func (p *Parser) endStatement() {
+	if p.match(tokenizer.TOKEN_NEWLINE) || p.match(tokenizer.TOKEN_COLON) {
+		return
+	}
+	if p.peek().Type == tokenizer.TOKEN_EOF || p.peek().Type == tokenizer.TOKEN_COMMENT {
+		return
+	}
+	p.parseError("Expected end of statement")
+}
+
+// skipSeparators skips blank lines and empty statements.
+func (p *Parser) skipSeparators() {
+	for p.match(tokenizer.TOKEN_NEWLINE) || p.match(tokenizer.TOKEN_COLON) {
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.tokens[p.current].Type {
 	case tokenizer.TOKEN_LET:
@@ -44,6 +119,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseCommentStatement()
 	case tokenizer.TOKEN_END:
 		return p.parseEndStatement()
+	case tokenizer.TOKEN_DATA:
+		return p.parseDataStatement()
+	case tokenizer.TOKEN_READ:
+		return p.parseReadStatement()
+	case tokenizer.TOKEN_RESTORE:
+		return p.parseRestoreStatement()
 	case tokenizer.TOKEN_EOF:
 		return nil
 	}
@@ -57,14 +138,15 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseLetStatement() ast.Statement {
-	p.consume(tokenizer.TOKEN_LET, "Expected LET keyword")
+	keyword := p.consume(tokenizer.TOKEN_LET, "Expected LET keyword")
 	varName := p.consume(tokenizer.TOKEN_IDENTIFIER, "Expected an identifier")
 	p.consume(tokenizer.TOKEN_EQUALS, "Expected '=' operator for assignment")
 	value := p.parseExpression()
 
 	return &ast.LetStatement{
-		Identifier: ast.Identifier{Name: varName.Value},
+		Identifier: ast.Identifier{Name: varName.Value, Pos: position(varName)},
 		Value:      value,
+		Pos:        position(keyword),
 	}
 }
 
@@ -75,54 +157,76 @@ func (p *Parser) parseAssignmentStatement() ast.Statement {
 	value := p.parseExpression()
 
 	return &ast.AssignmentStatement{
-		Identifier: ast.Identifier{Name: varName.Value},
+		Identifier: ast.Identifier{Name: varName.Value, Pos: position(varName)},
 		Value:      value,
+		Pos:        position(varName),
 	}
 }
 
 func (p *Parser) parseIfStatement() ast.Statement {
-	p.consume(tokenizer.TOKEN_IF, "Expected IF keyword")
+	keyword := p.consume(tokenizer.TOKEN_IF, "Expected IF keyword")
 	condition := p.parseExpression()
 	p.consume(tokenizer.TOKEN_THEN, "Exprected THEN keyword after condition")
-	thenBranch := p.parseStatement()
+	thenBranch := p.parseBranch("THEN")
 
 	var elseBranch ast.Statement = nil
 	if p.peek().Type == tokenizer.TOKEN_ELSE {
 		p.consume(tokenizer.TOKEN_ELSE, "Expected ELSE keyword")
-		elseBranch = p.parseStatement()
+		elseBranch = p.parseBranch("ELSE")
 	}
 
 	return &ast.IfStatement{
 		Condition:  condition,
 		ThenBranch: thenBranch,
 		ElseBranch: elseBranch,
+		Pos:        position(keyword),
 	}
 }
 
+// parseBranch parses the statement of a THEN or ELSE branch, which must
+// follow the keyword on the same line. A comment is no statement there: it
+// would leave the branch without code to run.
+func (p *Parser) parseBranch(keyword string) ast.Statement {
+	switch p.peek().Type {
+	case tokenizer.TOKEN_NEWLINE, tokenizer.TOKEN_COLON, tokenizer.TOKEN_EOF, tokenizer.TOKEN_COMMENT:
+		p.parseError("Expected statement after " + keyword)
+	}
+	return p.parseStatement()
+}
+
 func (p *Parser) parseWhileStatement() ast.Statement {
-	p.consume(tokenizer.TOKEN_WHILE, "Expected WHILE keyword")
+	keyword := p.consume(tokenizer.TOKEN_WHILE, "Expected WHILE keyword")
 	condition := p.parseExpression()
 	p.consume(tokenizer.TOKEN_DO, "Exprected DO keyword after condition")
 
 	doBranch := []ast.Statement{}
 
-	for p.peek().Type != tokenizer.TOKEN_STOP {
-		doBranch = append(doBranch, p.parseStatement())
+	p.skipSeparators()
+	for p.peek().Type != tokenizer.TOKEN_STOP && p.peek().Type != tokenizer.TOKEN_EOF {
+		doBranch = append(doBranch, p.parseLine())
+		p.skipSeparators()
+	}
+	if p.peek().Type == tokenizer.TOKEN_EOF {
+		// In recovery mode the loop is taken to end with the file
+		p.recoverableError(MissingStop)
+	} else {
+		p.consume(tokenizer.TOKEN_STOP, "Exprected STOP keyword after condition")
 	}
-	p.consume(tokenizer.TOKEN_STOP, "Exprected STOP keyword after condition")
 
 	return &ast.WhileStatement{
 		Condition: condition,
 		DoBranch:  doBranch,
+		Pos:       position(keyword),
 	}
 }
 
 func (p *Parser) parsePrintStatement() ast.Statement {
-	p.consume(tokenizer.TOKEN_PRINT, "Exprected PRINT keyword")
+	keyword := p.consume(tokenizer.TOKEN_PRINT, "Exprected PRINT keyword")
 	expression := p.parseExpression()
 
 	return &ast.PrintStatement{
 		Expression: expression,
+		Pos:        position(keyword),
 	}
 }
 
@@ -131,26 +235,79 @@ func (p *Parser) parseCommentStatement() ast.Statement {
 
 	return &ast.CommentStatement{
 		Text: text.Value,
+		Pos:  position(text),
 	}
 }
 
 func (p *Parser) parseEndStatement() ast.Statement {
-	p.consume(tokenizer.TOKEN_END, "Expected END keyword")
+	keyword := p.consume(tokenizer.TOKEN_END, "Expected END keyword")
+
+	return &ast.EndStatement{Pos: position(keyword)}
+}
+
+func (p *Parser) parseDataStatement() ast.Statement {
+	keyword := p.consume(tokenizer.TOKEN_DATA, "Expected DATA keyword")
+
+	values := []ast.Expression{p.parseDataValue()}
+	for p.match(tokenizer.TOKEN_COMMA) {
+		values = append(values, p.parseDataValue())
+	}
+
+	return &ast.DataStatement{
+		Values: values,
+		Pos:    position(keyword),
+	}
+}
+
+func (p *Parser) parseDataValue() ast.Expression {
+	if p.match(tokenizer.TOKEN_INTEGER) || p.match(tokenizer.TOKEN_FLOAT) {
+		return p.number()
+	}
+	if p.match(tokenizer.TOKEN_STRING) {
+		return &ast.StringLiteral{
+			Value: p.previous().Value,
+			Pos:   position(p.previous()),
+		}
+	}
+
+	p.parseError("Expected number or string in DATA list")
+	return nil
+}
+
+func (p *Parser) parseReadStatement() ast.Statement {
+	keyword := p.consume(tokenizer.TOKEN_READ, "Expected READ keyword")
+
+	varName := p.consume(tokenizer.TOKEN_IDENTIFIER, "Expected an identifier")
+	identifiers := []ast.Identifier{{Name: varName.Value, Pos: position(varName)}}
+	for p.match(tokenizer.TOKEN_COMMA) {
+		varName = p.consume(tokenizer.TOKEN_IDENTIFIER, "Expected an identifier after ','")
+		identifiers = append(identifiers, ast.Identifier{Name: varName.Value, Pos: position(varName)})
+	}
+
+	return &ast.ReadStatement{
+		Identifiers: identifiers,
+		Pos:         position(keyword),
+	}
+}
+
+func (p *Parser) parseRestoreStatement() ast.Statement {
+	keyword := p.consume(tokenizer.TOKEN_RESTORE, "Expected RESTORE keyword")
 
-	return &ast.EndStatement{}
+	return &ast.RestoreStatement{Pos: position(keyword)}
 }
 
 func (p *Parser) parseExpression() ast.Expression {
 	left := p.parseTerm()
 
 	for p.peek().Type == tokenizer.TOKEN_REL_OP {
-		operator := p.consume(p.peek().Type, "Expected relational operator.").Value
+		operator := p.consume(p.peek().Type, "Expected relational operator.")
 		right := p.parseTerm()
 
 		left = &ast.BinaryExpression{
 			Left:     left,
-			Operator: operator,
+			Operator: operator.Value,
 			Right:    right,
+			Pos:      position(operator),
 		}
 	}
 
@@ -161,12 +318,13 @@ func (p *Parser) parseTerm() ast.Expression {
 	left := p.parseFactor()
 
 	for p.peek().Type == tokenizer.TOKEN_ADD_SUB {
-		operator := p.consume(tokenizer.TOKEN_ADD_SUB, "Expected + or -").Value
+		operator := p.consume(tokenizer.TOKEN_ADD_SUB, "Expected + or -")
 		right := p.parseFactor()
 		left = &ast.BinaryExpression{
 			Left:     left,
-			Operator: operator,
+			Operator: operator.Value,
 			Right:    right,
+			Pos:      position(operator),
 		}
 	}
 
@@ -177,12 +335,13 @@ func (p *Parser) parseFactor() ast.Expression {
 	left := p.parsePrimaryExpression()
 
 	for p.peek().Type == tokenizer.TOKEN_MUL_DIV {
-		operator := p.consume(tokenizer.TOKEN_MUL_DIV, "Expected * or /").Value
+		operator := p.consume(tokenizer.TOKEN_MUL_DIV, "Expected * or /")
 		right := p.parsePrimaryExpression()
 		left = &ast.BinaryExpression{
 			Left:     left,
-			Operator: operator,
+			Operator: operator.Value,
 			Right:    right,
+			Pos:      position(operator),
 		}
 	}
 
@@ -190,29 +349,39 @@ func (p *Parser) parseFactor() ast.Expression {
 }
 
 func (p *Parser) parsePrimaryExpression() ast.Expression {
-	if p.match(tokenizer.TOKEN_INTEGER) {
-		return &ast.IntegerLiteral{
-			Value: atoi(p.previous().Value),
-		}
+	if p.match(tokenizer.TOKEN_INTEGER) || p.match(tokenizer.TOKEN_FLOAT) {
+		return p.number()
 	}
-	if p.match(tokenizer.TOKEN_FLOAT) {
-		return &ast.FloatLiteral{
-			Value: atof(p.previous().Value),
+	if p.match(tokenizer.TOKEN_STRING) {
+		return &ast.StringLiteral{
+			Value: p.previous().Value,
+			Pos:   position(p.previous()),
 		}
 	}
 	if p.match(tokenizer.TOKEN_IDENTIFIER) {
 		return &ast.Identifier{
 			Name: p.previous().Value,
+			Pos:  position(p.previous()),
 		}
 	}
 	if p.match(tokenizer.TOKEN_LEFT_PAREN) {
+		p.parens++
 		expression := p.parseExpression()
+		p.parens--
 		p.consume(tokenizer.TOKEN_RIGHT_PAREN, "Expected closing parenthesis.")
 		return expression
 	}
 
-	p.parseError("Exprected expression")
-	return nil
+	// In recovery mode the expression extends to a token that can follow it
+	start := p.current
+	p.recoverableError("Exprected expression")
+	follow := []tokenizer.TokenType{tokenizer.TOKEN_NEWLINE, tokenizer.TOKEN_COLON, tokenizer.TOKEN_COMMENT, tokenizer.TOKEN_EOF,
+		tokenizer.TOKEN_THEN, tokenizer.TOKEN_ELSE, tokenizer.TOKEN_DO}
+	if p.parens > 0 {
+		follow = append(follow, tokenizer.TOKEN_RIGHT_PAREN)
+	}
+	p.skipUntil(follow...)
+	return &ast.BadExpression{Text: p.text(start, p.current), Pos: position(p.tokens[start])}
 }
 
 func (p *Parser) peek() tokenizer.Token {
@@ -239,22 +408,97 @@ func (p *Parser) previous() tokenizer.Token {
 	return p.tokens[p.current-1]
 }
 
+// MissingStop is the message of the error at the end of the source when a
+// WHILE is not closed, which tells an incomplete program from a wrong one.
+const MissingStop = "Expected STOP keyword to close WHILE"
+
+// Error is a syntax error at a token. The parser panics with it, compiler.Parse
+// recovers it.
+type Error struct {
+	Token   tokenizer.Token
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Parse error at line %d, token {%s: %s}: %s", e.Token.Line, e.Token.Type, e.Token.Value, e.Message)
+}
+
 func (p *Parser) parseError(msg string) {
-	panic(fmt.Sprintf("Parse error at line %d, token {%s: %s}: %s", p.tokens[p.current].Line, p.tokens[p.current].Type, p.tokens[p.current].Value, msg))
+	panic(&Error{Token: p.tokens[p.current], Message: msg})
 }
 
-func atof(str string) float64 {
-	val, err := strconv.ParseFloat(str, 64)
-	if err != nil {
-		panic("Invalid number format")
+// recoverableError reports an error the parser can continue after. Outside
+// recovery mode it stops parsing like parseError.
+func (p *Parser) recoverableError(msg string) {
+	if !p.Recover {
+		p.parseError(msg)
 	}
-	return val
+	p.report(&Error{Token: p.peek(), Message: msg})
 }
 
-func atoi(str string) int {
-	val, err := strconv.Atoi(str)
-	if err != nil {
-		panic("Invalid integer format")
+// report records an error of recovery mode. Only the first error at a token
+// is kept, the others tend to follow from it.
+func (p *Parser) report(err *Error) {
+	if len(p.errors) > 0 {
+		last := p.errors[len(p.errors)-1].Token
+		if last.Line == err.Token.Line && last.Column == err.Token.Column {
+			return
+		}
+	}
+	p.errors = append(p.errors, err)
+}
+
+// skipUntil skips tokens up to one of the given types.
+func (p *Parser) skipUntil(types ...tokenizer.TokenType) {
+	for {
+		for _, tokenType := range types {
+			if p.peek().Type == tokenType {
+				return
+			}
+		}
+		p.current++
+	}
+}
+
+// text rebuilds the source of the tokens from start up to end, separated by
+// single spaces.
+func (p *Parser) text(start int, end int) string {
+	var out strings.Builder
+	for i := start; i < end; i++ {
+		token := p.tokens[i]
+		if i > start && p.tokens[i-1].Type != tokenizer.TOKEN_LEFT_PAREN && token.Type != tokenizer.TOKEN_RIGHT_PAREN && token.Type != tokenizer.TOKEN_COMMA {
+			out.WriteString(" ")
+		}
+		if token.Type == tokenizer.TOKEN_STRING {
+			out.WriteString("\"" + token.Value + "\"")
+			continue
+		}
+		out.WriteString(token.Value)
+	}
+	return out.String()
+}
+
+func position(token tokenizer.Token) ast.Position {
+	return ast.Position{Line: token.Line, Column: token.Column}
+}
+
+// number converts the integer or float literal of the previous token. A
+// literal out of the range of its type is an error at the token; in
+// recovery mode it becomes a BadExpression.
+func (p *Parser) number() ast.Expression {
+	token := p.previous()
+	if token.Type == tokenizer.TOKEN_INTEGER {
+		if value, err := strconv.Atoi(token.Value); err == nil {
+			return &ast.IntegerLiteral{Value: value, Pos: position(token)}
+		}
+	} else if value, err := strconv.ParseFloat(token.Value, 64); err == nil {
+		return &ast.FloatLiteral{Value: value, Pos: position(token)}
+	}
+
+	err := &Error{Token: token, Message: "Number out of range"}
+	if !p.Recover {
+		panic(err)
 	}
-	return val
+	p.report(err)
+	return &ast.BadExpression{Text: token.Value, Pos: position(token)}
 }
@@ -0,0 +1,218 @@
+package printer
+
+import (
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/tokenizer"
+)
+
+// Indentation is the indentation of every nesting level of WHILE bodies.
+const Indentation = "    "
+
+// Format parses source and prints it back in canonical form. Formatting
+// formatted source returns it unchanged.
+func Format(source string, options tokenizer.Options) (formatted string, err error) {
+	defer ast.Recover(&err)
+
+	program, err := compiler.Parse(source, options)
+	if err != nil {
+		return "", err
+	}
+	return Print(program), nil
+}
+
+// Print renders a program as Tiny BASIC source: one statement per line,
+// uppercase keywords, single spaces around operators, the bodies of WHILE
+// loops indented, and only the parentheses the precedence of the operators
+// requires. Comments are written with REM. The positions recorded by the
+// parser keep comments that followed a statement on the same line, and keep
+// one blank line where the source had blank lines between statements. Print
+// panics with an *ast.UnsupportedError on node types it does not handle.
+func Print(program *ast.Program) string {
+	p := &printer{}
+	p.block(program.Statements, false)
+
+	if len(p.lines) == 0 {
+		return ""
+	}
+	return strings.Join(p.lines, "\n") + "\n"
+}
+
+type printer struct {
+	lines []string
+	level int
+	// join is put between the last line and the next text written, instead
+	// of starting a new line
+	join string
+	// lastLine is the source line where the last printed statement ended
+	lastLine int
+}
+
+func (p *printer) write(text string) {
+	// Missing expressions are empty, the keywords before them keep no space
+	text = strings.TrimRight(text, " ")
+	if p.join != "" && len(p.lines) > 0 {
+		p.lines[len(p.lines)-1] += p.join + text
+		p.join = ""
+		return
+	}
+	p.lines = append(p.lines, strings.Repeat(Indentation, p.level)+text)
+}
+
+// block prints a list of statements. nested is true for WHILE bodies, which
+// never start with a blank line.
+func (p *printer) block(statements []ast.Statement, nested bool) {
+	for i, stmt := range statements {
+		line := ast.PositionOf(stmt).Line
+		switch {
+		case isComment(stmt) && line == p.lastLine && len(p.lines) > 0:
+			p.join = " "
+		case line > p.lastLine+1 && p.lastLine > 0 && (i > 0 || !nested):
+			p.lines = append(p.lines, "")
+		}
+
+		p.statement(stmt)
+		p.lastLine = endLine(stmt)
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.PrintStatement:
+		p.write("PRINT " + expression(stmt.Expression))
+	case *ast.LetStatement:
+		p.write("LET " + stmt.Identifier.Name + " = " + expression(stmt.Value))
+	case *ast.AssignmentStatement:
+		p.write(stmt.Identifier.Name + " = " + expression(stmt.Value))
+	case *ast.IfStatement:
+		p.write("IF " + expression(stmt.Condition) + " THEN")
+		p.join = " "
+		p.statement(stmt.ThenBranch)
+		if stmt.ElseBranch != nil {
+			p.join = " "
+			p.write("ELSE")
+			p.join = " "
+			p.statement(stmt.ElseBranch)
+		}
+	case *ast.WhileStatement:
+		p.write("WHILE " + expression(stmt.Condition) + " DO")
+		p.lastLine = stmt.Pos.Line
+		p.level++
+		p.block(stmt.DoBranch, true)
+		p.level--
+		p.write("STOP")
+	case *ast.EndStatement:
+		p.write("END")
+	case *ast.CommentStatement:
+		p.write(comment(stmt.Text))
+	case *ast.DataStatement:
+		values := []string{}
+		for _, value := range stmt.Values {
+			values = append(values, expression(value))
+		}
+		p.write("DATA " + strings.Join(values, ", "))
+	case *ast.ReadStatement:
+		names := []string{}
+		for _, identifier := range stmt.Identifiers {
+			names = append(names, identifier.Name)
+		}
+		p.write("READ " + strings.Join(names, ", "))
+	case *ast.RestoreStatement:
+		p.write("RESTORE")
+	case *ast.BadStatement:
+		p.write(stmt.Text)
+	default:
+		panic(&ast.UnsupportedError{Node: stmt})
+	}
+}
+
+// comment writes a comment with REM. The text is kept, apart from trailing
+// whitespace, but separated from REM by a space so that it cannot merge with
+// the keyword.
+func comment(text string) string {
+	text = strings.TrimRight(text, " \t\r")
+	if text == "" || strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+		return "REM" + text
+	}
+	return "REM " + text
+}
+
+// precedence returns the binding strength of a binary operator, following
+// the levels of the parser: relational operators bind loosest, then the
+// additive and the multiplicative ones.
+func precedence(operator string) int {
+	switch operator {
+	case "*", "/":
+		return 3
+	case "+", "-":
+		return 2
+	}
+	return 1
+}
+
+// Expression renders an expression the way Print writes it in statements.
+func Expression(expr ast.Expression) string {
+	return expression(expr)
+}
+
+func expression(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Name
+	case *ast.IntegerLiteral:
+		return strconv.Itoa(expr.Value)
+	case *ast.FloatLiteral:
+		literal := strconv.FormatFloat(expr.Value, 'f', -1, 64)
+		if !strings.Contains(literal, ".") {
+			literal += ".0"
+		}
+		return literal
+	case *ast.StringLiteral:
+		return "\"" + expr.Value + "\""
+	case *ast.BinaryExpression:
+		// Operators of the same level associate to the left, so a right
+		// operand of the same level keeps its parentheses
+		left := operand(expr.Left, precedence(expr.Operator))
+		right := operand(expr.Right, precedence(expr.Operator)+1)
+		// A missing right operand must not leave a space behind
+		return strings.TrimRight(left+" "+expr.Operator+" "+right, " ")
+	case *ast.BadExpression:
+		return expr.Text
+	}
+	panic(&ast.UnsupportedError{Node: expr})
+}
+
+// operand prints an operand, in parentheses when it binds looser than
+// minimum.
+func operand(expr ast.Expression, minimum int) string {
+	if binary, ok := expr.(*ast.BinaryExpression); ok && precedence(binary.Operator) < minimum {
+		return "(" + expression(expr) + ")"
+	}
+	return expression(expr)
+}
+
+func isComment(stmt ast.Statement) bool {
+	_, ok := stmt.(*ast.CommentStatement)
+	return ok
+}
+
+// endLine returns the line a statement ends on. The parser does not record
+// where STOP is, so a WHILE is taken to end on the line after its body, which
+// is where Print puts STOP.
+func endLine(stmt ast.Statement) int {
+	switch stmt := stmt.(type) {
+	case *ast.IfStatement:
+		if stmt.ElseBranch != nil {
+			return endLine(stmt.ElseBranch)
+		}
+		return endLine(stmt.ThenBranch)
+	case *ast.WhileStatement:
+		if len(stmt.DoBranch) == 0 {
+			return stmt.Pos.Line + 1
+		}
+		return endLine(stmt.DoBranch[len(stmt.DoBranch)-1]) + 1
+	}
+	return ast.PositionOf(stmt).Line
+}
@@ -0,0 +1,82 @@
+package printer_test
+
+import (
+	"testing"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/conformance"
+	"tiny-basic/src/printer"
+	"tiny-basic/src/tokenizer"
+)
+
+// FuzzFormat checks that formatting is idempotent: formatting formatted
+// source returns it unchanged.
+func FuzzFormat(f *testing.F) {
+	cases, err := conformance.Cases()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, c := range cases {
+		f.Add(c.Source)
+	}
+	for _, source := range []string{
+		"'\r ",
+		"REM\tx \r\n",
+		"PRINT 1 ' one\n\n\nPRINT 2\n",
+		"IF 1 < 2 THEN PRINT 1 ELSE PRINT 2\n",
+		"LET X = 0\nWHILE X < 3 DO\nX = X + 1 : PRINT X\nSTOP\n",
+		"PRINT (1 + 2) * (3 / (4 * 5))\n",
+		"LET A = 5 : PRINT A-1 : PRINT A - -1 : PRINT 10 -3 - (2 - 1)\n",
+		"DATA 1, 2.5, \"A\" : READ A, B, C : RESTORE\n",
+	} {
+		f.Add(source)
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		formatted, err := printer.Format(source, tokenizer.Options{})
+		if err != nil {
+			return
+		}
+		again, err := printer.Format(formatted, tokenizer.Options{})
+		if err != nil {
+			t.Fatalf("formatted source does not parse: %v\n%s", err, formatted)
+		}
+		if again != formatted {
+			t.Fatalf("formatting is not idempotent:\n--- first\n%q\n--- second\n%q", formatted, again)
+		}
+	})
+}
+
+// TestPrintSubtraction checks that subtractions, which the JSON form of the
+// tree can hold whatever their operands, print to source parsing back to the
+// same tree.
+func TestPrintSubtraction(t *testing.T) {
+	x := func() ast.Expression { return &ast.Identifier{Name: "X"} }
+	integer := func(value int) ast.Expression { return &ast.IntegerLiteral{Value: value} }
+	minus := func(left, right ast.Expression) ast.Expression {
+		return &ast.BinaryExpression{Left: left, Operator: "-", Right: right}
+	}
+
+	for _, expr := range []ast.Expression{
+		minus(x(), integer(1)),
+		minus(x(), integer(-1)),
+		minus(integer(-1), x()),
+		minus(minus(x(), integer(1)), integer(2)),
+		minus(x(), minus(integer(1), integer(2))),
+		&ast.BinaryExpression{Left: integer(2), Operator: "*", Right: minus(x(), integer(-3))},
+	} {
+		program := &ast.Program{Statements: []ast.Statement{
+			&ast.LetStatement{Identifier: ast.Identifier{Name: "X"}, Value: integer(5)},
+			&ast.PrintStatement{Expression: expr},
+		}}
+		source := printer.Print(program)
+		parsed, err := compiler.Parse(source, tokenizer.Options{})
+		if err != nil {
+			t.Errorf("%q does not parse: %v", source, err)
+			continue
+		}
+		if !ast.Equal(program, parsed) {
+			t.Errorf("%q parses to a different tree", source)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"tiny-basic/src/repl"
+)
+
+// runREPL reads Tiny BASIC statements from the standard input and executes
+// them as they are entered.
+func runREPL(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	lexerOptions := lexerFlags(flags)
+	flags.Parse(args)
+
+	r := repl.New(os.Stdout, lexerOptions())
+	// Input piped from a file gets no prompts
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Println("Tiny BASIC. Numbered lines are stored, LIST, RUN, NEW, SAVE and LOAD work on them.")
+		r.Prompt = "> "
+	}
+	if err := r.Run(os.Stdin); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,291 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"tiny-basic/src/ast"
+	"tiny-basic/src/compiler"
+	"tiny-basic/src/interpreter"
+	"tiny-basic/src/optimizer"
+	"tiny-basic/src/parser"
+	"tiny-basic/src/semantic"
+	"tiny-basic/src/tokenizer"
+)
+
+// REPL reads statements line by line and executes them immediately, the way
+// classic BASIC interpreters did. Lines starting with a number are stored in
+// a program instead, which the commands LIST, RUN, NEW, SAVE and LOAD work
+// on. Declarations and variables persist from one entry to the next; an
+// entry that fails to parse or analyze changes nothing.
+type REPL struct {
+	output  io.Writer
+	options tokenizer.Options
+	// Prompt is written before every entry, an empty prompt writes none
+	Prompt string
+
+	analyzer    *semantic.SemanticAnalyzer
+	interpreter *interpreter.Interpreter
+	// lines is the stored program, by line number
+	lines map[int]string
+}
+
+func New(output io.Writer, options tokenizer.Options) *REPL {
+	return &REPL{
+		output:      output,
+		options:     options,
+		analyzer:    semantic.NewSemanticAnalyzer(),
+		interpreter: interpreter.New(output),
+		lines:       make(map[int]string),
+	}
+}
+
+// Run reads entries from input until it ends.
+func (r *REPL) Run(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	// pending holds the lines of an entry that is not complete yet
+	pending := ""
+	for {
+		switch {
+		case r.Prompt == "":
+		case pending != "":
+			fmt.Fprint(r.output, strings.Repeat(".", len(strings.TrimSpace(r.Prompt)))+" ")
+		default:
+			fmt.Fprint(r.output, r.Prompt)
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if pending == "" {
+			if line == "" || r.command(line) {
+				continue
+			}
+			if number, text, found := lineNumber(line); found {
+				r.store(number, text)
+				continue
+			}
+		}
+		pending = r.immediate(pending + line + "\n")
+	}
+}
+
+// command runs a REPL command and reports whether the line was one.
+func (r *REPL) command(line string) bool {
+	name, argument, _ := strings.Cut(line, " ")
+	argument = strings.Trim(strings.TrimSpace(argument), "\"")
+
+	switch strings.ToUpper(name) {
+	case "LIST":
+		if argument != "" {
+			return false
+		}
+		for _, number := range r.numbers() {
+			fmt.Fprintf(r.output, "%d %s\n", number, r.lines[number])
+		}
+	case "RUN":
+		if argument != "" {
+			return false
+		}
+		r.run()
+	case "NEW":
+		if argument != "" {
+			return false
+		}
+		r.lines = make(map[int]string)
+		r.reset()
+	case "SAVE":
+		if argument == "" {
+			return false
+		}
+		if err := r.save(argument); err != nil {
+			fmt.Fprintln(r.output, "Error:", err)
+		}
+	case "LOAD":
+		if argument == "" {
+			return false
+		}
+		if err := r.load(argument); err != nil {
+			fmt.Fprintln(r.output, "Error:", err)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// immediate executes an entry and returns it when it is incomplete, so that
+// the next line continues it.
+func (r *REPL) immediate(source string) string {
+	program, err := compiler.Parse(source, r.options)
+	var parseErr *parser.Error
+	if errors.As(err, &parseErr) && parseErr.Message == parser.MissingStop && parseErr.Token.Type == tokenizer.TOKEN_EOF {
+		return source
+	}
+	if err != nil {
+		r.report(err, nil)
+		return ""
+	}
+
+	program = optimizer.Optimize(program)
+	analyzer := r.analyzer.Fork()
+	if err := analyzer.Analyze(program); err != nil {
+		r.report(err, nil)
+		return ""
+	}
+	// The entry takes effect only when it runs to the end: an error drops
+	// its declarations and the values it assigned
+	in := r.interpreter.Fork()
+	if err := r.execute(in, analyzer, program, nil); err != nil {
+		return ""
+	}
+	r.analyzer = analyzer
+	r.interpreter = in
+	return ""
+}
+
+// run executes the stored program from a clean state. The variables it
+// leaves behind can be inspected afterwards.
+func (r *REPL) run() {
+	numbers := r.numbers()
+	lines := []string{}
+	for _, number := range numbers {
+		lines = append(lines, r.lines[number])
+	}
+
+	result, err := compiler.Compile(strings.Join(lines, "\n")+"\n", r.options)
+	if err != nil {
+		r.report(err, numbers)
+		return
+	}
+	r.reset()
+	r.analyzer = result.Analyzer
+	r.execute(r.interpreter, r.analyzer, result.Program, numbers)
+}
+
+// execute interprets a program that passed analysis and reports the error
+// that stopped it, if any. Ctrl-C stops it without leaving the REPL.
+func (r *REPL) execute(in *interpreter.Interpreter, analyzer *semantic.SemanticAnalyzer, program *ast.Program, numbers []int) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := in.Run(ctx, program, analyzer.Types())
+	if err != nil {
+		r.report(err, numbers)
+	}
+	return err
+}
+
+func (r *REPL) reset() {
+	r.analyzer = semantic.NewSemanticAnalyzer()
+	r.interpreter.Reset()
+}
+
+func (r *REPL) store(number int, text string) {
+	if text == "" {
+		delete(r.lines, number)
+		return
+	}
+	r.lines[number] = text
+}
+
+func (r *REPL) numbers() []int {
+	numbers := []int{}
+	for number := range r.lines {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// save writes the stored program as a plain .tb file, without its line
+// numbers, so that the compiler accepts it.
+func (r *REPL) save(file string) error {
+	var out strings.Builder
+	for _, number := range r.numbers() {
+		out.WriteString(r.lines[number] + "\n")
+	}
+	return os.WriteFile(file, []byte(out.String()), 0644)
+}
+
+// load replaces the stored program with a file. Files with line numbers keep
+// them, plain .tb files are numbered in steps of 10; blank lines are dropped.
+func (r *REPL) load(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	entries := []string{}
+	numbered := true
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, _, found := lineNumber(line); !found {
+			numbered = false
+		}
+		entries = append(entries, line)
+	}
+
+	lines := make(map[int]string)
+	for i, entry := range entries {
+		if number, text, found := lineNumber(entry); numbered && found {
+			lines[number] = text
+			continue
+		}
+		lines[(i+1)*10] = entry
+	}
+	r.lines = lines
+	return nil
+}
+
+// report prints an error. numbers maps the lines of the stored program to
+// their line numbers; immediate entries have none.
+func (r *REPL) report(err error, numbers []int) {
+	line := 0
+	message := err.Error()
+
+	var parseErr *parser.Error
+	var semanticErr *semantic.Error
+	var runtimeErr *interpreter.Error
+	switch {
+	case errors.As(err, &parseErr):
+		line, message = parseErr.Token.Line, "Syntax error: "+parseErr.Message
+	case errors.As(err, &semanticErr):
+		line, message = semanticErr.Pos.Line, "Error: "+semanticErr.Message
+	case errors.As(err, &runtimeErr):
+		line, message = runtimeErr.Pos.Line, "Runtime error: "+runtimeErr.Message
+	}
+
+	if 0 < line && line <= len(numbers) {
+		message += fmt.Sprintf(" in line %d", numbers[line-1])
+	}
+	fmt.Fprintln(r.output, message)
+}
+
+// lineNumber splits a line starting with a line number. A number alone
+// deletes the line, so text may be empty.
+func lineNumber(line string) (int, string, bool) {
+	digits := 0
+	for digits < len(line) && '0' <= line[digits] && line[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || (digits < len(line) && line[digits] != ' ' && line[digits] != '\t') {
+		return 0, "", false
+	}
+	number, err := strconv.Atoi(line[:digits])
+	if err != nil {
+		return 0, "", false
+	}
+	return number, strings.TrimSpace(line[digits:]), true
+}
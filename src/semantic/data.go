@@ -0,0 +1,22 @@
+package semantic
+
+import (
+	"tiny-basic/src/ast"
+)
+
+// CollectData returns every DATA value of the program in the order READ
+// consumes them, which is the order the DATA statements appear in the source.
+func CollectData(program *ast.Program) []ast.Expression {
+	pool := []ast.Expression{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.DataStatement:
+			pool = append(pool, node.Values...)
+		case ast.Expression:
+		default:
+			return true
+		}
+		return false
+	})
+	return pool
+}
@@ -1,12 +1,35 @@
 package semantic
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"tiny-basic/src/ast"
 )
 
+// Error is a semantic error located at the node that caused it, so tools can
+// point at it. Its message is the same as the unlocated error's.
+type Error struct {
+	Pos     ast.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// errorAt locates err at pos, unless it is already located.
+func errorAt(pos ast.Position, err error) error {
+	var located *Error
+	if err == nil || errors.As(err, &located) {
+		return err
+	}
+	return &Error{Pos: pos, Message: err.Error()}
+}
+
 type SemanticAnalyzer struct {
 	symbolTable *SymbolTable
+	types       *Types
 }
 
 func NewSemanticAnalyzer() *SemanticAnalyzer {
@@ -20,19 +43,61 @@ func (sa *SemanticAnalyzer) Analyze(program *ast.Program) error {
 		}
 	}
 
+	// Programs analyzed in parts build on the types of the earlier parts
+	var types *Types
+	var err error
+	if sa.types == nil {
+		types, err = InferTypes(program)
+	} else {
+		types, err = sa.types.Extend(program)
+	}
+	if err != nil {
+		return err
+	}
+	sa.types = types
+
 	return nil
 }
 
+// Fork returns an analyzer that knows the declarations and types sa knows.
+// Analyzing with the fork leaves sa unchanged, so a part of a program that
+// fails analysis can be dropped.
+func (sa *SemanticAnalyzer) Fork() *SemanticAnalyzer {
+	fork := &SemanticAnalyzer{symbolTable: NewSymbolTable(), types: sa.types}
+	for name, entry := range sa.symbolTable.variables {
+		copied := *entry
+		fork.symbolTable.variables[name] = &copied
+	}
+	return fork
+}
+
+// Types returns the types inferred by the last call to Analyze.
+func (sa *SemanticAnalyzer) Types() *Types {
+	return sa.types
+}
+
 func (sa *SemanticAnalyzer) CheckUnusedVariables() []string {
 	var warnings []string
 
+	for _, name := range sa.UnusedVariables() {
+		warnings = append(warnings, fmt.Sprintf("Warning: Variable '%s' is declared but never used", name))
+	}
+	return warnings
+}
+
+// UnusedVariables returns the names of the variables that are declared but
+// never read, in alphabetical order.
+func (sa *SemanticAnalyzer) UnusedVariables() []string {
+	var names []string
+
 	for _, entry := range sa.symbolTable.variables {
 		if entry.Used {
 			continue
 		}
-		warnings = append(warnings, fmt.Sprintf("Warning: Variable '%s' is declared but never used", entry.Name))
+		names = append(names, entry.Name)
 	}
-	return warnings
+	sort.Strings(names)
+	return names
 }
 
 func (sa *SemanticAnalyzer) analyzeStatement(stmt ast.Statement) error {
@@ -47,10 +112,15 @@ func (sa *SemanticAnalyzer) analyzeStatement(stmt ast.Statement) error {
 		return sa.analyzeIfStatement(stmt)
 	case *ast.WhileStatement:
 		return sa.analyzeWhileStatement(stmt)
-	case *ast.EndStatement, *ast.CommentStatement:
+	case *ast.ReadStatement:
+		return sa.analyzeReadStatement(stmt)
+	case *ast.EndStatement, *ast.CommentStatement, *ast.DataStatement, *ast.RestoreStatement:
+		return nil
+	case *ast.BadStatement:
+		// The parser already reported it
 		return nil
 	default:
-		return fmt.Errorf("unknown statement type")
+		return &ast.UnsupportedError{Node: stmt}
 	}
 }
 
@@ -59,11 +129,20 @@ func (sa *SemanticAnalyzer) analyzeLetStatement(stmt *ast.LetStatement) error {
 		return err
 	}
 
-	return sa.symbolTable.DeclareVariable(stmt.Identifier.Name, stmt.Value)
+	return errorAt(stmt.Identifier.Pos, sa.symbolTable.DeclareVariable(stmt.Identifier.Name, stmt.Value))
 }
 
 func (sa *SemanticAnalyzer) analyzeAssignmentStatement(stmt *ast.AssignmentStatement) error {
-	return sa.symbolTable.AssignVariable(stmt.Identifier.Name, stmt.Value)
+	return errorAt(stmt.Identifier.Pos, sa.symbolTable.AssignVariable(stmt.Identifier.Name, stmt.Value))
+}
+
+func (sa *SemanticAnalyzer) analyzeReadStatement(stmt *ast.ReadStatement) error {
+	for _, identifier := range stmt.Identifiers {
+		if err := sa.symbolTable.AssignVariable(identifier.Name, nil); err != nil {
+			return errorAt(identifier.Pos, err)
+		}
+	}
+	return nil
 }
 
 func (sa *SemanticAnalyzer) analyzePrintStatement(stmt *ast.PrintStatement) error {
@@ -76,7 +155,7 @@ func (sa *SemanticAnalyzer) analyzeIfStatement(stmt *ast.IfStatement) error {
 	}
 
 	if !sa.isBooleanExpression(stmt.Condition) {
-		return fmt.Errorf("condition in IF statement must be a comparison (==, <, >), got: %T", stmt.Condition)
+		return errorAt(stmt.Pos, fmt.Errorf("condition in IF statement must be a comparison (==, <, >), got: %T", stmt.Condition))
 	}
 
 	if err := sa.analyzeStatement(stmt.ThenBranch); err != nil {
@@ -98,7 +177,7 @@ func (sa *SemanticAnalyzer) analyzeWhileStatement(stmt *ast.WhileStatement) erro
 	}
 
 	if !sa.isBooleanExpression(stmt.Condition) {
-		return fmt.Errorf("condition in WHILE statement must be a comparison (==, <, >), got: %T", stmt.Condition)
+		return errorAt(stmt.Pos, fmt.Errorf("condition in WHILE statement must be a comparison (==, <, >), got: %T", stmt.Condition))
 	}
 
 	for _, statement := range stmt.DoBranch {
@@ -111,23 +190,29 @@ func (sa *SemanticAnalyzer) analyzeWhileStatement(stmt *ast.WhileStatement) erro
 
 func (sa *SemanticAnalyzer) analyzeExpression(expr ast.Expression) error {
 	switch expr := expr.(type) {
-	case *ast.IntegerLiteral, *ast.FloatLiteral:
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
 		return nil
 	case *ast.Identifier:
 		_, err := sa.symbolTable.GetVariable(expr.Name)
-		return err
+		return errorAt(expr.Pos, err)
 	case *ast.BinaryExpression:
 		if err := sa.analyzeExpression(expr.Left); err != nil {
 			return err
 		}
-		if err := sa.analyzeExpression(expr.Right); err != nil {
-			return err
-		}
+		return sa.analyzeExpression(expr.Right)
+	case *ast.BadExpression:
+		// The parser already reported it
+		return nil
 	}
-	return nil
+	return &ast.UnsupportedError{Node: expr}
 }
 
 func (sa *SemanticAnalyzer) isBooleanExpression(expr ast.Expression) bool {
+	// A malformed condition was already reported by the parser
+	if _, bad := expr.(*ast.BadExpression); bad {
+		return true
+	}
+
 	binExpr, ok := expr.(*ast.BinaryExpression)
 	if !ok {
 		return false
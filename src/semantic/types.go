@@ -0,0 +1,242 @@
+package semantic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tiny-basic/src/ast"
+)
+
+// Type is the static type of a variable or an expression. Statically typed
+// targets need it to declare variables; every target needs it to tell
+// integer division, which truncates toward zero, from float division.
+type Type int
+
+const (
+	Unknown Type = iota
+	Integer
+	Float
+	String
+	Boolean
+)
+
+func (t Type) String() string {
+	switch t {
+	case Integer:
+		return "Integer"
+	case Float:
+		return "Float"
+	case String:
+		return "String"
+	case Boolean:
+		return "Boolean"
+	default:
+		return "Unknown"
+	}
+}
+
+// Types holds the inferred type of every variable of a program. A variable
+// takes the widest type of all the values assigned to it, where Integer
+// widens to Float and every other combination is a type error.
+type Types struct {
+	variables map[string]Type
+}
+
+type assignment struct {
+	name  string
+	value ast.Expression
+	pos   ast.Position
+}
+
+func InferTypes(program *ast.Program) (*Types, error) {
+	return inferTypes(&Types{variables: make(map[string]Type)}, program)
+}
+
+// Extend infers the types of a program that continues the one t was inferred
+// for, as the entries of the REPL do. Variables keep their types unless the
+// program widens them; t itself is not changed.
+func (t *Types) Extend(program *ast.Program) (*Types, error) {
+	extended := &Types{variables: make(map[string]Type)}
+	for name, variableType := range t.variables {
+		extended.variables[name] = variableType
+	}
+	return inferTypes(extended, program)
+}
+
+func inferTypes(t *Types, program *ast.Program) (*Types, error) {
+	assignments := []assignment{}
+	expressions := []ast.Expression{}
+	for _, stmt := range program.Statements {
+		collectTypedStatement(stmt, &assignments, &expressions)
+	}
+
+	for _, a := range assignments {
+		if _, known := t.variables[a.name]; !known {
+			t.variables[a.name] = suffixType(a.name)
+		}
+	}
+
+	// Assignments may depend on each other, so widen until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for _, a := range assignments {
+			valueType, _ := t.assignedType(a)
+			if joined, err := join(t.variables[a.name], valueType); err == nil && joined != t.variables[a.name] {
+				t.variables[a.name] = joined
+				changed = true
+			}
+		}
+	}
+
+	for name, variableType := range t.variables {
+		if variableType == Unknown {
+			t.variables[name] = Integer
+		}
+	}
+
+	for _, a := range assignments {
+		valueType, err := t.assignedType(a)
+		if err != nil {
+			return nil, err
+		}
+
+		variableType := t.variables[a.name]
+		if suffix := suffixType(a.name); suffix != Unknown {
+			variableType = suffix
+		}
+		if joined, err := join(variableType, valueType); err != nil || joined != variableType {
+			return nil, errorAt(a.pos, fmt.Errorf("cannot assign %s value to variable '%s' of type %s", valueType, a.name, variableType))
+		}
+	}
+	for _, expr := range expressions {
+		if _, err := t.typeOf(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Variable returns the type of a variable.
+func (t *Types) Variable(name string) Type {
+	return t.variables[name]
+}
+
+// Variables returns the names of all variables in alphabetical order.
+func (t *Types) Variables() []string {
+	names := []string{}
+	for name := range t.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Of returns the type of an expression of the program.
+func (t *Types) Of(expr ast.Expression) Type {
+	exprType, _ := t.typeOf(expr)
+	return exprType
+}
+
+func (t *Types) assignedType(a assignment) (Type, error) {
+	if a.value != nil {
+		return t.typeOf(a.value)
+	}
+
+	// READ does not widen its target: the variable keeps the type of its
+	// suffix or declaration, and every value read is checked against it at
+	// run time
+	return suffixType(a.name), nil
+}
+
+func (t *Types) typeOf(expr ast.Expression) (Type, error) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Integer, nil
+	case *ast.FloatLiteral:
+		return Float, nil
+	case *ast.StringLiteral:
+		return String, nil
+	case *ast.Identifier:
+		return t.variables[expr.Name], nil
+	case *ast.BadExpression:
+		return Unknown, nil
+	case *ast.BinaryExpression:
+		left, err := t.typeOf(expr.Left)
+		if err != nil {
+			return Unknown, err
+		}
+		right, err := t.typeOf(expr.Right)
+		if err != nil {
+			return Unknown, err
+		}
+		exprType, err := binaryType(expr.Operator, left, right)
+		return exprType, errorAt(expr.Pos, err)
+	}
+	return Unknown, &ast.UnsupportedError{Node: expr}
+}
+
+func binaryType(operator string, left Type, right Type) (Type, error) {
+	operands, err := join(left, right)
+	if err != nil || operands == Boolean {
+		return Unknown, fmt.Errorf("operator '%s' cannot be applied to %s and %s", operator, left, right)
+	}
+
+	switch operator {
+	case "==", "<", ">":
+		return Boolean, nil
+	case "+":
+		return operands, nil
+	}
+	if operands == String {
+		return Unknown, fmt.Errorf("operator '%s' cannot be applied to %s and %s", operator, left, right)
+	}
+	return operands, nil
+}
+
+func join(a Type, b Type) (Type, error) {
+	switch {
+	case a == Unknown:
+		return b, nil
+	case b == Unknown || a == b:
+		return a, nil
+	case (a == Integer || a == Float) && (b == Integer || b == Float):
+		return Float, nil
+	}
+	return Unknown, fmt.Errorf("type mismatch between %s and %s", a, b)
+}
+
+func suffixType(name string) Type {
+	switch {
+	case strings.HasSuffix(name, "$"):
+		return String
+	case strings.HasSuffix(name, "%"):
+		return Integer
+	}
+	return Unknown
+}
+
+func collectTypedStatement(stmt ast.Statement, assignments *[]assignment, expressions *[]ast.Expression) {
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			*assignments = append(*assignments, assignment{name: node.Identifier.Name, value: node.Value, pos: node.Identifier.Pos})
+		case *ast.AssignmentStatement:
+			*assignments = append(*assignments, assignment{name: node.Identifier.Name, value: node.Value, pos: node.Identifier.Pos})
+		case *ast.ReadStatement:
+			for _, identifier := range node.Identifiers {
+				*assignments = append(*assignments, assignment{name: identifier.Name, pos: identifier.Pos})
+			}
+		case *ast.PrintStatement:
+			*expressions = append(*expressions, node.Expression)
+		case *ast.IfStatement:
+			*expressions = append(*expressions, node.Condition)
+			return true
+		case *ast.WhileStatement:
+			*expressions = append(*expressions, node.Condition)
+			return true
+		}
+		// The expressions of other statements are typed as part of them
+		return false
+	})
+}
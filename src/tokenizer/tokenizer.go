@@ -1,20 +1,32 @@
 package tokenizer
 
 import (
+	"strings"
 	"unicode"
 )
 
 func Tokenize(input string) ([]Token, error) {
+	return TokenizeWithOptions(input, Options{})
+}
+
+func TokenizeWithOptions(input string, options Options) ([]Token, error) {
 	var tokens []Token
 	i := 0
 	runes := []rune(input)
 	line := 1
+	lineStart := 0
 
 	for i < len(runes) {
 		ch := runes[i]
+		column := i - lineStart + 1
 
+		// Newlines end statements, so they are kept as tokens
 		if ch == '\n' {
+			tokens = append(tokens, Token{Type: TOKEN_NEWLINE, Value: "\\n", Line: line, Column: column})
 			line++
+			i++
+			lineStart = i
+			continue
 		}
 
 		if unicode.IsSpace(ch) {
@@ -22,8 +34,9 @@ func Tokenize(input string) ([]Token, error) {
 			continue
 		}
 
-		// Handle numbers
-		if unicode.IsDigit(ch) || ch == '-' {
+		// Handle numbers. A '-' is the sign of a number only where an operand
+		// is expected; after one it is the subtraction operator.
+		if unicode.IsDigit(ch) || ch == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) && !endsOperand(tokens) {
 			start := i
 
 			if ch == '-' {
@@ -39,47 +52,70 @@ func Tokenize(input string) ([]Token, error) {
 				for i < len(runes) && unicode.IsDigit(runes[i]) {
 					i++
 				}
-				tokens = append(tokens, Token{Type: TOKEN_FLOAT, Value: string(runes[start:i]), Line: line})
+				tokens = append(tokens, Token{Type: TOKEN_FLOAT, Value: string(runes[start:i]), Line: line, Column: column})
 				continue
 			}
 
-			tokens = append(tokens, Token{Type: TOKEN_INTEGER, Value: string(runes[start:i]), Line: line})
+			tokens = append(tokens, Token{Type: TOKEN_INTEGER, Value: string(runes[start:i]), Line: line, Column: column})
 			continue
 		}
 
-		// Handle comments
-		const remKeyword = "REM"
-		if i+len(remKeyword) <= len(runes) && string(runes[i:i+3]) == remKeyword {
-			i += 3
-			start := i
-
-			for i < len(runes) && runes[i] != '\n' {
-				i++
-			}
-			tokens = append(tokens, Token{Type: TOKEN_COMMENT, Value: string(runes[start : i-1]), Line: line})
+		// Handle apostrophe comments
+		if ch == '\'' {
+			var text string
+			i, text = scanComment(runes, i+1)
+			tokens = append(tokens, Token{Type: TOKEN_COMMENT, Value: text, Line: line, Column: column})
 			continue
 		}
 
 		// Handle keywords and identifiers
 		if unicode.IsLetter(ch) {
 			start := i
-			for i < len(runes) && unicode.IsLetter(runes[i]) {
+			for i < len(runes) && isIdentifierRune(runes[i], options) {
 				i++
 			}
 
 			word := string(runes[start:i])
 
-			if tokenType, found := keywords[word]; found {
-				tokens = append(tokens, Token{Type: tokenType, Value: word, Line: line})
-			} else {
-				tokens = append(tokens, Token{Type: TOKEN_IDENTIFIER, Value: word, Line: line})
+			// REM is only a comment when it is a whole word, so REMAINDER stays an identifier
+			if options.isRem(word) {
+				var text string
+				i, text = scanComment(runes, i)
+				tokens = append(tokens, Token{Type: TOKEN_COMMENT, Value: text, Line: line, Column: column})
+				continue
+			}
+
+			if tokenType, found := options.keyword(word); found {
+				tokens = append(tokens, Token{Type: tokenType, Value: string(tokenType), Line: line, Column: column})
+				continue
+			}
+
+			if options.ExtendedNames && i < len(runes) && (runes[i] == '$' || runes[i] == '%') {
+				i++
+				word = string(runes[start:i])
+			}
+			tokens = append(tokens, Token{Type: TOKEN_IDENTIFIER, Value: options.NormalizeName(word), Line: line, Column: column})
+			continue
+		}
+
+		// Handle string literals
+		if ch == '"' {
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '"' && runes[i] != '\n' {
+				i++
+			}
+			if i >= len(runes) || runes[i] != '"' {
+				return nil, &TokenizerError{Position: start, Char: ch, Message: "Unterminated string literal."}
 			}
+			tokens = append(tokens, Token{Type: TOKEN_STRING, Value: string(runes[start+1 : i]), Line: line, Column: column})
+			i++
 			continue
 		}
 
 		// Handle ==
 		if ch == '=' && i+1 < len(runes) && runes[i+1] == '=' {
-			tokens = append(tokens, Token{Type: TOKEN_REL_OP, Value: "==", Line: line})
+			tokens = append(tokens, Token{Type: TOKEN_REL_OP, Value: "==", Line: line, Column: column})
 			i += 2
 			continue
 		}
@@ -87,19 +123,31 @@ func Tokenize(input string) ([]Token, error) {
 		// Handle operators
 		op := string(ch)
 		if tokenType, found := operators[op]; found {
-			tokens = append(tokens, Token{Type: tokenType, Value: op, Line: line})
+			tokens = append(tokens, Token{Type: tokenType, Value: op, Line: line, Column: column})
 			i++
 			continue
 		}
 
 		// Handle parentheses
 		if ch == '(' {
-			tokens = append(tokens, Token{Type: TOKEN_LEFT_PAREN, Value: string(ch), Line: line})
+			tokens = append(tokens, Token{Type: TOKEN_LEFT_PAREN, Value: string(ch), Line: line, Column: column})
 			i++
 			continue
 		}
 		if ch == ')' {
-			tokens = append(tokens, Token{Type: TOKEN_RIGHT_PAREN, Value: string(ch), Line: line})
+			tokens = append(tokens, Token{Type: TOKEN_RIGHT_PAREN, Value: string(ch), Line: line, Column: column})
+			i++
+			continue
+		}
+
+		if ch == ',' {
+			tokens = append(tokens, Token{Type: TOKEN_COMMA, Value: string(ch), Line: line, Column: column})
+			i++
+			continue
+		}
+
+		if ch == ':' {
+			tokens = append(tokens, Token{Type: TOKEN_COLON, Value: string(ch), Line: line, Column: column})
 			i++
 			continue
 		}
@@ -108,6 +156,36 @@ func Tokenize(input string) ([]Token, error) {
 
 	}
 
-	tokens = append(tokens, Token{Type: TOKEN_EOF, Value: "EOF", Line: line})
+	tokens = append(tokens, Token{Type: TOKEN_EOF, Value: "EOF", Line: line, Column: len(runes) - lineStart + 1})
 	return tokens, nil
 }
+
+// endsOperand reports whether the last token ends an operand: a name, a
+// literal or a closing parenthesis.
+func endsOperand(tokens []Token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch tokens[len(tokens)-1].Type {
+	case TOKEN_IDENTIFIER, TOKEN_INTEGER, TOKEN_FLOAT, TOKEN_STRING, TOKEN_RIGHT_PAREN:
+		return true
+	}
+	return false
+}
+
+// scanComment reads the comment text that starts at i up to the end of the
+// line. The text is kept verbatim, apart from the '\r' of a CRLF line ending.
+func scanComment(runes []rune, i int) (int, string) {
+	start := i
+	for i < len(runes) && runes[i] != '\n' {
+		i++
+	}
+	return i, strings.TrimSuffix(string(runes[start:i]), "\r")
+}
+
+func isIdentifierRune(ch rune, options Options) bool {
+	if options.ExtendedNames {
+		return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+	}
+	return unicode.IsLetter(ch)
+}
@@ -2,6 +2,8 @@ package tokenizer
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 type TokenType string
@@ -16,9 +18,13 @@ const (
 	TOKEN_DO          TokenType = "DO"
 	TOKEN_STOP        TokenType = "STOP"
 	TOKEN_END         TokenType = "END"
+	TOKEN_DATA        TokenType = "DATA"
+	TOKEN_READ        TokenType = "READ"
+	TOKEN_RESTORE     TokenType = "RESTORE"
 	TOKEN_IDENTIFIER  TokenType = "IDENTIFIER"
 	TOKEN_INTEGER     TokenType = "INTEGER"
 	TOKEN_FLOAT       TokenType = "FLOAT"
+	TOKEN_STRING      TokenType = "STRING"
 	TOKEN_COMMENT     TokenType = "COMMENT"
 	TOKEN_ADD_SUB     TokenType = "ADD_SUB_OPERATOR"
 	TOKEN_MUL_DIV     TokenType = "MUL_DIV_OPERATOR"
@@ -26,25 +32,86 @@ const (
 	TOKEN_EQUALS      TokenType = "EQUALS_OPERATOR"
 	TOKEN_LEFT_PAREN  TokenType = "LEFT_PAREN"
 	TOKEN_RIGHT_PAREN TokenType = "RIGHT_PAREN"
+	TOKEN_COMMA       TokenType = "COMMA"
+	TOKEN_COLON       TokenType = "COLON"
+	TOKEN_NEWLINE     TokenType = "NEWLINE"
 	TOKEN_EOF         TokenType = "EOF"
 )
 
+// Options selects the lexer mode. The zero value is the strict mode of the
+// original grammar: uppercase keywords and identifiers made of letters only.
+type Options struct {
+	// IgnoreCase matches keywords regardless of their case, so "print" is PRINT.
+	IgnoreCase bool
+	// ExtendedNames allows digits and underscores in identifiers after the
+	// first letter, and a trailing '$' (string) or '%' (integer) type suffix.
+	ExtendedNames bool
+	// Names decides how identifiers are normalized before they reach the
+	// parser, which makes the policy hold for semantic analysis and codegen.
+	Names NamePolicy
+}
+
+type NamePolicy int
+
+const (
+	PreserveCase NamePolicy = iota
+	FoldCase
+)
+
+// NormalizeName applies the name policy to an identifier.
+func (o Options) NormalizeName(name string) string {
+	if o.Names == FoldCase {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+func (o Options) keyword(word string) (TokenType, bool) {
+	if o.IgnoreCase {
+		word = strings.ToUpper(word)
+	}
+	tokenType, found := keywords[word]
+	return tokenType, found
+}
+
+func (o Options) isRem(word string) bool {
+	if o.IgnoreCase {
+		return strings.EqualFold(word, "REM")
+	}
+	return word == "REM"
+}
+
 type Token struct {
-	Type  TokenType
-	Value string
-	Line  int
+	Type   TokenType
+	Value  string
+	Line   int
+	Column int
 }
 
 var keywords = map[string]TokenType{
-	"PRINT": TOKEN_PRINT,
-	"LET":   TOKEN_LET,
-	"IF":    TOKEN_IF,
-	"THEN":  TOKEN_THEN,
-	"ELSE":  TOKEN_ELSE,
-	"WHILE": TOKEN_WHILE,
-	"DO":    TOKEN_DO,
-	"STOP":  TOKEN_STOP,
-	"END":   TOKEN_END,
+	"PRINT":   TOKEN_PRINT,
+	"LET":     TOKEN_LET,
+	"IF":      TOKEN_IF,
+	"THEN":    TOKEN_THEN,
+	"ELSE":    TOKEN_ELSE,
+	"WHILE":   TOKEN_WHILE,
+	"DO":      TOKEN_DO,
+	"STOP":    TOKEN_STOP,
+	"END":     TOKEN_END,
+	"DATA":    TOKEN_DATA,
+	"READ":    TOKEN_READ,
+	"RESTORE": TOKEN_RESTORE,
+}
+
+// Keywords returns the keywords of the language in alphabetical order, REM
+// included.
+func Keywords() []string {
+	words := []string{"REM"}
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 var operators = map[string]TokenType{